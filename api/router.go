@@ -70,7 +70,7 @@ func tokenAuthMiddleware(c *gin.Context) {
 	c.Next()
 }
 
-func NewRouter(controller controller.ControllerInterface, config *config.APIConfig, token string, tokenChan chan string) IRouter {
+func NewRouter(controller controller.ControllerInterface, config *config.APIConfig, token string, tokenChan chan string, metricsHandler http.Handler) IRouter {
 	gin.SetMode(engineMode(config.Mode))
 	engine := gin.New()
 	if gin.IsDebugging() {
@@ -95,6 +95,10 @@ func NewRouter(controller controller.ControllerInterface, config *config.APIConf
 	})
 	engine.Use(tokenAuthMiddleware)
 
+	if metricsHandler != nil {
+		engine.GET("/metrics", gin.WrapH(metricsHandler))
+	}
+
 	engineHandlers := map[string]any{}
 	for _, version := range config.Versions {
 		routerHandler, err := factory.HandlerConstruct(version, controller)
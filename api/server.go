@@ -19,9 +19,9 @@ type APIServer struct {
 	shutdown bool
 }
 
-func NewAPIServer(controller controller.ControllerInterface, config *config.APIConfig, certBundle *model.CertificateBundle, token string, tokenChan chan string) (*APIServer, error) {
+func NewAPIServer(controller controller.ControllerInterface, config *config.APIConfig, certBundle *model.CertificateBundle, token string, tokenChan chan string, metricsHandler http.Handler) (*APIServer, error) {
 
-	router := NewRouter(controller, config, token, tokenChan)
+	router := NewRouter(controller, config, token, tokenChan, metricsHandler)
 	server := &APIServer{
 		svc: &http.Server{
 			Addr:         fmt.Sprintf(":%s", config.Port),
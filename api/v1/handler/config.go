@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	v1model "humpback-agent/api/v1/model"
+)
+
+// RefreshConfigHandleFunc 配置变更后同步刷新使用该配置的容器, 返回每个容器的结果, 文件改写不是原子的, 见RefreshConfigRequest
+func (handler *V1Handler) RefreshConfigHandleFunc(c *gin.Context) {
+	request, err := v1model.BindRefreshConfigRequest(c)
+	if err != nil {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	result := handler.Config().Refresh(c.Request.Context(), request)
+	if result.Error != nil {
+		c.JSON(result.Error.StatusCode, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, result.Object)
+}
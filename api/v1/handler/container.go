@@ -1,11 +1,17 @@
 package handler
 
 import (
+	"io"
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	v1model "humpback-agent/api/v1/model"
-	"net/http"
 )
 
+// SSE保活间隔, 避免中间代理断开空闲连接
+const statsStreamKeepAlive = 15 * time.Second
+
 func (handler *V1Handler) GetContainerHandleFunc(c *gin.Context) {
 	request, err := v1model.BindGetContainerRequest(c)
 	if err != nil {
@@ -58,6 +64,46 @@ func (handler *V1Handler) GetContainerStatsHandleFunc(c *gin.Context) {
 	c.JSON(http.StatusOK, result.Object)
 }
 
+// StreamContainerStatsHandleFunc 以SSE推送多个容器的实时stats, 所有容器的流结束或客户端断开时返回
+func (handler *V1Handler) StreamContainerStatsHandleFunc(c *gin.Context) {
+	request, err := v1model.BindStreamContainerStatsRequest(c)
+	if err != nil {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	subscription, err := handler.Container().SubscribeStats(c.Request.Context(), request)
+	if err != nil {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	defer subscription.Close()
+	//长连接不受服务端WriteTimeout限制
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	remaining := subscription.Len()
+	keepAlive := time.NewTicker(statsStreamKeepAlive)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			_, writeErr := io.WriteString(w, ": keepalive\n\n")
+			return writeErr == nil
+		case event := <-subscription.C:
+			c.SSEvent("stats", event)
+			if event.Closed {
+				remaining--
+			}
+			return remaining > 0
+		}
+	})
+}
+
 func (handler *V1Handler) CreateContainerHandleFunc(c *gin.Context) {
 	request, err := v1model.BindCreateContainerRequest(c)
 	if err != nil {
@@ -65,8 +111,7 @@ func (handler *V1Handler) CreateContainerHandleFunc(c *gin.Context) {
 		return
 	}
 
-	handler.taskChan <- &V1Task{ContainerCreateTask, request}
-	c.JSON(http.StatusAccepted, v1model.StdAcceptResult())
+	handler.dispatchTask(c, &V1Task{ContainerCreateTask, request})
 }
 
 func (handler *V1Handler) UpdateContainerHandleFunc(c *gin.Context) {
@@ -79,8 +124,7 @@ func (handler *V1Handler) DeleteContainerHandleFunc(c *gin.Context) {
 		return
 	}
 
-	handler.taskChan <- &V1Task{ContainerDeleteTask, request}
-	c.JSON(http.StatusAccepted, v1model.StdAcceptResult())
+	handler.dispatchTask(c, &V1Task{ContainerDeleteTask, request})
 }
 
 func (handler *V1Handler) RestartContainerHandleFunc(c *gin.Context) {
@@ -90,8 +134,7 @@ func (handler *V1Handler) RestartContainerHandleFunc(c *gin.Context) {
 		return
 	}
 
-	handler.taskChan <- &V1Task{ContainerRestartTask, request}
-	c.JSON(http.StatusAccepted, v1model.StdAcceptResult())
+	handler.dispatchTask(c, &V1Task{ContainerRestartTask, request})
 }
 
 func (handler *V1Handler) StartContainerHandleFunc(c *gin.Context) {
@@ -101,8 +144,7 @@ func (handler *V1Handler) StartContainerHandleFunc(c *gin.Context) {
 		return
 	}
 
-	handler.taskChan <- &V1Task{ContainerStartTask, request}
-	c.JSON(http.StatusAccepted, v1model.StdAcceptResult())
+	handler.dispatchTask(c, &V1Task{ContainerStartTask, request})
 }
 
 func (handler *V1Handler) StopContainerHandleFunc(c *gin.Context) {
@@ -112,6 +154,5 @@ func (handler *V1Handler) StopContainerHandleFunc(c *gin.Context) {
 		return
 	}
 
-	handler.taskChan <- &V1Task{ContainerStopTask, request}
-	c.JSON(http.StatusAccepted, v1model.StdAcceptResult())
+	handler.dispatchTask(c, &V1Task{ContainerStopTask, request})
 }
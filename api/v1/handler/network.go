@@ -3,7 +3,6 @@ package handler
 import (
 	"github.com/gin-gonic/gin"
 	v1model "humpback-agent/api/v1/model"
-	"net/http"
 )
 
 func (handler *V1Handler) GetNetworkHandleFunc(c *gin.Context) {
@@ -20,8 +19,7 @@ func (handler *V1Handler) CreateNetworkHandleFunc(c *gin.Context) {
 		return
 	}
 
-	handler.taskChan <- &V1Task{NetworkCreateTask, request}
-	c.JSON(http.StatusAccepted, v1model.StdAcceptResult())
+	handler.dispatchTask(c, &V1Task{NetworkCreateTask, request})
 }
 
 func (handler *V1Handler) UpdateNetworkHandleFunc(c *gin.Context) {
@@ -35,6 +33,5 @@ func (handler *V1Handler) DeleteNetworkHandleFunc(c *gin.Context) {
 		return
 	}
 
-	handler.taskChan <- &V1Task{NetworkDeleteTask, request}
-	c.JSON(http.StatusAccepted, v1model.StdAcceptResult())
+	handler.dispatchTask(c, &V1Task{NetworkDeleteTask, request})
 }
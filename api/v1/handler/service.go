@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	v1model "humpback-agent/api/v1/model"
+)
+
+func (handler *V1Handler) QueryServiceHandleFunc(c *gin.Context) {
+	result := handler.Service().List(c.Request.Context())
+	if result.Error != nil {
+		c.JSON(result.Error.StatusCode, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, result.Object)
+}
+
+func (handler *V1Handler) GetServiceHandleFunc(c *gin.Context) {
+	request, err := v1model.BindGetServiceRequest(c)
+	if err != nil {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	result := handler.Service().Get(c.Request.Context(), request)
+	if result.Error != nil {
+		c.JSON(result.Error.StatusCode, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, result.Object)
+}
+
+func (handler *V1Handler) GetGroupHandleFunc(c *gin.Context) {
+	request, err := v1model.BindGetGroupRequest(c)
+	if err != nil {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	result := handler.Service().Group(c.Request.Context(), request)
+	if result.Error != nil {
+		c.JSON(result.Error.StatusCode, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, result.Object)
+}
+
+func (handler *V1Handler) StartServiceHandleFunc(c *gin.Context) {
+	handler.serviceAction(c, v1model.ServiceActionStart)
+}
+
+func (handler *V1Handler) StopServiceHandleFunc(c *gin.Context) {
+	handler.serviceAction(c, v1model.ServiceActionStop)
+}
+
+func (handler *V1Handler) RestartServiceHandleFunc(c *gin.Context) {
+	handler.serviceAction(c, v1model.ServiceActionRestart)
+}
+
+func (handler *V1Handler) DeleteServiceHandleFunc(c *gin.Context) {
+	handler.serviceAction(c, v1model.ServiceActionDelete)
+}
+
+// serviceAction 批量操作同步执行, 返回每个容器的结果
+func (handler *V1Handler) serviceAction(c *gin.Context, action string) {
+	request, err := v1model.BindServiceActionRequest(c, action)
+	if err != nil {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	result := handler.Service().Action(c.Request.Context(), request)
+	if result.Error != nil {
+		c.JSON(result.Error.StatusCode, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, result.Object)
+}
@@ -6,11 +6,13 @@ import (
 	"humpback-agent/api/factory"
 	v1model "humpback-agent/api/v1/model"
 	"humpback-agent/controller"
+	"humpback-agent/internal/tracker"
 	"humpback-agent/model"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -53,13 +55,33 @@ func NewV1Handler(controller controller.ControllerInterface) factory.HandlerInte
 	}
 }
 
+// dispatchTask 投递异步任务, Agent关闭过程中不再接收新任务
+func (handler *V1Handler) dispatchTask(c *gin.Context, task *V1Task) {
+	if handler.Tracker().Closed() {
+		c.JSON(http.StatusServiceUnavailable, v1model.ServiceUnavailableErrorResult(v1model.ServerShuttingDownCode, v1model.ServerShuttingDownMsg))
+		return
+	}
+	handler.taskChan <- task
+	c.JSON(http.StatusAccepted, v1model.StdAcceptResult())
+}
+
 func (handler *V1Handler) watchTasks() {
 
 	for task := range handler.taskChan {
 		switch task.TaskType {
 		case ContainerCreateTask:
 			container := handler.Container()
-			go container.Create(context.Background(), task.TaskBody.(*v1model.CreateContainerRequest))
+			request := task.TaskBody.(*v1model.CreateContainerRequest)
+			if err := handler.Tracker().Go(tracker.OperationContainerCreate, request.ContainerName, func(ctx context.Context) {
+				container.Create(ctx, request)
+			}); err != nil {
+				logrus.Warnf("Container %s create task rejected, %s", request.ContainerName, err.Error())
+				container.BaseController().FailureChan() <- model.ContainerMeta{
+					ContainerName: request.ContainerName,
+					State:         model.ContainerStatusFailed,
+					ErrorMsg:      err.Error(),
+				}
+			}
 		case ContainerDeleteTask:
 			container := handler.Container()
 			request := task.TaskBody.(*v1model.DeleteContainerRequest)
@@ -68,26 +90,49 @@ func (handler *V1Handler) watchTasks() {
 				IsDelete:      true,
 			}
 			container.BaseController().FailureChan() <- containerMeta
-			go container.Delete(context.Background(), request)
+			handler.goTask(tracker.OperationContainerDelete, request.ContainerId, func(ctx context.Context) {
+				container.Delete(ctx, request)
+			})
 		case ContainerRestartTask:
 			container := handler.Container()
-			go container.Restart(context.Background(), task.TaskBody.(*v1model.RestartContainerRequest))
+			request := task.TaskBody.(*v1model.RestartContainerRequest)
+			handler.goTask(tracker.OperationContainerRestart, request.ContainerId, func(ctx context.Context) {
+				container.Restart(ctx, request)
+			})
 		case ContainerStartTask:
 			container := handler.Container()
-			go container.Start(context.Background(), task.TaskBody.(*v1model.StartContainerRequest))
+			request := task.TaskBody.(*v1model.StartContainerRequest)
+			handler.goTask(tracker.OperationContainerStart, request.ContainerId, func(ctx context.Context) {
+				container.Start(ctx, request)
+			})
 		case ContainerStopTask:
 			container := handler.Container()
-			go container.Stop(context.Background(), task.TaskBody.(*v1model.StopContainerRequest))
+			request := task.TaskBody.(*v1model.StopContainerRequest)
+			handler.goTask(tracker.OperationContainerStop, request.ContainerId, func(ctx context.Context) {
+				container.Stop(ctx, request)
+			})
 		case NetworkCreateTask:
 			network := handler.Network()
-			go network.Create(context.Background(), task.TaskBody.(*v1model.CreateNetworkRequest))
+			request := task.TaskBody.(*v1model.CreateNetworkRequest)
+			handler.goTask(tracker.OperationNetworkCreate, request.NetworkName, func(ctx context.Context) {
+				network.Create(ctx, request)
+			})
 		case NetworkDeleteTask:
 			network := handler.Network()
-			go network.Delete(context.Background(), task.TaskBody.(*v1model.DeleteNetworkRequest))
+			request := task.TaskBody.(*v1model.DeleteNetworkRequest)
+			handler.goTask(tracker.OperationNetworkDelete, request.NetworkId, func(ctx context.Context) {
+				network.Delete(ctx, request)
+			})
 		}
 	}
 }
 
+func (handler *V1Handler) goTask(kind string, target string, fn func(ctx context.Context)) {
+	if err := handler.Tracker().Go(kind, target, fn); err != nil {
+		logrus.Warnf("Task %s %s rejected, %s", kind, target, err.Error())
+	}
+}
+
 func (handler *V1Handler) SetRouter(version string, engine *gin.Engine) {
 	handler.apiVersion = version
 	routerRouter := engine.Group(fmt.Sprintf("api/%s", handler.apiVersion))
@@ -106,6 +151,30 @@ func (handler *V1Handler) SetRouter(version string, engine *gin.Engine) {
 			containerRouter.POST(":containerId/stop", handler.StopContainerHandleFunc)
 			containerRouter.GET(":containerId/logs", handler.GetContainerLogsHandleFunc)
 			containerRouter.GET(":containerId/stats", handler.GetContainerStatsHandleFunc)
+			containerRouter.GET("stats/stream", handler.StreamContainerStatsHandleFunc)
+		}
+
+		//service router
+		serviceRouter := routerRouter.Group("service")
+		{
+			serviceRouter.GET("", handler.QueryServiceHandleFunc)
+			serviceRouter.GET(":serviceId", handler.GetServiceHandleFunc)
+			serviceRouter.POST(":serviceId/start", handler.StartServiceHandleFunc)
+			serviceRouter.POST(":serviceId/stop", handler.StopServiceHandleFunc)
+			serviceRouter.POST(":serviceId/restart", handler.RestartServiceHandleFunc)
+			serviceRouter.DELETE(":serviceId", handler.DeleteServiceHandleFunc)
+		}
+
+		//group router
+		groupRouter := routerRouter.Group("group")
+		{
+			groupRouter.GET(":groupId", handler.GetGroupHandleFunc)
+		}
+
+		//config router
+		configRouter := routerRouter.Group("config")
+		{
+			configRouter.POST("refresh", handler.RefreshConfigHandleFunc)
 		}
 
 		//image router
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// RefreshConfigRequest 刷新使用这些配置的容器内的配置文件.
+// 单文件挂载只能原地改写, 刷新不是原子的: 改写期间容器内读取的进程可能读到新旧内容混合或尾部残留的旧内容,
+// 需要完整内容的服务应通过ConfigReload在改写完成后重新加载, 而不是自行监听文件变化
+type RefreshConfigRequest struct {
+	ConfigNames []string `json:"configNames"`
+}
+
+func BindRefreshConfigRequest(c *gin.Context) (*RefreshConfigRequest, *ErrorResult) {
+	request := &RefreshConfigRequest{}
+	if err := c.ShouldBindJSON(request); err != nil || len(request.ConfigNames) == 0 {
+		return nil, RequestErrorResult(RequestArgsErrorCode, RequestArgsErrorMsg)
+	}
+	return request, nil
+}
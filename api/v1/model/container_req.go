@@ -3,7 +3,9 @@ package model
 import (
 	"strconv"
 	"strings"
+	"time"
 
+	timetypes "github.com/docker/docker/api/types/time"
 	"github.com/gin-gonic/gin"
 )
 
@@ -68,30 +70,6 @@ func BindCreateContainerRequest(c *gin.Context) (*CreateContainerRequest, *Error
 	return request, nil
 }
 
-//type CreateContainerRequest struct {
-//	Name          string               `json:"name"`          // 容器名称
-//	Image         string               `json:"image"`         // 镜像名称
-//	OnlyCreate    bool                 `json:"onlyCreate"`    // 创建后立即启动
-//	AlwaysPull    bool                 `json:"alwaysPull"`    // 是否总是拉取镜像
-//	AutoRemove    bool                 `json:"autoRemove"`    // 是否自动删除容器
-//	PortMap       map[string]string    `json:"portMap"`       // 端口映射（hostPort:containerPort）
-//	PublishAll    bool                 `json:"publishAll"`    // 是否将所有暴露的端口映射到随机主机端口
-//	Command       []string             `json:"command"`       // 命令
-//	Entrypoint    []string             `json:"entrypoint"`    // 入口点
-//	WorkingDir    string               `json:"workingDir"`    // 工作目录
-//	Interactive   bool                 `json:"interactive"`   // 是否启用交互模式（-i）
-//	TTY           bool                 `json:"tty"`           // 是否启用 TTY（-t）
-//	Env           map[string]string    `json:"env"`           // 环境变量
-//	Labels        map[string]string    `json:"labels"`        // 标签
-//	RestartPolicy string               `json:"restartPolicy"` // 重启策略（never, always, on-failure, unless-stopped）
-//	Logger        *ContainerLogger     `json:"logger"`        // Logger 配置
-//	Network       *ContainerNetwork    `json:"network"`       // Network 配置
-//	Runtime       *ContainerRuntime    `json:"runtime"`       // Runtime 配置
-//	Sysctls       *ContainerSysctl     `json:"sysctls"`       // Sysctls 配置
-//	Resources     *ContainerResource   `json:"resources"`     // Resource Limits 配置
-//	Cap           *ContainerCapability `json:"cap"`           // Capabilities 配置
-//}
-
 type UpdateContainerRequest struct{}
 
 type DeleteContainerRequest struct {
@@ -168,6 +146,11 @@ func BindRestartContainerRequest(c *gin.Context) (*RestartContainerRequest, *Err
 	return request, nil
 }
 
+type RenameContainerRequest struct {
+	ContainerId string `json:"containerId"`
+	NewName     string `json:"newName"`
+}
+
 type GetContainerLogsRequest struct {
 	ContainerId string  `json:"containerId"`
 	Follow      *bool   `json:"follow"`     // 是否实时跟随日志
@@ -222,12 +205,94 @@ func BindGetContainerLogsRequest(c *gin.Context) (*GetContainerLogsRequest, *Err
 }
 
 type GetContainerStatsRequest struct {
-	ContainerId string `json:"containerId"`
+	ContainerId string        `json:"containerId"`
+	History     bool          `json:"history"` //带from/to/step参数时查询历史序列
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Step        time.Duration `json:"step"`
 }
 
+// BindGetContainerStatsRequest from/to支持RFC3339、unix时间戳或相对当前的时长(如1h), step支持时长或秒数
+// from未指定时从stats历史保留窗口开始
 func BindGetContainerStatsRequest(c *gin.Context) (*GetContainerStatsRequest, *ErrorResult) {
 	request := &GetContainerStatsRequest{
 		ContainerId: c.Param("containerId"),
 	}
+
+	from, to, step := c.Query("from"), c.Query("to"), c.Query("step")
+	if from == "" && to == "" && step == "" {
+		return request, nil
+	}
+
+	now := time.Now()
+	request.History = true
+	request.From, request.To = time.Time{}, now
+	var err error
+	if from != "" {
+		if request.From, err = parseStatsTime(from, now); err != nil {
+			return nil, RequestErrorResult(RequestArgsErrorCode, RequestArgsErrorMsg)
+		}
+	}
+
+	if to != "" {
+		if request.To, err = parseStatsTime(to, now); err != nil {
+			return nil, RequestErrorResult(RequestArgsErrorCode, RequestArgsErrorMsg)
+		}
+	}
+
+	if step != "" {
+		if request.Step, err = time.ParseDuration(step); err != nil {
+			seconds, parseErr := strconv.ParseInt(step, 10, 64)
+			if parseErr != nil {
+				return nil, RequestErrorResult(RequestArgsErrorCode, RequestArgsErrorMsg)
+			}
+			request.Step = time.Duration(seconds) * time.Second
+		}
+	}
+
+	if request.Step < 0 || request.To.Before(request.From) {
+		return nil, RequestErrorResult(RequestArgsErrorCode, RequestArgsErrorMsg)
+	}
+	return request, nil
+}
+
+func parseStatsTime(value string, reference time.Time) (time.Time, error) {
+	timestamp, err := timetypes.GetTimestamp(value, reference)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	seconds, nanoseconds, err := timetypes.ParseTimestamps(timestamp, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, nanoseconds), nil
+}
+
+// StreamContainerStatsRequest 按容器ID或服务/分组标签订阅实时stats, 三者至少指定一个
+type StreamContainerStatsRequest struct {
+	ContainerIds []string `json:"containerIds"`
+	ServiceId    string   `json:"serviceId"`
+	GroupId      string   `json:"groupId"`
+}
+
+func BindStreamContainerStatsRequest(c *gin.Context) (*StreamContainerStatsRequest, *ErrorResult) {
+	request := &StreamContainerStatsRequest{
+		ServiceId: c.Query("serviceId"),
+		GroupId:   c.Query("groupId"),
+	}
+
+	//containerIds支持逗号分隔或重复参数
+	for _, value := range c.QueryArray("containerIds") {
+		for _, containerId := range strings.Split(value, ",") {
+			if containerId = strings.TrimSpace(containerId); containerId != "" {
+				request.ContainerIds = append(request.ContainerIds, containerId)
+			}
+		}
+	}
+
+	if len(request.ContainerIds) == 0 && request.ServiceId == "" && request.GroupId == "" {
+		return nil, RequestErrorResult(RequestArgsErrorCode, RequestArgsErrorMsg)
+	}
 	return request, nil
 }
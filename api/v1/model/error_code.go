@@ -6,6 +6,8 @@ const (
 	ServerInternalErrorMsg  = "internal server error"
 	RequestArgsErrorCode    = "SYS90001"
 	RequestArgsErrorMsg     = "request args invalid"
+	ServerShuttingDownCode  = "SYS90002"
+	ServerShuttingDownMsg   = "agent is shutting down"
 	//Container error codes
 	ContainerNotFoundCode    = "CNT10000"
 	ContainerCreateErrorCode = "CNT10001"
@@ -13,11 +15,23 @@ const (
 	ContainerLogsErrorCode   = "CNT10003"
 	ContainerGetErrorCode    = "CNT10004"
 	ContainerStatsErrorCode  = "CNT10005"
+	ContainerRenameErrorCode = "CNT10006"
+	//Service error codes
+	ServiceNotFoundCode  = "SVC10000"
+	ServiceGetErrorCode  = "SVC10001"
+	ServiceActionErrCode = "SVC10002"
+	//Config error codes
+	ConfigRefreshErrorCode = "CFG10000"
 	//Image error codes
-	ImageNotFoundCode  = "IMG10000"
-	ImagePullErrorCode = "IMG10001"
+	ImageNotFoundCode         = "IMG10000"
+	ImagePullErrorCode        = "IMG10001"
+	ImageReferenceInvalidCode = "IMG10002"
 	//Network error codes
-	NetworkNotFoundCode    = "NET10000"
-	NetworkCreateErrorCode = "NET10001"
-	NetworkDeleteErrorCode = "NET10002"
+	NetworkNotFoundCode       = "NET10000"
+	NetworkCreateErrorCode    = "NET10001"
+	NetworkDeleteErrorCode    = "NET10002"
+	NetworkIPConflictCode     = "NET10003"
+	NetworkAttachErrorCode    = "NET10004"
+	NetworkPortConflictCode   = "NET10005"
+	NetworkPortAllocErrorCode = "NET10006"
 )
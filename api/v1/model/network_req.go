@@ -9,9 +9,13 @@ type GetNetworkRequest struct {
 }
 
 type CreateNetworkRequest struct {
-	NetworkName string `json:"networkName"`
-	Driver      string `json:"driver"`
-	Scope       string `json:"scope"`
+	NetworkName string            `json:"networkName"`
+	Driver      string            `json:"driver"`
+	Scope       string            `json:"scope"`
+	Internal    bool              `json:"internal"`
+	EnableIPv6  bool              `json:"enableIPv6"`
+	Subnets     []*NetworkSubnet  `json:"subnets"` //网络已存在时校验其包含这些子网
+	Options     map[string]string `json:"options"`
 }
 
 func BindCreateNetworkRequest(c *gin.Context) (*CreateNetworkRequest, *ErrorResult) {
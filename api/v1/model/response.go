@@ -43,6 +43,14 @@ func NotFoundErrorResult(code string, errMsg string) *ErrorResult {
 	}
 }
 
+func ServiceUnavailableErrorResult(code string, errMsg string) *ErrorResult {
+	return &ErrorResult{
+		StatusCode: http.StatusServiceUnavailable,
+		Code:       code,
+		ErrMsg:     errMsg,
+	}
+}
+
 func InternalErrorResult(code string, errMsg string) *ErrorResult {
 	return &ErrorResult{
 		StatusCode: http.StatusInternalServerError,
@@ -112,6 +120,13 @@ func ObjectNotFoundErrorResult(code string, errMsg string) *ObjectResult {
 	}
 }
 
+func ObjectServiceUnavailableErrorResult(code string, errMsg string) *ObjectResult {
+	slog.Error("service unavailable error: ", "code", code, "msg", errMsg)
+	return &ObjectResult{
+		Error: ServiceUnavailableErrorResult(code, errMsg),
+	}
+}
+
 func ObjectInternalErrorResult(code string, errMsg string) *ObjectResult {
 	slog.Error("internal error: ", "code", code, "msg", errMsg)
 	return &ObjectResult{
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ServiceActionStart   = "start"
+	ServiceActionStop    = "stop"
+	ServiceActionRestart = "restart"
+	ServiceActionDelete  = "delete"
+)
+
+type GetServiceRequest struct {
+	ServiceId string `json:"serviceId"`
+}
+
+func BindGetServiceRequest(c *gin.Context) (*GetServiceRequest, *ErrorResult) {
+	request := &GetServiceRequest{
+		ServiceId: c.Param("serviceId"),
+	}
+	if request.ServiceId == "" {
+		return nil, RequestErrorResult(RequestArgsErrorCode, RequestArgsErrorMsg)
+	}
+	return request, nil
+}
+
+type GetGroupRequest struct {
+	GroupId string `json:"groupId"`
+}
+
+func BindGetGroupRequest(c *gin.Context) (*GetGroupRequest, *ErrorResult) {
+	request := &GetGroupRequest{
+		GroupId: c.Param("groupId"),
+	}
+	if request.GroupId == "" {
+		return nil, RequestErrorResult(RequestArgsErrorCode, RequestArgsErrorMsg)
+	}
+	return request, nil
+}
+
+// ServiceActionRequest 对服务在本节点的所有容器执行批量操作
+type ServiceActionRequest struct {
+	ServiceId string `json:"serviceId"`
+	Action    string `json:"action"`
+	Force     bool   `json:"force"` //仅delete有效
+}
+
+func BindServiceActionRequest(c *gin.Context, action string) (*ServiceActionRequest, *ErrorResult) {
+	request := &ServiceActionRequest{
+		ServiceId: c.Param("serviceId"),
+		Action:    action,
+	}
+	if request.ServiceId == "" {
+		return nil, RequestErrorResult(RequestArgsErrorCode, RequestArgsErrorMsg)
+	}
+
+	if force := c.Query("force"); force != "" {
+		value, err := strconv.ParseBool(force)
+		if err != nil {
+			return nil, RequestErrorResult(RequestArgsErrorCode, RequestArgsErrorMsg)
+		}
+		request.Force = value
+	}
+	return request, nil
+}
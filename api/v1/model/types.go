@@ -1,5 +1,11 @@
 package model
 
+import (
+	"encoding/json"
+
+	"humpback-agent/pkg/utils"
+)
+
 type NetworkMode string
 
 var (
@@ -18,11 +24,31 @@ var (
 )
 
 type NetworkInfo struct {
-	Mode               NetworkMode `json:"mode"`        // custom模式需要创建网络
-	Hostname           string      `json:"hostname"`    // bridge及custom模式时可设置，用户容器的hostname
-	NetworkName        string      `json:"networkName"` //custom模式使用
-	UseMachineHostname bool        `json:"useMachineHostname"`
-	Ports              []*PortInfo `json:"ports"`
+	Mode               NetworkMode          `json:"mode"`        // custom模式需要创建网络
+	Hostname           string               `json:"hostname"`    // bridge及custom模式时可设置，用户容器的hostname
+	NetworkName        string               `json:"networkName"` //custom模式使用
+	UseMachineHostname bool                 `json:"useMachineHostname"`
+	Ports              []*PortInfo          `json:"ports"`
+	Networks           []*NetworkAttachment `json:"networks"` // custom模式第一个为主网络, bridge模式全部作为附加网络
+}
+
+type NetworkSubnet struct {
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway"`
+	IPRange string `json:"ipRange"`
+}
+
+// NetworkAttachment 容器加入的网络, 网络不存在时按Driver/Subnets创建
+type NetworkAttachment struct {
+	NetworkName string           `json:"networkName"`
+	Aliases     []string         `json:"aliases"`
+	IPv4Address string           `json:"ipv4Address"`
+	IPv6Address string           `json:"ipv6Address"`
+	MacAddress  string           `json:"macAddress"`
+	Driver      string           `json:"driver"`
+	Internal    bool             `json:"internal"`
+	EnableIPv6  bool             `json:"enableIPv6"`
+	Subnets     []*NetworkSubnet `json:"subnets"`
 }
 
 type PortInfo struct {
@@ -50,6 +76,16 @@ type Resources struct {
 	Memory            uint64 `json:"memory"`
 	MemoryReservation uint64 `json:"memoryReservation"`
 	MaxCpuUsage       uint64 `json:"maxCpuUsage"`
+	ShmSize           uint64 `json:"shmSize"`    // /dev/shm大小(MB)
+	PidsLimit         int64  `json:"pidsLimit"`  // 进程数限制, -1为不限制
+	CpusetCpus        string `json:"cpusetCpus"` // 允许使用的CPU(0-3, 0,1)
+	CpusetMems        string `json:"cpusetMems"` // 允许使用的NUMA内存节点
+}
+
+type Ulimit struct {
+	Name string `json:"name"`
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
 }
 
 type LogConfig struct {
@@ -57,6 +93,28 @@ type LogConfig struct {
 	Config map[string]string `json:"config"`
 }
 
+type ProbeType string
+
+var (
+	ProbeTypeHTTP ProbeType = "http"
+	ProbeTypeTCP  ProbeType = "tcp"
+)
+
+// ReadinessProbe 由agent执行的就绪探测, 不依赖镜像中的工具
+// Port为容器端口, 有发布端口时探测宿主机端口, 否则探测容器IP
+type ReadinessProbe struct {
+	Type             ProbeType         `json:"type"`
+	Port             uint              `json:"port"`
+	Path             string            `json:"path"`
+	ExpectedStatus   []int             `json:"expectedStatus"` //为空时2xx/3xx视为成功
+	Headers          map[string]string `json:"headers"`
+	InitialDelay     string            `json:"initialDelay"`
+	Interval         string            `json:"interval"`
+	Timeout          string            `json:"timeout"`
+	SuccessThreshold int               `json:"successThreshold"`
+	FailureThreshold int               `json:"failureThreshold"`
+}
+
 type ServiceVolumeType string
 
 var (
@@ -65,32 +123,144 @@ var (
 )
 
 const (
-	ContainerLabelServiceId   = "Humpback-ServiceId"
-	ContainerLabelServiceName = "Humpback-ServiceName"
-	ContainerLabelGroupId     = "Humpback-GroupId"
+	ContainerLabelServiceId       = "Humpback-ServiceId"
+	ContainerLabelServiceName     = "Humpback-ServiceName"
+	ContainerLabelGroupId         = "Humpback-GroupId"
+	ContainerLabelAutoHeal        = "Humpback-AutoHeal"
+	ContainerLabelReadiness       = "Humpback-ReadinessProbe"
+	ContainerLabelConfigVolumes   = "Humpback-ConfigVolumes"
+	ContainerLabelConfigReload    = "Humpback-ConfigReload"
+	ContainerLabelConfigTemplates = "Humpback-ConfigTemplates"
+	ContainerLabelSecretsId       = "Humpback-SecretsId"
+	ContainerLabelSecrets         = "Humpback-Secrets"
+	ContainerLabelImageDigest     = "Humpback-ImageDigest"
+)
+
+type HealthCheckType string
+
+var (
+	HealthCheckTypeCmd  HealthCheckType = "cmd"
+	HealthCheckTypeHTTP HealthCheckType = "http"
+	HealthCheckTypeTCP  HealthCheckType = "tcp"
+	HealthCheckTypeNone HealthCheckType = "none" //禁用镜像中定义的HEALTHCHECK
+)
+
+// HealthCheck 转换为docker HEALTHCHECK, 在容器内执行
+// http探测依赖镜像中的curl或wget, tcp探测依赖nc或bash
+type HealthCheck struct {
+	Type        HealthCheckType `json:"type"`
+	Command     string          `json:"command"` //cmd类型, 通过/bin/sh -c执行
+	Port        uint            `json:"port"`    //http/tcp类型
+	Path        string          `json:"path"`    //http类型
+	Interval    string          `json:"interval"`
+	Timeout     string          `json:"timeout"`
+	StartPeriod string          `json:"startPeriod"`
+	Retries     int             `json:"retries"`
+}
+
+// AutoHeal 容器持续unhealthy时由agent重启, 两次重启间隔不小于MinInterval
+type AutoHeal struct {
+	Enabled            bool   `json:"enabled"`
+	UnhealthyThreshold int    `json:"unhealthyThreshold"` //进入unhealthy后连续失败的探测次数
+	MinInterval        string `json:"minInterval"`
+}
+
+type ConfigReloadAction string
+
+var (
+	ConfigReloadActionNone    ConfigReloadAction = "none"
+	ConfigReloadActionSignal  ConfigReloadAction = "signal"
+	ConfigReloadActionRestart ConfigReloadAction = "restart"
+	ConfigReloadActionExec    ConfigReloadAction = "exec"
 )
 
+// ConfigReload 配置文件刷新后容器的重新加载方式
+type ConfigReload struct {
+	Action  ConfigReloadAction `json:"action"`
+	Signal  string             `json:"signal"`  //signal方式, 默认SIGHUP
+	Command CommandLine        `json:"command"` //exec方式在容器内执行的命令
+	Timeout string             `json:"timeout"` //exec方式等待命令结束的时长
+}
+
+// ContainerSecret secret以只读文件挂载到容器内, 内容从Master获取, 不会出现在标签、环境变量和日志中
+type ContainerSecret struct {
+	Name   string `json:"name"`
+	Target string `json:"target"` //容器内路径, 默认 /run/secrets/<name>
+	UID    int    `json:"uid"`
+	GID    int    `json:"gid"`
+}
+
 type ServiceVolume struct {
 	Type     ServiceVolumeType `json:"type"`
 	Target   string            `json:"target"`
 	Source   string            `json:"source"`
 	Readonly bool              `json:"readOnly"`
+	Template bool              `json:"template"` //配置按Go模板渲染, 可引用容器与主机信息
 }
 
 type ContainerMeta struct {
-	RegistryDomain string            `json:"registryDomain"`
-	Image          string            `json:"image"`
-	AlwaysPull     bool              `json:"alwaysPull"`
-	Command        string            `json:"command"`
-	Envs           []string          `json:"env"`
-	Labels         map[string]string `json:"labels"`
-	Volumes        []*ServiceVolume  `json:"volumes"`
-	Network        *NetworkInfo      `json:"network"`
-	RestartPolicy  *RestartPolicy    `json:"restartPolicy"`
-	Capabilities   *Capabilities     `json:"capabilities"`
-	LogConfig      *LogConfig        `json:"logConfig"`
-	Resources      *Resources        `json:"resources"`
-	Privileged     bool              `json:"privileged"`
+	RegistryDomain string             `json:"registryDomain"`
+	Image          string             `json:"image"`
+	AlwaysPull     bool               `json:"alwaysPull"`
+	Command        CommandLine        `json:"command"`
+	Envs           []string           `json:"env"`
+	Labels         map[string]string  `json:"labels"`
+	Volumes        []*ServiceVolume   `json:"volumes"`
+	Network        *NetworkInfo       `json:"network"`
+	RestartPolicy  *RestartPolicy     `json:"restartPolicy"`
+	Capabilities   *Capabilities      `json:"capabilities"`
+	LogConfig      *LogConfig         `json:"logConfig"`
+	Resources      *Resources         `json:"resources"`
+	Privileged     bool               `json:"privileged"`
+	HealthCheck    *HealthCheck       `json:"healthCheck"`
+	AutoHeal       *AutoHeal          `json:"autoHeal"`
+	ReadinessProbe *ReadinessProbe    `json:"readinessProbe"`
+	Entrypoint     CommandLine        `json:"entrypoint"`
+	WorkingDir     string             `json:"workingDir"`
+	User           string             `json:"user"`
+	Tmpfs          map[string]string  `json:"tmpfs"` // 容器路径 -> mount选项(如 rw,size=64m)
+	Ulimits        []*Ulimit          `json:"ulimits"`
+	Sysctls        ContainerSysctl    `json:"sysctls"`
+	Runtime        *ContainerRuntime  `json:"runtime"`
+	ExtraHosts     []string           `json:"extraHosts"` // hostname:ip
+	DNS            []string           `json:"dns"`
+	DNSSearch      []string           `json:"dnsSearch"`
+	DNSOptions     []string           `json:"dnsOptions"`
+	ReadonlyRootfs bool               `json:"readonlyRootfs"`
+	SecurityOpt    []string           `json:"securityOpt"`
+	StopSignal     string             `json:"stopSignal"`
+	StopTimeout    *int               `json:"stopTimeout"` // 秒
+	ConfigReload   *ConfigReload      `json:"configReload"`
+	Secrets        []*ContainerSecret `json:"secrets"`
+	PinDigest      bool               `json:"pinDigest"` //按镜像digest创建容器, 各节点运行相同的镜像
+}
+
+// CommandLine 命令或入口点, JSON中可以是参数数组, 也可以是按POSIX引号规则拆分的字符串
+type CommandLine []string
+
+func (commandLine *CommandLine) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var line string
+	if err := json.Unmarshal(data, &line); err == nil {
+		args, err := utils.ShellSplit(line)
+		if err != nil {
+			return err
+		}
+		*commandLine = append(CommandLine{}, args...)
+		return nil
+	}
+
+	var args []string
+	if err := json.Unmarshal(data, &args); err != nil {
+		return err
+	}
+	if args != nil {
+		*commandLine = append(CommandLine{}, args...)
+	}
+	return nil
 }
 
 type RegistryAuth struct {
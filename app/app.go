@@ -11,6 +11,7 @@ import (
 	"flag"
 	"fmt"
 	"humpback-agent/config"
+	"humpback-agent/internal/identity"
 	"humpback-agent/model"
 	"humpback-agent/pkg/utils"
 	"humpback-agent/service"
@@ -19,11 +20,15 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// 证书剩余有效期小于该值时重新注册
+const identityRenewBefore = time.Hour * 24
+
 func loadConfig(configPath string) (*config.AppConfig, error) {
 	logrus.Info("Loading server config....")
 	appConfig, err := config.NewAppConfig(configPath)
@@ -32,6 +37,7 @@ func loadConfig(configPath string) (*config.AppConfig, error) {
 	}
 
 	logrus.Info("-----------------HUMPBACK AGENT CONFIG-----------------")
+	logrus.Infof("Agent Data Directory: %s", appConfig.AgentConfig.DataDirectory)
 	logrus.Infof("API Bind: %s:%s", appConfig.APIConfig.HostIP, appConfig.APIConfig.Port)
 	logrus.Infof("API Versions: %v", appConfig.APIConfig.Versions)
 	logrus.Infof("API Middlewares: %v", appConfig.APIConfig.Middlewares)
@@ -89,13 +95,19 @@ func Bootstrap(ctx context.Context) {
 		return
 	}
 
-	certBundle, token, err := RegisterWithMaster(appConfig)
+	identityStore, err := newIdentityStore(appConfig.AgentConfig)
+	if err != nil {
+		logrus.Errorf("Init agent identity store error, %s", err.Error())
+		return
+	}
+
+	certBundle, token, err := loadOrRegister(appConfig, identityStore)
 	if err != nil {
 		logrus.Errorf("Register with master error, %s", err.Error())
 		return
 	}
 
-	agentService, err := service.NewAgentService(ctx, appConfig, certBundle, token)
+	agentService, err := service.NewAgentService(ctx, appConfig, certBundle, token, identityStore)
 	if err != nil {
 		logrus.Errorf("Init application agent service error, %s", err.Error())
 		return
@@ -110,8 +122,68 @@ func Bootstrap(ctx context.Context) {
 	utils.ProcessWaitForSignal(nil)
 }
 
+func newIdentityStore(agentConfig *config.AgentConfig) (*identity.Store, error) {
+	key, err := identity.LoadKey(agentConfig.IdentityKey, agentConfig.IdentityKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil {
+		logrus.Warn("Agent identity key not configured, private key will be stored unencrypted.")
+	}
+	return identity.NewStore(agentConfig.DataDirectory, key), nil
+}
+
+// loadOrRegister 优先使用本地持久化的身份信息, 不存在或已失效时才向Master注册
+func loadOrRegister(appConfig *config.AppConfig, identityStore *identity.Store) (*model.CertificateBundle, string, error) {
+	nodeIdentity, err := identityStore.Load()
+	if err != nil {
+		logrus.Warnf("Load agent identity %s error, %s", identityStore.FilePath(), err.Error())
+	}
+
+	if nodeIdentity != nil {
+		certBundle, bundleErr := buildCertificateBundle(nodeIdentity)
+		if bundleErr == nil {
+			bundleErr = validateCertificateBundle(certBundle)
+		}
+
+		if bundleErr == nil && nodeIdentity.Token != "" {
+			logrus.Infof("Agent identity loaded from %s, node: %s, certificate expires at %s.", identityStore.FilePath(), nodeIdentity.NodeId, certBundle.Cert.NotAfter.Format(time.RFC3339))
+			// 使用新密钥配置重写一次, 兼容之前未加密存储的身份文件
+			if saveErr := identityStore.Save(nodeIdentity); saveErr != nil {
+				logrus.Warnf("Save agent identity error, %s", saveErr.Error())
+			}
+			return certBundle, nodeIdentity.Token, nil
+		}
+
+		if bundleErr == nil {
+			bundleErr = errors.New("token is empty")
+		}
+		logrus.Warnf("Agent identity invalid, %s, register with master again.", bundleErr.Error())
+	}
+
+	if appConfig.ServerConfig.RegisterToken == "" {
+		return nil, "", errors.New("no valid local identity and register token is empty")
+	}
+
+	nodeIdentity, err = RegisterWithMaster(appConfig)
+	if err != nil {
+		return nil, "", err
+	}
+
+	certBundle, err := buildCertificateBundle(nodeIdentity)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err = identityStore.Save(nodeIdentity); err != nil {
+		logrus.Warnf("Save agent identity error, %s", err.Error())
+	}
+	return certBundle, nodeIdentity.Token, nil
+}
+
 // RegisterWithMaster 向Master注册并获取证书
-func RegisterWithMaster(appConfig *config.AppConfig) (*model.CertificateBundle, string, error) {
+func RegisterWithMaster(appConfig *config.AppConfig) (*identity.Identity, error) {
 	client := &http.Client{
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{
@@ -142,68 +214,100 @@ func RegisterWithMaster(appConfig *config.AppConfig) (*model.CertificateBundle,
 	// 发送请求
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, "", fmt.Errorf("registration request failed: %w", err)
+		return nil, fmt.Errorf("registration request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, "", fmt.Errorf("registration failed: %s", string(body))
+		return nil, fmt.Errorf("registration failed: %s", string(body))
 	}
 
 	// 解析响应
 	var regResp struct {
+		NodeId  string `json:"nodeId"`
 		CertPEM string `json:"certPem"`
 		KeyPEM  string `json:"keyPem"`
 		Token   string `json:"token"`
 		CAPEM   string `json:"caPem"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&regResp); err != nil {
-		return nil, "", fmt.Errorf("failed to parse registration response: %w", err)
+		return nil, fmt.Errorf("failed to parse registration response: %w", err)
 	}
 
+	slog.Info("Worker registered with master successfully")
+	return &identity.Identity{
+		NodeId:  regResp.NodeId,
+		Token:   regResp.Token,
+		CertPEM: regResp.CertPEM,
+		KeyPEM:  regResp.KeyPEM,
+		CAPEM:   regResp.CAPEM,
+	}, nil
+}
+
+func buildCertificateBundle(nodeIdentity *identity.Identity) (*model.CertificateBundle, error) {
 	// 创建证书包
-	certBlock, _ := pem.Decode([]byte(regResp.CertPEM))
+	certBlock, _ := pem.Decode([]byte(nodeIdentity.CertPEM))
 	if certBlock == nil {
-		return nil, "", errors.New("invalid certificate format")
+		return nil, errors.New("invalid certificate format")
 	}
 	cert, err := x509.ParseCertificate(certBlock.Bytes)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to parse certificate: %w", err)
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
 	}
 
-	keyBlock, _ := pem.Decode([]byte(regResp.KeyPEM))
+	keyBlock, _ := pem.Decode([]byte(nodeIdentity.KeyPEM))
 	if keyBlock == nil {
-		return nil, "", errors.New("invalid key format")
+		return nil, errors.New("invalid key format")
 	}
 
 	privKey, err := x509.ParseECPrivateKey(keyBlock.Bytes)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to parse private key: %w", err)
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
 
-	caBlock, _ := pem.Decode([]byte(regResp.CAPEM))
+	caBlock, _ := pem.Decode([]byte(nodeIdentity.CAPEM))
 	if caBlock == nil {
-		return nil, "", errors.New("invalid CA certificate format")
+		return nil, errors.New("invalid CA certificate format")
 	}
 	caCert, err := x509.ParseCertificate(caBlock.Bytes)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to parse CA certificate: %w", err)
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
 	}
 
 	certPool := x509.NewCertPool()
 	certPool.AddCert(caCert)
 
-	certBundle := &model.CertificateBundle{
+	return &model.CertificateBundle{
 		Cert:     cert,
 		PrivKey:  privKey,
 		CertPool: certPool,
-		CertPEM:  []byte(regResp.CertPEM),
-		KeyPEM:   []byte(regResp.KeyPEM),
+		CertPEM:  []byte(nodeIdentity.CertPEM),
+		KeyPEM:   []byte(nodeIdentity.KeyPEM),
+	}, nil
+}
+
+// validateCertificateBundle 校验证书有效期、CA签发关系以及证书与私钥是否匹配
+func validateCertificateBundle(certBundle *model.CertificateBundle) error {
+	now := time.Now()
+	if now.Before(certBundle.Cert.NotBefore) {
+		return fmt.Errorf("certificate not valid before %s", certBundle.Cert.NotBefore.Format(time.RFC3339))
+	}
+
+	if now.Add(identityRenewBefore).After(certBundle.Cert.NotAfter) {
+		return fmt.Errorf("certificate expired or expiring at %s", certBundle.Cert.NotAfter.Format(time.RFC3339))
 	}
 
-	currentToken := regResp.Token
+	if _, err := certBundle.Cert.Verify(x509.VerifyOptions{
+		Roots:       certBundle.CertPool,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("certificate verify error, %w", err)
+	}
 
-	slog.Info("Worker registered with master successfully")
-	return certBundle, currentToken, nil
+	if _, err := tls.X509KeyPair(certBundle.CertPEM, certBundle.KeyPEM); err != nil {
+		return fmt.Errorf("certificate and private key mismatch, %w", err)
+	}
+	return nil
 }
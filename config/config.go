@@ -25,6 +25,57 @@ var (
 	defaultVolumesPath = "/var/lib/humpback/volumes"
 )
 
+func defaultMetricsConfig() *MetricsConfig {
+	return &MetricsConfig{
+		Enabled: true,
+	}
+}
+
+func defaultStatsConfig() *StatsConfig {
+	return &StatsConfig{
+		Interval:  time.Second * 10,
+		Retention: time.Hour,
+	}
+}
+
+func defaultCrashLoopConfig() *CrashLoopConfig {
+	return &CrashLoopConfig{
+		Window:    time.Minute * 5,
+		Threshold: 5,
+		LogLines:  20,
+	}
+}
+
+func defaultPortsConfig() *PortsConfig {
+	return &PortsConfig{
+		ReservationTTL: time.Minute * 10,
+	}
+}
+
+func defaultImageGCConfig() *ImageGCConfig {
+	return &ImageGCConfig{
+		Enabled:       false, //回收会删除镜像, 需要显式开启
+		Interval:      time.Minute * 5,
+		HighWatermark: 85,
+		LowWatermark:  75,
+		MinAge:        time.Hour,
+	}
+}
+
+func defaultSecretsConfig() *SecretsConfig {
+	return &SecretsConfig{
+		RootDirectory: "/run/humpback/secrets",
+		RequireTmpfs:  true,
+	}
+}
+
+func defaultAgentConfig() *AgentConfig {
+	return &AgentConfig{
+		DataDirectory: "/var/lib/humpback/agent",
+		DrainTimeout:  time.Second * 60,
+	}
+}
+
 type APIConfig struct {
 	Port        string   `json:"port" yaml:"port" env:"HUMPBACK_AGENT_API_PORT"`
 	HostIP      string   `json:"hostIp" yaml:"hostIp" env:"HUMPBACK_AGENT_API_HOST_IP"`
@@ -57,12 +108,34 @@ type DockerTLSOpts struct {
 	InsecureSkipVerify bool   `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
 }
 
-type DockerRegistryOpts struct {
-	Default  string `json:"default" yaml:"default"`
+type RegistryCredentialOpts struct {
+	Server   string `json:"server" yaml:"server"`
 	UserName string `json:"userName" yaml:"userName"`
 	Password string `json:"password" yaml:"password"`
 }
 
+type RegistryMirrorEndpointOpts struct {
+	Host    string        `json:"host" yaml:"host"`
+	Timeout time.Duration `json:"timeout" yaml:"timeout"` //从该镜像源拉取的超时, 为0时不单独限制
+}
+
+// RegistryMirrorOpts 原仓库拉取失败后按顺序尝试镜像源
+type RegistryMirrorOpts struct {
+	Registry string                       `json:"registry" yaml:"registry"`
+	Timeout  time.Duration                `json:"timeout" yaml:"timeout"` //从原仓库拉取的超时, 为0时不单独限制
+	Mirrors  []RegistryMirrorEndpointOpts `json:"mirrors" yaml:"mirrors"`
+}
+
+// DockerRegistryOpts Default为未指定仓库的镜像使用的默认仓库, UserName/Password为默认仓库的凭据
+type DockerRegistryOpts struct {
+	Default          string                   `json:"default" yaml:"default"`
+	UserName         string                   `json:"userName" yaml:"userName"`
+	Password         string                   `json:"password" yaml:"password"`
+	Credentials      []RegistryCredentialOpts `json:"credentials" yaml:"credentials"`
+	DockerConfigFile string                   `json:"dockerConfigFile" yaml:"dockerConfigFile"` //为空时使用 $DOCKER_CONFIG/config.json 或 ~/.docker/config.json
+	Mirrors          []RegistryMirrorOpts     `json:"mirrors" yaml:"mirrors"`
+}
+
 type DockerConfig struct {
 	Host               string             `json:"host" yaml:"host" env:"HUMPBACK_DOCKER_HOST"`
 	Version            string             `json:"version" yaml:"version" env:"HUMPBACK_DOCKER_VERSION"`
@@ -87,12 +160,63 @@ type VolumesConfig struct {
 	RootDirectory string `json:"rootDirectory" yaml:"rootDirectory" env:"HUMPBACK_VOLUMES_ROOT_DIRECTORY"`
 }
 
+type AgentConfig struct {
+	DataDirectory   string        `json:"dataDirectory" yaml:"dataDirectory" env:"HUMPBACK_AGENT_DATA_DIRECTORY"`
+	IdentityKey     string        `json:"-" yaml:"-" env:"HUMPBACK_AGENT_IDENTITY_KEY"`                                  //身份文件私钥加密密钥, 只允许通过环境变量设置
+	IdentityKeyFile string        `json:"identityKeyFile" yaml:"identityKeyFile" env:"HUMPBACK_AGENT_IDENTITY_KEY_FILE"` //身份文件私钥加密密钥文件
+	DrainTimeout    time.Duration `json:"drainTimeout" yaml:"drainTimeout" env:"HUMPBACK_AGENT_DRAIN_TIMEOUT"`           //关闭时等待执行中操作完成的最长时间
+}
+
+type MetricsConfig struct {
+	Enabled       bool   `json:"enabled" yaml:"enabled" env:"HUMPBACK_METRICS_ENABLED"`
+	ListenAddress string `json:"listenAddress" yaml:"listenAddress" env:"HUMPBACK_METRICS_LISTEN_ADDRESS"` //为空时由API服务提供/metrics并使用API鉴权
+}
+
+type StatsConfig struct {
+	Interval  time.Duration `json:"interval" yaml:"interval" env:"HUMPBACK_STATS_INTERVAL"`    //容器stats后台采样间隔
+	Retention time.Duration `json:"retention" yaml:"retention" env:"HUMPBACK_STATS_RETENTION"` //容器stats历史保留时长
+}
+
+type CrashLoopConfig struct {
+	Window        time.Duration `json:"window" yaml:"window" env:"HUMPBACK_CRASH_LOOP_WINDOW"`                       //统计容器退出次数的滑动窗口
+	Threshold     int           `json:"threshold" yaml:"threshold" env:"HUMPBACK_CRASH_LOOP_THRESHOLD"`              //窗口内退出次数达到该值判定为CrashLoop
+	StopThreshold int           `json:"stopThreshold" yaml:"stopThreshold" env:"HUMPBACK_CRASH_LOOP_STOP_THRESHOLD"` //窗口内退出次数达到该值时停止容器, 0为不停止
+	LogLines      int           `json:"logLines" yaml:"logLines" env:"HUMPBACK_CRASH_LOOP_LOG_LINES"`                //CrashLoop时上报的最后日志行数
+}
+
+type PortsConfig struct {
+	TCPRange       string        `json:"tcpRange" yaml:"tcpRange" env:"HUMPBACK_PORTS_TCP_RANGE"`                   //TCP端口分配范围, 格式为begin-end, 为空时使用docker端口分配范围
+	UDPRange       string        `json:"udpRange" yaml:"udpRange" env:"HUMPBACK_PORTS_UDP_RANGE"`                   //UDP端口分配范围, 格式为begin-end, 为空时使用docker端口分配范围
+	ReservationTTL time.Duration `json:"reservationTTL" yaml:"reservationTTL" env:"HUMPBACK_PORTS_RESERVATION_TTL"` //已分配但容器未创建的端口保留时长
+}
+
+type ImageGCConfig struct {
+	Enabled       bool          `json:"enabled" yaml:"enabled" env:"HUMPBACK_IMAGE_GC_ENABLED"`                    //默认关闭, 开启后磁盘使用率超过高水位时删除未使用的镜像
+	Interval      time.Duration `json:"interval" yaml:"interval" env:"HUMPBACK_IMAGE_GC_INTERVAL"`                 //磁盘使用率检查间隔
+	HighWatermark int           `json:"highWatermark" yaml:"highWatermark" env:"HUMPBACK_IMAGE_GC_HIGH_WATERMARK"` //Docker根目录所在文件系统使用率(%)达到该值时开始回收
+	LowWatermark  int           `json:"lowWatermark" yaml:"lowWatermark" env:"HUMPBACK_IMAGE_GC_LOW_WATERMARK"`    //回收到使用率低于该值为止
+	MinAge        time.Duration `json:"minAge" yaml:"minAge" env:"HUMPBACK_IMAGE_GC_MIN_AGE"`                      //agent首次发现镜像后至少保留的时长
+	Allowlist     []string      `json:"allowlist" yaml:"allowlist" env:"HUMPBACK_IMAGE_GC_ALLOWLIST"`              //不回收的镜像, 支持通配符(如 registry.corp.com/base/*)或镜像ID
+}
+
+type SecretsConfig struct {
+	RootDirectory string `json:"rootDirectory" yaml:"rootDirectory" env:"HUMPBACK_SECRETS_ROOT_DIRECTORY"` //容器secret文件根目录
+	RequireTmpfs  bool   `json:"requireTmpfs" yaml:"requireTmpfs" env:"HUMPBACK_SECRETS_REQUIRE_TMPFS"`    //secret根目录必须位于tmpfs, 避免secret落盘
+}
+
 type AppConfig struct {
-	*APIConfig     `json:"api" yaml:"api"`
-	*ServerConfig  `json:"server" yaml:"server"`
-	*VolumesConfig `json:"volumes" yaml:"volumes"`
-	*DockerConfig  `json:"docker" yaml:"docker"`
-	*LoggerConfig  `json:"logger" yaml:"logger"`
+	*AgentConfig     `json:"agent" yaml:"agent"`
+	*APIConfig       `json:"api" yaml:"api"`
+	*ServerConfig    `json:"server" yaml:"server"`
+	*VolumesConfig   `json:"volumes" yaml:"volumes"`
+	*DockerConfig    `json:"docker" yaml:"docker"`
+	*LoggerConfig    `json:"logger" yaml:"logger"`
+	*MetricsConfig   `json:"metrics" yaml:"metrics"`
+	*StatsConfig     `json:"stats" yaml:"stats"`
+	*CrashLoopConfig `json:"crashLoop" yaml:"crashLoop"`
+	*PortsConfig     `json:"ports" yaml:"ports"`
+	*SecretsConfig   `json:"secrets" yaml:"secrets"`
+	*ImageGCConfig   `json:"imageGC" yaml:"imageGC"`
 }
 
 func NewAppConfig(configPath string) (*AppConfig, error) {
@@ -101,7 +225,15 @@ func NewAppConfig(configPath string) (*AppConfig, error) {
 		return nil, err
 	}
 
-	appConfig := AppConfig{}
+	appConfig := AppConfig{
+		AgentConfig:     defaultAgentConfig(),
+		MetricsConfig:   defaultMetricsConfig(),
+		StatsConfig:     defaultStatsConfig(),
+		CrashLoopConfig: defaultCrashLoopConfig(),
+		PortsConfig:     defaultPortsConfig(),
+		SecretsConfig:   defaultSecretsConfig(),
+		ImageGCConfig:   defaultImageGCConfig(),
+	}
 	if err = yaml.Unmarshal(data, &appConfig); err != nil {
 		return nil, err
 	}
@@ -114,6 +246,18 @@ func NewAppConfig(configPath string) (*AppConfig, error) {
 		return nil, ErrAPIConfigInvalid
 	}
 
+	if appConfig.AgentConfig == nil {
+		appConfig.AgentConfig = defaultAgentConfig()
+	}
+
+	if appConfig.AgentConfig.DataDirectory == "" {
+		appConfig.AgentConfig.DataDirectory = defaultAgentConfig().DataDirectory
+	}
+
+	if appConfig.AgentConfig.DrainTimeout <= 0 {
+		appConfig.AgentConfig.DrainTimeout = defaultAgentConfig().DrainTimeout
+	}
+
 	if appConfig.VolumesConfig == nil || appConfig.VolumesConfig.RootDirectory == "" {
 		appConfig.VolumesConfig = &VolumesConfig{
 			RootDirectory: defaultVolumesPath,
@@ -127,5 +271,63 @@ func NewAppConfig(configPath string) (*AppConfig, error) {
 	if appConfig.LoggerConfig == nil {
 		appConfig.LoggerConfig = defaultLogConfig
 	}
+
+	if appConfig.MetricsConfig == nil {
+		appConfig.MetricsConfig = defaultMetricsConfig()
+	}
+
+	if appConfig.StatsConfig == nil {
+		appConfig.StatsConfig = defaultStatsConfig()
+	}
+
+	if appConfig.StatsConfig.Interval <= 0 {
+		appConfig.StatsConfig.Interval = defaultStatsConfig().Interval
+	}
+
+	if appConfig.StatsConfig.Retention < appConfig.StatsConfig.Interval {
+		appConfig.StatsConfig.Retention = defaultStatsConfig().Retention
+	}
+
+	if appConfig.CrashLoopConfig == nil {
+		appConfig.CrashLoopConfig = defaultCrashLoopConfig()
+	}
+
+	if appConfig.CrashLoopConfig.Window <= 0 {
+		appConfig.CrashLoopConfig.Window = defaultCrashLoopConfig().Window
+	}
+
+	if appConfig.CrashLoopConfig.Threshold <= 0 {
+		appConfig.CrashLoopConfig.Threshold = defaultCrashLoopConfig().Threshold
+	}
+
+	if appConfig.PortsConfig == nil {
+		appConfig.PortsConfig = defaultPortsConfig()
+	}
+
+	if appConfig.PortsConfig.ReservationTTL <= 0 {
+		appConfig.PortsConfig.ReservationTTL = defaultPortsConfig().ReservationTTL
+	}
+
+	if appConfig.SecretsConfig == nil {
+		appConfig.SecretsConfig = defaultSecretsConfig()
+	}
+
+	if appConfig.SecretsConfig.RootDirectory == "" {
+		appConfig.SecretsConfig.RootDirectory = defaultSecretsConfig().RootDirectory
+	}
+
+	if appConfig.ImageGCConfig == nil {
+		appConfig.ImageGCConfig = defaultImageGCConfig()
+	}
+
+	if appConfig.ImageGCConfig.Interval <= 0 {
+		appConfig.ImageGCConfig.Interval = defaultImageGCConfig().Interval
+	}
+
+	if appConfig.ImageGCConfig.HighWatermark <= 0 || appConfig.ImageGCConfig.HighWatermark > 100 ||
+		appConfig.ImageGCConfig.LowWatermark <= 0 || appConfig.ImageGCConfig.LowWatermark >= appConfig.ImageGCConfig.HighWatermark {
+		appConfig.ImageGCConfig.HighWatermark = defaultImageGCConfig().HighWatermark
+		appConfig.ImageGCConfig.LowWatermark = defaultImageGCConfig().LowWatermark
+	}
 	return &appConfig, nil
 }
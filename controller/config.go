@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/configvol"
+	"humpback-agent/internal/tracker"
+	"humpback-agent/model"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+const (
+	defaultReloadSignal      = "SIGHUP"
+	defaultReloadExecTimeout = time.Second * 30
+)
+
+type ConfigControllerInterface interface {
+	BaseController() ControllerInterface
+	Refresh(ctx context.Context, request *v1model.RefreshConfigRequest) *v1model.ObjectResult
+}
+
+type ConfigController struct {
+	baseController ControllerInterface
+	client         *client.Client
+}
+
+func NewConfigController(baseController ControllerInterface, client *client.Client) ConfigControllerInterface {
+	return &ConfigController{
+		baseController: baseController,
+		client:         client,
+	}
+}
+
+func (controller *ConfigController) BaseController() ControllerInterface {
+	return controller.baseController
+}
+
+// Refresh 重新获取配置并刷新使用这些配置的容器的配置文件, 内容变化的运行中容器按其重新加载方式处理
+func (controller *ConfigController) Refresh(ctx context.Context, request *v1model.RefreshConfigRequest) *v1model.ObjectResult {
+	configNames := request.ConfigNames
+	trackCtx, done, err := controller.baseController.Tracker().Track(tracker.OperationConfigRefresh, strings.Join(configNames, ","))
+	if err != nil {
+		return v1model.ObjectServiceUnavailableErrorResult(v1model.ServerShuttingDownCode, err.Error())
+	}
+
+	defer done()
+	//请求断开时仍完成已开始的刷新, 关闭时由tracker取消
+	refreshCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stop := context.AfterFunc(trackCtx, cancel)
+	defer stop()
+
+	configValues, err := controller.baseController.ConfigValues(refreshCtx, configNames)
+	if err != nil {
+		return v1model.ObjectInternalErrorResult(v1model.ConfigRefreshErrorCode, err.Error())
+	}
+
+	var containers []types.Container
+	if err = controller.baseController.WithTimeout(refreshCtx, func(ctx context.Context) error {
+		var listErr error
+		containers, listErr = controller.client.ContainerList(ctx, container.ListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("label", v1model.ContainerLabelConfigVolumes)),
+		})
+		return listErr
+	}); err != nil {
+		return v1model.ObjectInternalErrorResult(v1model.ConfigRefreshErrorCode, err.Error())
+	}
+
+	type rewriteResult struct {
+		changed bool
+		err     error
+	}
+	rewritten := map[string]*rewriteResult{}
+	result := &model.ConfigRefreshResult{
+		ConfigNames: configNames,
+		Containers:  []*model.ContainerConfigRefresh{},
+	}
+	for _, item := range containers {
+		volumes := configvol.FromLabels(item.Labels)
+		refresh := &model.ContainerConfigRefresh{
+			ContainerId:   item.ID,
+			ContainerName: containerName(item.Names),
+			ReloadAction:  string(v1model.ConfigReloadActionNone),
+		}
+		var errs []error
+		var templateContext *configvol.TemplateContext
+		templates := configvol.TemplatesFromLabels(item.Labels)
+		for configName, data := range configValues {
+			volume, ok := volumes[configName]
+			if !ok {
+				continue
+			}
+
+			refresh.ConfigNames = append(refresh.ConfigNames, configName)
+			rewrite, ok := rewritten[volume]
+			if !ok {
+				rewrite = &rewriteResult{}
+				if templates[configName] {
+					if templateContext == nil {
+						templateContext, rewrite.err = controller.templateContext(refreshCtx, item.ID)
+					}
+					if rewrite.err == nil {
+						data, rewrite.err = configvol.Render(configName, data, templateContext)
+					}
+				}
+				if rewrite.err == nil {
+					rewrite.changed, rewrite.err = controller.baseController.ConfigVolumes().Rewrite(volume, data)
+				}
+				rewritten[volume] = rewrite
+			}
+			refresh.Changed = refresh.Changed || rewrite.changed
+			if rewrite.err != nil {
+				errs = append(errs, fmt.Errorf("rewrite config %s error, %w", configName, rewrite.err))
+			}
+		}
+
+		if len(refresh.ConfigNames) == 0 {
+			continue
+		}
+
+		sort.Strings(refresh.ConfigNames)
+		if len(errs) == 0 && refresh.Changed && item.State == "running" {
+			reload, err := parseConfigReload(item.Labels)
+			if reload != nil {
+				refresh.ReloadAction = string(reload.Action)
+			}
+			if err == nil && reload != nil {
+				err = controller.reload(refreshCtx, item.ID, reload)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("reload error, %w", err))
+			}
+		}
+
+		if err = errors.Join(errs...); err != nil {
+			refresh.Error = err.Error()
+		}
+		result.Containers = append(result.Containers, refresh)
+	}
+	return v1model.ResultWithObject(result)
+}
+
+// templateContext 按容器当前配置构建模板上下文
+func (controller *ConfigController) templateContext(ctx context.Context, containerId string) (*configvol.TemplateContext, error) {
+	var containerJSON types.ContainerJSON
+	if err := controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
+		var inspectErr error
+		containerJSON, inspectErr = controller.client.ContainerInspect(ctx, containerId)
+		return inspectErr
+	}); err != nil {
+		return nil, err
+	}
+
+	hostInfo := controller.baseController.HostInfo()
+	var portBindings nat.PortMap
+	if containerJSON.HostConfig != nil {
+		portBindings = containerJSON.HostConfig.PortBindings
+	}
+	return configvol.NewTemplateContext(containerJSON.Name, containerJSON.Config.Image, containerJSON.Config.Env, containerJSON.Config.Labels, hostInfo.Hostname, hostInfo.HostIPs, portBindings), nil
+}
+
+func (controller *ConfigController) reload(ctx context.Context, containerId string, reload *v1model.ConfigReload) error {
+	switch reload.Action {
+	case v1model.ConfigReloadActionSignal:
+		return controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
+			return controller.client.ContainerKill(ctx, containerId, reload.Signal)
+		})
+	case v1model.ConfigReloadActionRestart:
+		return controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
+			return controller.client.ContainerRestart(ctx, containerId, container.StopOptions{})
+		})
+	case v1model.ConfigReloadActionExec:
+		return controller.exec(ctx, containerId, reload)
+	}
+	return nil
+}
+
+// exec 在容器内执行重新加载命令并等待结束, 退出码非0视为失败
+func (controller *ConfigController) exec(ctx context.Context, containerId string, reload *v1model.ConfigReload) error {
+	timeout := defaultReloadExecTimeout
+	if reload.Timeout != "" {
+		timeout, _ = time.ParseDuration(reload.Timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	execResp, err := controller.client.ContainerExecCreate(ctx, containerId, container.ExecOptions{Cmd: []string(reload.Command)})
+	if err != nil {
+		return err
+	}
+
+	if err = controller.client.ContainerExecStart(ctx, execResp.ID, container.ExecStartOptions{Detach: true}); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(time.Millisecond * 200)
+	defer ticker.Stop()
+	for {
+		execInfo, err := controller.client.ContainerExecInspect(ctx, execResp.ID)
+		if err != nil {
+			return err
+		}
+		if !execInfo.Running {
+			if execInfo.ExitCode != 0 {
+				return fmt.Errorf("reload command exit code %d", execInfo.ExitCode)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("reload command not finished in %s", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseConfigReload 解析Humpback-ConfigReload标签, 没有配置时返回nil
+func parseConfigReload(labels map[string]string) (*v1model.ConfigReload, error) {
+	value, ok := labels[v1model.ContainerLabelConfigReload]
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	reload := &v1model.ConfigReload{}
+	if err := json.Unmarshal([]byte(value), reload); err != nil {
+		return nil, err
+	}
+	return reload, validateConfigReload(reload)
+}
+
+// validateConfigReload 校验重新加载方式并填充默认值
+func validateConfigReload(reload *v1model.ConfigReload) error {
+	switch reload.Action {
+	case "", v1model.ConfigReloadActionNone:
+		reload.Action = v1model.ConfigReloadActionNone
+	case v1model.ConfigReloadActionSignal:
+		if reload.Signal == "" {
+			reload.Signal = defaultReloadSignal
+		}
+		if !isValidStopSignal(reload.Signal) {
+			return fmt.Errorf("reload signal %s invalid", reload.Signal)
+		}
+	case v1model.ConfigReloadActionRestart:
+	case v1model.ConfigReloadActionExec:
+		if len(reload.Command) == 0 {
+			return errors.New("reload command is empty")
+		}
+		if reload.Timeout != "" {
+			if timeout, err := time.ParseDuration(reload.Timeout); err != nil || timeout <= 0 {
+				return fmt.Errorf("reload timeout %s invalid", reload.Timeout)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported reload action %s", reload.Action)
+	}
+	return nil
+}
+
+func containerName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(names[0], "/")
+}
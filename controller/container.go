@@ -2,21 +2,24 @@ package controller
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/configvol"
+	"humpback-agent/internal/credstore"
 	"humpback-agent/internal/schedule"
+	"humpback-agent/internal/stats"
 	"humpback-agent/model"
 
+	"github.com/distribution/reference"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
@@ -37,8 +40,11 @@ type ContainerControllerInterface interface {
 	Start(ctx context.Context, request *v1model.StartContainerRequest) *v1model.ObjectResult
 	Restart(ctx context.Context, request *v1model.RestartContainerRequest) *v1model.ObjectResult
 	Stop(ctx context.Context, request *v1model.StopContainerRequest) *v1model.ObjectResult
+	Rename(ctx context.Context, request *v1model.RenameContainerRequest) *v1model.ObjectResult
 	Logs(ctx context.Context, request *v1model.GetContainerLogsRequest) *v1model.ObjectResult
 	Stats(ctx context.Context, request *v1model.GetContainerStatsRequest) *v1model.ObjectResult
+	SubscribeStats(ctx context.Context, request *v1model.StreamContainerStatsRequest) (*stats.Subscription, *v1model.ErrorResult)
+	RestoreSecrets(ctx context.Context, labels map[string]string) (bool, error)
 }
 
 type ContainerController struct {
@@ -117,12 +123,37 @@ func (controller *ContainerController) Create(ctx context.Context, request *v1mo
 
 func (controller *ContainerController) createInternal(ctx context.Context, request *v1model.CreateContainerRequest) *v1model.ObjectResult {
 
-	value, _ := json.MarshalIndent(request, "", "    ")
+	value, _ := json.MarshalIndent(redactCreateRequest(request), "", "    ")
 	fmt.Printf("%s\n", value)
 
-	image := filepath.Join(request.RegistryDomain, request.Image)
+	if result := controller.validateCreateRequest(request); result != nil {
+		return result
+	}
+
+	named, err := controller.BaseController().Registries().ParseImage(request.RegistryDomain, request.Image)
+	if err != nil {
+		return v1model.ObjectRequestErrorResult(v1model.ImageReferenceInvalidCode, err.Error())
+	}
+
+	image := reference.FamiliarString(named)
+	//按digest创建时先查询tag在仓库中当前的digest, 各节点拉取并运行相同的镜像, 不使用本地缓存的旧镜像
+	_, pinned := named.(reference.Canonical)
+	if request.PinDigest && !pinned {
+		registryAuth := encodeRegistryAuth(request.RegistryAuth.ServerAddress, request.RegistryAuth.RegistryUsername, request.RegistryAuth.RegistryPassword)
+		imageDigest, err := controller.BaseController().Puller().RemoteDigest(ctx, image, registryAuth)
+		if err != nil {
+			return v1model.ObjectInternalErrorResult(v1model.ImagePullErrorCode, err.Error())
+		}
+		canonical, err := reference.ParseNormalizedNamed(named.Name() + "@" + imageDigest)
+		if err != nil {
+			return v1model.ObjectInternalErrorResult(v1model.ImagePullErrorCode, err.Error())
+		}
+		image = reference.FamiliarString(canonical)
+		pinned = true
+	}
+
 	//先尝试处理镜像
-	if pullResult := controller.BaseController().Image().AttemptPull(context.Background(), image, request.AlwaysPull, request.RegistryAuth); pullResult.Error != nil {
+	if pullResult := controller.BaseController().Image().AttemptPull(ctx, image, request.AlwaysPull, request.RegistryAuth); pullResult.Error != nil {
 		return v1model.ObjectInternalErrorResult(v1model.ImagePullErrorCode, pullResult.Error.ErrMsg)
 	}
 
@@ -132,6 +163,23 @@ func (controller *ContainerController) createInternal(ctx context.Context, reque
 		request.Labels = make(map[string]string)
 	}
 
+	//记录镜像digest, 从镜像源拉取的镜像记录镜像源的digest, 与原仓库相同
+	delete(request.Labels, v1model.ContainerLabelImageDigest)
+	imageDigest, err := controller.BaseController().Puller().ResolveDigest(ctx, image)
+	if err != nil {
+		return v1model.ObjectInternalErrorResult(v1model.ImagePullErrorCode, err.Error())
+	}
+	if imageDigest != "" {
+		request.Labels[v1model.ContainerLabelImageDigest] = imageDigest
+	}
+
+	//镜像源拉取的digest镜像没有原名称的引用, 使用镜像源的digest引用创建
+	if pinned {
+		if image, err = controller.BaseController().Puller().LocalReference(ctx, image); err != nil {
+			return v1model.ObjectInternalErrorResult(v1model.ImagePullErrorCode, err.Error())
+		}
+	}
+
 	request.Labels[v1model.ContainerLabelServiceId] = request.ServiceId
 	request.Labels[v1model.ContainerLabelGroupId] = request.GroupId
 	request.Labels[v1model.ContainerLabelServiceName] = request.ServiceName
@@ -149,10 +197,19 @@ func (controller *ContainerController) createInternal(ctx context.Context, reque
 		request.Labels[schedule.HumpbackJobAlwaysPullLabel] = strconv.FormatBool(request.AlwaysPull)
 		request.Labels[schedule.HumpbackJobMaxTimeoutLabel] = request.ScheduleInfo.Timeout
 
+		//标签中只记录凭据ID, 凭据加密保存在agent本地
+		delete(request.Labels, schedule.HumpbackJobImageAuth)
+		delete(request.Labels, schedule.HumpbackJobImageAuthId)
 		if request.RegistryAuth.RegistryUsername != "" && request.RegistryAuth.RegistryPassword != "" {
-			combined := strings.Join([]string{request.RegistryAuth.RegistryUsername, request.RegistryAuth.RegistryPassword, request.RegistryAuth.ServerAddress}, "^^")
-			encoded := base64.StdEncoding.EncodeToString([]byte(combined))
-			request.Labels[schedule.HumpbackJobImageAuth] = encoded
+			authId, err := controller.BaseController().Credentials().Put(credstore.Credential{
+				Registry: request.RegistryAuth.ServerAddress,
+				Username: request.RegistryAuth.RegistryUsername,
+				Password: request.RegistryAuth.RegistryPassword,
+			})
+			if err != nil {
+				return v1model.ObjectInternalErrorResult(v1model.ContainerCreateErrorCode, err.Error())
+			}
+			request.Labels[schedule.HumpbackJobImageAuthId] = authId
 		}
 	}
 
@@ -162,8 +219,8 @@ func (controller *ContainerController) createInternal(ctx context.Context, reque
 		Labels: request.Labels,
 	}
 
-	if request.Command != "" {
-		containerConfig.Cmd = strings.Fields(request.Command)
+	if len(request.Command) > 0 {
+		containerConfig.Cmd = []string(request.Command)
 	}
 
 	hostConfig := &container.HostConfig{
@@ -226,27 +283,41 @@ func (controller *ContainerController) createInternal(ctx context.Context, reque
 		}
 	}
 
+	//容器未创建成功时释放为其预留的端口
+	created := false
+	defer func() {
+		if !created {
+			controller.BaseController().PortAllocator().ReleaseReserved(request.ContainerName)
+		}
+	}()
+
 	var networkConfig *network.NetworkingConfig
+	var extraEndpoints map[string]*network.EndpointSettings //创建后启动前连接的附加网络
 	if request.Network != nil {
 		hostname := request.Network.Hostname
 		if request.Network.UseMachineHostname {
 			hostname, _ = os.Hostname()
 		}
-		if request.Network.Mode == v1model.NetworkModeCustom { //构建自定义网络
+		if request.Network.Mode == v1model.NetworkModeCustom { //构建自定义网络, 第一个网络为主网络
 			containerConfig.Hostname = hostname
-			if request.Network.NetworkName != "" {
-				networkResult := controller.BaseController().Network().Create(ctx, &v1model.CreateNetworkRequest{NetworkName: request.Network.NetworkName, Driver: "bridge", Scope: "local"})
-				if networkResult.Error != nil {
-					return networkResult
+			attachments := request.Network.Networks
+			if len(attachments) == 0 && request.Network.NetworkName != "" {
+				attachments = []*v1model.NetworkAttachment{{NetworkName: request.Network.NetworkName}}
+			}
+			if len(attachments) > 0 {
+				endpoints, result := controller.buildNetworkEndpoints(ctx, attachments)
+				if result != nil {
+					return result
 				}
-				hostConfig.NetworkMode = container.NetworkMode(request.Network.NetworkName)
+				primary := attachments[0].NetworkName
+				hostConfig.NetworkMode = container.NetworkMode(primary)
 				networkConfig = &network.NetworkingConfig{
 					EndpointsConfig: map[string]*network.EndpointSettings{
-						request.Network.NetworkName: {
-							NetworkID: networkResult.ObjectId,
-						},
+						primary: endpoints[primary],
 					},
 				}
+				delete(endpoints, primary)
+				extraEndpoints = endpoints
 			}
 		} else if request.Network.Mode == v1model.NetworkModeHost {
 			hostConfig.NetworkMode = container.NetworkMode(request.Network.Mode)
@@ -261,6 +332,21 @@ func (controller *ContainerController) createInternal(ctx context.Context, reque
 					},
 				},
 			}
+			if len(request.Network.Networks) > 0 {
+				endpoints, result := controller.buildNetworkEndpoints(ctx, request.Network.Networks)
+				if result != nil {
+					return result
+				}
+				extraEndpoints = endpoints
+			}
+		}
+
+		var primaryEndpoint *network.EndpointSettings
+		if networkConfig != nil {
+			primaryEndpoint = networkConfig.EndpointsConfig[string(hostConfig.NetworkMode)]
+		}
+		if err := controller.applyPrimaryMacAddress(containerConfig, primaryEndpoint, extraEndpoints); err != nil {
+			return v1model.ObjectRequestErrorResult(v1model.NetworkAttachErrorCode, err.Error())
 		}
 
 		portBindings := nat.PortMap{}
@@ -273,13 +359,15 @@ func (controller *ContainerController) createInternal(ctx context.Context, reque
 				}
 				port, err := nat.NewPort(proto, strconv.Itoa(int(bindPort.ContainerPort)))
 				if err != nil {
-					return v1model.ObjectInternalErrorResult(v1model.ContainerCreateErrorCode, err.Error())
+					return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, err.Error())
 				}
 				hostPort := int(bindPort.HostPort)
 				if hostPort == 0 {
-					if hostPort, err = controller.BaseController().AllocPort(proto); err != nil {
-						return v1model.ObjectInternalErrorResult(v1model.ContainerCreateErrorCode, err.Error())
+					if hostPort, err = controller.BaseController().PortAllocator().Allocate(proto, request.ContainerName); err != nil {
+						return v1model.ObjectInternalErrorResult(v1model.NetworkPortAllocErrorCode, err.Error())
 					}
+				} else if err = controller.BaseController().PortAllocator().Reserve(proto, hostPort, request.ContainerName); err != nil {
+					return v1model.ObjectRequestErrorResult(v1model.NetworkPortConflictCode, err.Error())
 				}
 				containerConfig.ExposedPorts[port] = struct{}{}
 				portBindings[port] = []nat.PortBinding{{HostPort: strconv.Itoa(hostPort)}}
@@ -290,18 +378,91 @@ func (controller *ContainerController) createInternal(ctx context.Context, reque
 		}
 	}
 
+	if err := applyContainerSpec(request.ContainerMeta, containerConfig, hostConfig); err != nil {
+		return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, err.Error())
+	}
+
+	if request.HealthCheck != nil {
+		healthcheck, err := buildHealthcheck(request.HealthCheck)
+		if err != nil {
+			return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, err.Error())
+		}
+		containerConfig.Healthcheck = healthcheck
+	}
+
+	if request.ConfigReload != nil {
+		if request.ConfigReload.Action != v1model.ConfigReloadActionNone {
+			value, err := json.Marshal(request.ConfigReload)
+			if err != nil {
+				return v1model.ObjectInternalErrorResult(v1model.ContainerCreateErrorCode, err.Error())
+			}
+			request.Labels[v1model.ContainerLabelConfigReload] = string(value)
+		}
+	}
+
+	if request.AutoHeal != nil && request.AutoHeal.Enabled {
+		value, err := json.Marshal(request.AutoHeal)
+		if err != nil {
+			return v1model.ObjectInternalErrorResult(v1model.ContainerCreateErrorCode, err.Error())
+		}
+		request.Labels[v1model.ContainerLabelAutoHeal] = string(value)
+	}
+
+	if request.ReadinessProbe != nil {
+		value, err := json.Marshal(request.ReadinessProbe)
+		if err != nil {
+			return v1model.ObjectInternalErrorResult(v1model.ContainerCreateErrorCode, err.Error())
+		}
+		request.Labels[v1model.ContainerLabelReadiness] = string(value)
+	}
+
 	//处理卷配置绑定
-	if err := controller.buildHostConfigVolumesWithRequest(request.Volumes, hostConfig); err != nil {
+	hostInfo := controller.BaseController().HostInfo()
+	templateContext := configvol.NewTemplateContext(request.ContainerName, image, containerConfig.Env, request.Labels, hostInfo.Hostname, hostInfo.HostIPs, hostConfig.PortBindings)
+	configVolumes, configTemplates, err := controller.buildHostConfigVolumesWithRequest(request.Volumes, hostConfig, templateContext)
+	//容器创建结束前配置卷不会被清理
+	defer controller.BaseController().ConfigVolumes().Done(configVolumes)
+	if err != nil {
 		return v1model.ObjectInternalErrorResult(v1model.ContainerCreateErrorCode, err.Error())
 	}
+	if len(configVolumes) > 0 {
+		request.Labels[v1model.ContainerLabelConfigVolumes] = configvol.ToLabel(configVolumes)
+	}
+	if len(configTemplates) > 0 {
+		request.Labels[v1model.ContainerLabelConfigTemplates] = configvol.TemplatesToLabel(configTemplates)
+	}
+
+	if len(request.Secrets) > 0 {
+		secretsId, secretMounts, err := controller.buildSecretMounts(ctx, request.Secrets)
+		if err != nil {
+			return v1model.ObjectInternalErrorResult(v1model.ContainerCreateErrorCode, err.Error())
+		}
+		defer func() {
+			if !created {
+				controller.BaseController().Secrets().Remove(secretsId)
+			}
+		}()
+		//标签只记录secret目录ID与secret名称, 用于删除容器时清理以及主机重启后恢复
+		secretsSpec, _ := json.Marshal(request.Secrets)
+		request.Labels[v1model.ContainerLabelSecretsId] = secretsId
+		request.Labels[v1model.ContainerLabelSecrets] = string(secretsSpec)
+		hostConfig.Mounts = append(hostConfig.Mounts, secretMounts...)
+	}
 
 	var containerInfo container.CreateResponse
-	err := controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
+	err = controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
 		var createdErr error
 		containerInfo, createdErr = controller.client.ContainerCreate(ctx, containerConfig, hostConfig, networkConfig, nil, request.ContainerName)
 		if createdErr != nil {
 			return createdErr
 		}
+		created = true
+		if connectErr := controller.connectNetworks(ctx, containerInfo.ID, extraEndpoints); connectErr != nil {
+			//网络未完整连接的容器不保留
+			controller.client.ContainerRemove(context.WithoutCancel(ctx), containerInfo.ID, container.RemoveOptions{Force: true})
+			created = false
+			return connectErr
+		}
 		if !isJob { //Job容器创建后自动启动
 			return controller.client.ContainerStart(ctx, containerInfo.ID, container.StartOptions{})
 		}
@@ -309,6 +470,9 @@ func (controller *ContainerController) createInternal(ctx context.Context, reque
 	})
 
 	if err != nil {
+		if isAddressConflict(err) {
+			return v1model.ObjectRequestErrorResult(v1model.NetworkIPConflictCode, err.Error())
+		}
 		return v1model.ObjectInternalErrorResult(v1model.ContainerCreateErrorCode, err.Error())
 	}
 	return v1model.ResultWithObjectId(containerInfo.ID)
@@ -402,6 +566,18 @@ func (controller *ContainerController) Stop(ctx context.Context, request *v1mode
 	return v1model.ResultWithObjectId(containerId)
 }
 
+func (controller *ContainerController) Rename(ctx context.Context, request *v1model.RenameContainerRequest) *v1model.ObjectResult {
+	if err := controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
+		return controller.client.ContainerRename(ctx, request.ContainerId, request.NewName)
+	}); err != nil {
+		if errdefs.IsNotFound(err) {
+			return v1model.ObjectNotFoundErrorResult(v1model.ContainerNotFoundCode, err.Error())
+		}
+		return v1model.ObjectInternalErrorResult(v1model.ContainerRenameErrorCode, err.Error())
+	}
+	return v1model.ResultWithObjectId(request.ContainerId)
+}
+
 func (controller *ContainerController) Logs(ctx context.Context, request *v1model.GetContainerLogsRequest) *v1model.ObjectResult {
 	options := container.LogsOptions{
 		ShowStdout: true, // 显示标准输出
@@ -475,6 +651,10 @@ func (controller *ContainerController) Logs(ctx context.Context, request *v1mode
 }
 
 func (controller *ContainerController) Stats(ctx context.Context, request *v1model.GetContainerStatsRequest) *v1model.ObjectResult {
+	if request.History {
+		return controller.statsHistory(ctx, request)
+	}
+
 	containerStats := container.StatsResponse{}
 	if err := controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
 		statsReader, statsErr := controller.client.ContainerStats(ctx, request.ContainerId, true)
@@ -489,11 +669,103 @@ func (controller *ContainerController) Stats(ctx context.Context, request *v1mod
 	return v1model.ResultWithObject(model.ParseContainerStats(&containerStats))
 }
 
-func (controller *ContainerController) buildHostConfigVolumesWithRequest(reqVolumes []*v1model.ServiceVolume, hostConfig *container.HostConfig) error {
+// statsHistory 从后台采样的历史中查询, 不访问docker stats
+func (controller *ContainerController) statsHistory(ctx context.Context, request *v1model.GetContainerStatsRequest) *v1model.ObjectResult {
+	var containerBody types.ContainerJSON
+	if err := controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
+		var err error
+		containerBody, err = controller.client.ContainerInspect(ctx, request.ContainerId)
+		return err
+	}); err != nil {
+		if errdefs.IsNotFound(err) {
+			return v1model.ObjectNotFoundErrorResult(v1model.ContainerNotFoundCode, err.Error())
+		}
+		return v1model.ObjectInternalErrorResult(v1model.ContainerStatsErrorCode, err.Error())
+	}
+
+	request.From, request.To = controller.baseController.StatsSampler().ClampWindow(request.From, request.To)
+
+	series, ok := controller.baseController.StatsSampler().History(containerBody.ID, request.From, request.To, request.Step)
+	if !ok {
+		//容器存在但还没有采样历史
+		series = &model.ContainerStatsSeries{
+			ContainerId: containerBody.ID,
+			From:        request.From.UnixMilli(),
+			To:          request.To.UnixMilli(),
+			Step:        request.Step.Milliseconds(),
+			Points:      []*model.ContainerStatsPoint{},
+		}
+	}
+	return v1model.ResultWithObject(series)
+}
+
+// SubscribeStats 订阅运行中容器的实时stats, 按标签订阅时以订阅时刻匹配到的容器为准
+func (controller *ContainerController) SubscribeStats(ctx context.Context, request *v1model.StreamContainerStatsRequest) (*stats.Subscription, *v1model.ErrorResult) {
+	targets := make(map[string]string)
+	err := controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
+		for _, containerId := range request.ContainerIds {
+			containerBody, err := controller.client.ContainerInspect(ctx, containerId)
+			if err != nil {
+				return err
+			}
+			if containerBody.State != nil && containerBody.State.Running {
+				targets[containerBody.ID] = strings.TrimPrefix(containerBody.Name, "/")
+			}
+		}
+
+		if request.ServiceId == "" && request.GroupId == "" {
+			return nil
+		}
+
+		filterArgs := filters.NewArgs()
+		if request.ServiceId != "" {
+			filterArgs.Add("label", fmt.Sprintf("%s=%s", v1model.ContainerLabelServiceId, request.ServiceId))
+		}
+		if request.GroupId != "" {
+			filterArgs.Add("label", fmt.Sprintf("%s=%s", v1model.ContainerLabelGroupId, request.GroupId))
+		}
+		containers, err := controller.client.ContainerList(ctx, container.ListOptions{Filters: filterArgs})
+		if err != nil {
+			return err
+		}
+		for _, item := range containers {
+			name := ""
+			if len(item.Names) > 0 {
+				name = strings.TrimPrefix(item.Names[0], "/")
+			}
+			targets[item.ID] = name
+		}
+		return nil
+	})
+
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, v1model.NotFoundErrorResult(v1model.ContainerNotFoundCode, err.Error())
+		}
+		return nil, v1model.InternalErrorResult(v1model.ContainerStatsErrorCode, err.Error())
+	}
+
+	if len(targets) == 0 {
+		return nil, v1model.NotFoundErrorResult(v1model.ContainerNotFoundCode, "no running container matched")
+	}
+	return controller.baseController.StatsHub().Subscribe(ctx, targets), nil
+}
+
+// buildHostConfigVolumesWithRequest 构建挂载配置, 返回使用的配置文件卷以及按模板渲染的配置
+func (controller *ContainerController) buildHostConfigVolumesWithRequest(reqVolumes []*v1model.ServiceVolume, hostConfig *container.HostConfig, templateContext *configvol.TemplateContext) (map[string]string, map[string]bool, error) {
 	configNames := controller.BaseController().GetConfigNamesWithVolumes(reqVolumes)
-	configPaths, err := controller.BaseController().BuildVolumesWithConfigNames(configNames)
+	configTemplates := map[string]bool{}
+	for _, volume := range reqVolumes {
+		if volume.Type == v1model.ServiceVolumeTypeBind && volume.Template {
+			if matches := re.FindStringSubmatch(volume.Source); len(matches) > 1 {
+				configTemplates[matches[1]] = true
+			}
+		}
+	}
+
+	configPaths, configVolumes, err := controller.BaseController().BuildVolumesWithConfigNames(configNames, configTemplates, templateContext)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	var mounts []mount.Mount
@@ -503,7 +775,7 @@ func (controller *ContainerController) buildHostConfigVolumesWithRequest(reqVolu
 			if len(matches) > 1 {
 				path, ret := configPaths[matches[1]]
 				if !ret {
-					return fmt.Errorf("invalid %s volume path: %s", volume.Type, volume.Source)
+					return configVolumes, nil, fmt.Errorf("invalid %s volume path: %s", volume.Type, volume.Source)
 				}
 				volume.Source = path
 			}
@@ -518,5 +790,61 @@ func (controller *ContainerController) buildHostConfigVolumesWithRequest(reqVolu
 		}
 	}
 	hostConfig.Mounts = mounts
-	return nil
+	return configVolumes, configTemplates, nil
+}
+
+func buildHealthcheck(healthCheck *v1model.HealthCheck) (*container.HealthConfig, error) {
+	if healthCheck.Retries < 0 {
+		return nil, errors.New("health check retries invalid")
+	}
+
+	healthConfig := &container.HealthConfig{Retries: healthCheck.Retries}
+	switch healthCheck.Type {
+	case v1model.HealthCheckTypeNone:
+		healthConfig.Test = []string{"NONE"}
+		return healthConfig, nil
+	case v1model.HealthCheckTypeCmd:
+		if healthCheck.Command == "" {
+			return nil, errors.New("health check command is empty")
+		}
+		healthConfig.Test = []string{"CMD-SHELL", healthCheck.Command}
+	case v1model.HealthCheckTypeHTTP:
+		if healthCheck.Port == 0 {
+			return nil, errors.New("health check port is empty")
+		}
+		path := healthCheck.Path
+		if strings.ContainsAny(path, "'\\") {
+			return nil, errors.New("health check path invalid")
+		}
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		url := fmt.Sprintf("http://127.0.0.1:%d%s", healthCheck.Port, path)
+		healthConfig.Test = []string{"CMD-SHELL", fmt.Sprintf("curl -fsS -o /dev/null '%[1]s' || wget -q -O /dev/null '%[1]s' || exit 1", url)}
+	case v1model.HealthCheckTypeTCP:
+		if healthCheck.Port == 0 {
+			return nil, errors.New("health check port is empty")
+		}
+		healthConfig.Test = []string{"CMD-SHELL", fmt.Sprintf("nc -z 127.0.0.1 %[1]d || bash -c 'echo > /dev/tcp/127.0.0.1/%[1]d' || exit 1", healthCheck.Port)}
+	default:
+		return nil, fmt.Errorf("unsupported health check type %s", healthCheck.Type)
+	}
+
+	var err error
+	for _, item := range []struct {
+		value  string
+		target *time.Duration
+	}{
+		{healthCheck.Interval, &healthConfig.Interval},
+		{healthCheck.Timeout, &healthConfig.Timeout},
+		{healthCheck.StartPeriod, &healthConfig.StartPeriod},
+	} {
+		if item.value == "" {
+			continue
+		}
+		if *item.target, err = time.ParseDuration(item.value); err != nil {
+			return nil, fmt.Errorf("health check duration %s invalid, %v", item.value, err)
+		}
+	}
+	return healthConfig, nil
 }
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	v1model "humpback-agent/api/v1/model"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/versions"
+)
+
+// 该版本之前的API只支持容器级别的MAC地址
+const endpointMacAddressAPIVersion = "1.44"
+
+// buildNetworkEndpoints 确保网络存在并校验静态地址, 返回每个网络的endpoint配置
+func (controller *ContainerController) buildNetworkEndpoints(ctx context.Context, attachments []*v1model.NetworkAttachment) (map[string]*network.EndpointSettings, *v1model.ObjectResult) {
+	if err := validateAttachments(attachments); err != nil {
+		return nil, v1model.ObjectRequestErrorResult(v1model.NetworkAttachErrorCode, err.Error())
+	}
+
+	endpoints := make(map[string]*network.EndpointSettings, len(attachments))
+	for _, attachment := range attachments {
+		driver := attachment.Driver
+		if driver == "" {
+			driver = "bridge"
+		}
+		networkResult := controller.BaseController().Network().Create(ctx, &v1model.CreateNetworkRequest{
+			NetworkName: attachment.NetworkName,
+			Driver:      driver,
+			Scope:       "local",
+			Internal:    attachment.Internal,
+			EnableIPv6:  attachment.EnableIPv6,
+			Subnets:     attachment.Subnets,
+		})
+		if networkResult.Error != nil {
+			return nil, networkResult
+		}
+
+		endpoint := &network.EndpointSettings{
+			NetworkID:  networkResult.ObjectId,
+			Aliases:    attachment.Aliases,
+			MacAddress: attachment.MacAddress,
+		}
+		if attachment.IPv4Address != "" || attachment.IPv6Address != "" {
+			getResult := controller.BaseController().Network().Get(ctx, &v1model.GetNetworkRequest{NetworkId: networkResult.ObjectId})
+			if getResult.Error != nil {
+				return nil, getResult
+			}
+			networkBody := getResult.Object.(network.Inspect)
+			for _, address := range []string{attachment.IPv4Address, attachment.IPv6Address} {
+				if result := checkStaticAddress(networkBody, address); result != nil {
+					return nil, result
+				}
+			}
+			endpoint.IPAMConfig = &network.EndpointIPAMConfig{
+				IPv4Address: attachment.IPv4Address,
+				IPv6Address: attachment.IPv6Address,
+			}
+		}
+		endpoints[attachment.NetworkName] = endpoint
+	}
+	return endpoints, nil
+}
+
+// applyPrimaryMacAddress 旧版本API的主网络MAC地址需要设置在容器配置上, 附加网络不支持MAC地址
+func (controller *ContainerController) applyPrimaryMacAddress(containerConfig *container.Config, primary *network.EndpointSettings, extras map[string]*network.EndpointSettings) error {
+	if !versions.LessThan(controller.client.ClientVersion(), endpointMacAddressAPIVersion) {
+		return nil
+	}
+
+	if primary != nil && primary.MacAddress != "" {
+		containerConfig.MacAddress = primary.MacAddress //nolint:staticcheck // API < v1.44 only supports the container-wide MacAddress.
+		primary.MacAddress = ""
+	}
+
+	for networkName, endpoint := range extras {
+		if endpoint.MacAddress != "" {
+			return fmt.Errorf("mac address on additional network %s requires docker API %s or later", networkName, endpointMacAddressAPIVersion)
+		}
+	}
+	return nil
+}
+
+// connectNetworks 容器创建后连接附加网络, 必须在启动前完成
+func (controller *ContainerController) connectNetworks(ctx context.Context, containerId string, endpoints map[string]*network.EndpointSettings) error {
+	for networkName, endpoint := range endpoints {
+		if err := controller.client.NetworkConnect(ctx, endpoint.NetworkID, containerId, endpoint); err != nil {
+			return fmt.Errorf("connect network %s error, %w", networkName, err)
+		}
+	}
+	return nil
+}
+
+// validateAttachments 校验附加网络的名称与静态地址, 不访问docker
+func validateAttachments(attachments []*v1model.NetworkAttachment) error {
+	names := make(map[string]struct{}, len(attachments))
+	for _, attachment := range attachments {
+		if attachment == nil || attachment.NetworkName == "" {
+			return errors.New("network name is empty")
+		}
+
+		if _, ok := names[attachment.NetworkName]; ok {
+			return fmt.Errorf("network %s attached more than once", attachment.NetworkName)
+		}
+		names[attachment.NetworkName] = struct{}{}
+
+		if err := validateAttachmentAddress(attachment); err != nil {
+			return err
+		}
+
+		if err := validateSubnets(attachment.Subnets); err != nil {
+			return fmt.Errorf("network %s %w", attachment.NetworkName, err)
+		}
+	}
+	return nil
+}
+
+func validateAttachmentAddress(attachment *v1model.NetworkAttachment) error {
+	if attachment.IPv4Address != "" {
+		if ip := net.ParseIP(attachment.IPv4Address); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("ipv4 address %s invalid", attachment.IPv4Address)
+		}
+	}
+
+	if attachment.IPv6Address != "" {
+		if ip := net.ParseIP(attachment.IPv6Address); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("ipv6 address %s invalid", attachment.IPv6Address)
+		}
+	}
+
+	if attachment.MacAddress != "" {
+		if _, err := net.ParseMAC(attachment.MacAddress); err != nil {
+			return fmt.Errorf("mac address %s invalid", attachment.MacAddress)
+		}
+	}
+	return nil
+}
+
+// checkStaticAddress 静态地址必须属于网络配置的子网, 且未被其他容器占用
+func checkStaticAddress(networkBody network.Inspect, address string) *v1model.ObjectResult {
+	if address == "" {
+		return nil
+	}
+
+	ip := net.ParseIP(address)
+	inSubnet := false
+	for _, ipamConfig := range networkBody.IPAM.Config {
+		if _, subnet, err := net.ParseCIDR(ipamConfig.Subnet); err == nil && subnet.Contains(ip) {
+			inSubnet = true
+			break
+		}
+	}
+	if !inSubnet {
+		return v1model.ObjectRequestErrorResult(v1model.NetworkAttachErrorCode, fmt.Sprintf("ip %s is not in any configured subnet of network %s", address, networkBody.Name))
+	}
+
+	for _, endpoint := range networkBody.Containers {
+		for _, used := range []string{endpoint.IPv4Address, endpoint.IPv6Address} {
+			usedIP, _, _ := strings.Cut(used, "/")
+			if usedIP != "" && net.ParseIP(usedIP).Equal(ip) {
+				return v1model.ObjectRequestErrorResult(v1model.NetworkIPConflictCode, fmt.Sprintf("ip %s is already used by container %s on network %s", address, endpoint.Name, networkBody.Name))
+			}
+		}
+	}
+	return nil
+}
+
+// isAddressConflict docker分配静态地址冲突时的错误
+func isAddressConflict(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "address already in use")
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/secrets"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+const defaultSecretsTarget = "/run/secrets"
+
+// validateSecrets 校验secret名称与挂载路径, 未指定路径时挂载到/run/secrets/<name>
+func validateSecrets(containerSecrets []*v1model.ContainerSecret) error {
+	targets := map[string]struct{}{}
+	for _, secret := range containerSecrets {
+		if secret == nil || !secrets.ValidName(secret.Name) {
+			return fmt.Errorf("secret name invalid")
+		}
+		if secret.Target == "" {
+			secret.Target = path.Join(defaultSecretsTarget, secret.Name)
+		}
+		if !path.IsAbs(secret.Target) {
+			return fmt.Errorf("secret %s target %s must be absolute", secret.Name, secret.Target)
+		}
+		if _, ok := targets[secret.Target]; ok {
+			return fmt.Errorf("secret target %s duplicated", secret.Target)
+		}
+		if secret.UID < 0 || secret.GID < 0 {
+			return fmt.Errorf("secret %s uid/gid invalid", secret.Name)
+		}
+		targets[secret.Target] = struct{}{}
+	}
+	return nil
+}
+
+// buildSecretMounts 获取secret写入容器的secret目录, 返回目录ID与只读挂载
+func (controller *ContainerController) buildSecretMounts(ctx context.Context, containerSecrets []*v1model.ContainerSecret) (string, []mount.Mount, error) {
+	if err := validateSecrets(containerSecrets); err != nil {
+		return "", nil, err
+	}
+
+	names := make([]string, 0, len(containerSecrets))
+	for _, secret := range containerSecrets {
+		names = append(names, secret.Name)
+	}
+
+	secretsId, err := secrets.NewId()
+	if err != nil {
+		return "", nil, err
+	}
+
+	secretValues, err := controller.BaseController().SecretValues(ctx, names)
+	if err != nil {
+		return "", nil, err
+	}
+
+	mounts, err := controller.writeSecrets(secretsId, containerSecrets, secretValues)
+	if err != nil {
+		controller.BaseController().Secrets().Remove(secretsId)
+		return "", nil, err
+	}
+	return secretsId, mounts, nil
+}
+
+// writeSecrets 写入secret文件并构建挂载, 主机重启后恢复secret时也使用
+func (controller *ContainerController) writeSecrets(secretsId string, containerSecrets []*v1model.ContainerSecret, secretValues map[string][]byte) ([]mount.Mount, error) {
+	mounts := make([]mount.Mount, 0, len(containerSecrets))
+	for _, secret := range containerSecrets {
+		data, ok := secretValues[secret.Name]
+		if !ok {
+			return nil, fmt.Errorf("secret %s not found", secret.Name)
+		}
+
+		filePath, err := controller.BaseController().Secrets().Write(secretsId, secret.Name, data, secret.UID, secret.GID)
+		if err != nil {
+			return nil, fmt.Errorf("write secret %s error, %w", secret.Name, err)
+		}
+
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   filePath,
+			Target:   secret.Target,
+			ReadOnly: true,
+		})
+	}
+	return mounts, nil
+}
+
+// RestoreSecrets 重新写入容器丢失的secret文件, tmpfs在主机重启后会被清空
+func (controller *ContainerController) RestoreSecrets(ctx context.Context, labels map[string]string) (bool, error) {
+	secretsId := labels[v1model.ContainerLabelSecretsId]
+	value := labels[v1model.ContainerLabelSecrets]
+	if secretsId == "" || value == "" {
+		return false, nil
+	}
+
+	containerSecrets := []*v1model.ContainerSecret{}
+	if err := json.Unmarshal([]byte(value), &containerSecrets); err != nil {
+		return false, err
+	}
+
+	names := []string{}
+	missing := []*v1model.ContainerSecret{}
+	for _, secret := range containerSecrets {
+		if !controller.BaseController().Secrets().Exists(secretsId, secret.Name) {
+			names = append(names, secret.Name)
+			missing = append(missing, secret)
+		}
+	}
+	if len(missing) == 0 {
+		return false, nil
+	}
+
+	secretValues, err := controller.BaseController().SecretValues(ctx, names)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = controller.writeSecrets(secretsId, missing, secretValues)
+	return true, err
+}
+
+// redactCreateRequest 输出请求时去掉凭据, secret只包含名称, 不需要处理
+func redactCreateRequest(request *v1model.CreateContainerRequest) *v1model.CreateContainerRequest {
+	redacted := *request
+	if redacted.RegistryAuth.RegistryPassword != "" {
+		redacted.RegistryAuth.RegistryPassword = strings.Repeat("*", 6)
+	}
+	return &redacted
+}
@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/probe"
+	"humpback-agent/pkg/utils"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+)
+
+var (
+	cpusetRegexp     = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+	sysctlRegexp     = regexp.MustCompile(`^[a-zA-Z0-9_]+(\.[a-zA-Z0-9_\-/]+)+$`)
+	stopSignalRegexp = regexp.MustCompile(`^(SIG)?[A-Z][A-Z0-9]*([+-]\d+)?$`)
+)
+
+// validateCreateRequest 在拉取镜像、创建网络与预留端口之前校验整个请求, 错误的请求不产生任何副作用
+func (controller *ContainerController) validateCreateRequest(request *v1model.CreateContainerRequest) *v1model.ObjectResult {
+	if request.ContainerMeta == nil {
+		return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, "container spec is empty")
+	}
+
+	if err := applyContainerSpec(request.ContainerMeta, &container.Config{}, &container.HostConfig{}); err != nil {
+		return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, err.Error())
+	}
+
+	if request.HealthCheck != nil {
+		if _, err := buildHealthcheck(request.HealthCheck); err != nil {
+			return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, err.Error())
+		}
+	}
+
+	if request.ConfigReload != nil {
+		if err := validateConfigReload(request.ConfigReload); err != nil {
+			return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, err.Error())
+		}
+	}
+
+	if request.ReadinessProbe != nil {
+		value, err := json.Marshal(request.ReadinessProbe)
+		if err != nil {
+			return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, err.Error())
+		}
+		if _, err = probe.ParseSpec(map[string]string{v1model.ContainerLabelReadiness: string(value)}); err != nil {
+			return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, err.Error())
+		}
+	}
+
+	if request.Network != nil {
+		if result := validateNetworkInfo(request.Network); result != nil {
+			return result
+		}
+	}
+
+	if len(request.Secrets) > 0 {
+		if err := validateSecrets(request.Secrets); err != nil {
+			return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, err.Error())
+		}
+		if err := controller.BaseController().Secrets().Available(); err != nil {
+			return v1model.ObjectInternalErrorResult(v1model.ContainerCreateErrorCode, err.Error())
+		}
+	}
+	return nil
+}
+
+// validateNetworkInfo 校验网络模式、附加网络与端口映射
+func validateNetworkInfo(networkInfo *v1model.NetworkInfo) *v1model.ObjectResult {
+	switch networkInfo.Mode {
+	case v1model.NetworkModeHost:
+		if len(networkInfo.Networks) > 0 {
+			return v1model.ObjectRequestErrorResult(v1model.NetworkAttachErrorCode, "host network mode can not attach other networks")
+		}
+	case v1model.NetworkModeCustom, v1model.NetworkModeBridge:
+		if err := validateAttachments(networkInfo.Networks); err != nil {
+			return v1model.ObjectRequestErrorResult(v1model.NetworkAttachErrorCode, err.Error())
+		}
+	}
+
+	for _, bindPort := range networkInfo.Ports {
+		if bindPort == nil {
+			return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, "port is empty")
+		}
+		if _, err := nat.NewPort("tcp", strconv.Itoa(int(bindPort.ContainerPort))); err != nil {
+			return v1model.ObjectRequestErrorResult(v1model.RequestArgsErrorCode, err.Error())
+		}
+	}
+	return nil
+}
+
+// applyContainerSpec 校验并将ContainerMeta中的运行参数映射到容器配置
+func applyContainerSpec(meta *v1model.ContainerMeta, containerConfig *container.Config, hostConfig *container.HostConfig) error {
+	if meta.Entrypoint != nil {
+		containerConfig.Entrypoint = []string(meta.Entrypoint)
+		if len(meta.Entrypoint) == 0 {
+			//显式设置为空时清除镜像中的ENTRYPOINT
+			containerConfig.Entrypoint = []string{""}
+		}
+	}
+
+	if meta.WorkingDir != "" {
+		if !path.IsAbs(meta.WorkingDir) {
+			return fmt.Errorf("working dir %s must be an absolute path", meta.WorkingDir)
+		}
+		containerConfig.WorkingDir = meta.WorkingDir
+	}
+
+	if meta.User != "" {
+		if strings.ContainsAny(meta.User, " \t") {
+			return fmt.Errorf("user %s invalid", meta.User)
+		}
+		containerConfig.User = meta.User
+	}
+
+	if meta.StopSignal != "" {
+		if !isValidStopSignal(meta.StopSignal) {
+			return fmt.Errorf("stop signal %s invalid", meta.StopSignal)
+		}
+		containerConfig.StopSignal = meta.StopSignal
+	}
+
+	if meta.StopTimeout != nil {
+		if *meta.StopTimeout < 0 {
+			return fmt.Errorf("stop timeout %d invalid", *meta.StopTimeout)
+		}
+		stopTimeout := *meta.StopTimeout
+		containerConfig.StopTimeout = &stopTimeout
+	}
+
+	if len(meta.Tmpfs) > 0 {
+		hostConfig.Tmpfs = make(map[string]string, len(meta.Tmpfs))
+		for target, options := range meta.Tmpfs {
+			if !path.IsAbs(target) {
+				return fmt.Errorf("tmpfs target %s must be an absolute path", target)
+			}
+			hostConfig.Tmpfs[target] = options
+		}
+	}
+
+	for _, ulimit := range meta.Ulimits {
+		if ulimit == nil {
+			continue
+		}
+		if ulimit.Name == "" || (ulimit.Hard >= 0 && ulimit.Soft > ulimit.Hard) {
+			return fmt.Errorf("ulimit %s invalid, soft %d hard %d", ulimit.Name, ulimit.Soft, ulimit.Hard)
+		}
+		hostConfig.Ulimits = append(hostConfig.Ulimits, &units.Ulimit{Name: ulimit.Name, Soft: ulimit.Soft, Hard: ulimit.Hard})
+	}
+
+	if len(meta.Sysctls) > 0 {
+		hostConfig.Sysctls = make(map[string]string, len(meta.Sysctls))
+		for key, value := range meta.Sysctls {
+			if !sysctlRegexp.MatchString(key) {
+				return fmt.Errorf("sysctl %s invalid", key)
+			}
+			hostConfig.Sysctls[key] = value
+		}
+	}
+
+	if meta.Runtime != nil {
+		hostConfig.Privileged = hostConfig.Privileged || meta.Runtime.Privileged
+		if meta.Runtime.Init {
+			init := true
+			hostConfig.Init = &init
+		}
+		hostConfig.Runtime = meta.Runtime.Runtime
+		if err := validateDevices(meta.Runtime.Devices); err != nil {
+			return err
+		}
+		hostConfig.Devices = utils.MapToDevices(meta.Runtime.Devices)
+	}
+
+	for _, extraHost := range meta.ExtraHosts {
+		hostname, ip, ok := strings.Cut(extraHost, ":")
+		if !ok || hostname == "" || (ip != "host-gateway" && net.ParseIP(ip) == nil) {
+			return fmt.Errorf("extra host %s invalid, expected hostname:ip", extraHost)
+		}
+	}
+	hostConfig.ExtraHosts = meta.ExtraHosts
+
+	for _, dns := range meta.DNS {
+		if net.ParseIP(dns) == nil {
+			return fmt.Errorf("dns %s invalid", dns)
+		}
+	}
+	hostConfig.DNS = meta.DNS
+	hostConfig.DNSSearch = meta.DNSSearch
+	hostConfig.DNSOptions = meta.DNSOptions
+
+	hostConfig.ReadonlyRootfs = meta.ReadonlyRootfs
+	for _, securityOpt := range meta.SecurityOpt {
+		if securityOpt != "no-new-privileges" && !strings.ContainsAny(securityOpt, "=:") {
+			return fmt.Errorf("security opt %s invalid", securityOpt)
+		}
+	}
+	hostConfig.SecurityOpt = meta.SecurityOpt
+
+	if meta.Resources != nil {
+		if meta.Resources.ShmSize > 0 {
+			hostConfig.ShmSize = int64(meta.Resources.ShmSize * 1024 * 1024)
+		}
+		if meta.Resources.PidsLimit != 0 {
+			if meta.Resources.PidsLimit < -1 {
+				return fmt.Errorf("pids limit %d invalid", meta.Resources.PidsLimit)
+			}
+			pidsLimit := meta.Resources.PidsLimit
+			hostConfig.Resources.PidsLimit = &pidsLimit
+		}
+		for _, cpuset := range []string{meta.Resources.CpusetCpus, meta.Resources.CpusetMems} {
+			if cpuset != "" && !cpusetRegexp.MatchString(cpuset) {
+				return fmt.Errorf("cpuset %s invalid", cpuset)
+			}
+		}
+		hostConfig.Resources.CpusetCpus = meta.Resources.CpusetCpus
+		hostConfig.Resources.CpusetMems = meta.Resources.CpusetMems
+	}
+	return nil
+}
+
+func validateDevices(devices []string) error {
+	for _, device := range devices {
+		for _, mapping := range utils.MapToDevices([]string{device}) {
+			if !path.IsAbs(mapping.PathOnHost) || !path.IsAbs(mapping.PathInContainer) {
+				return fmt.Errorf("device %s invalid, paths must be absolute", device)
+			}
+			if mapping.CgroupPermissions == "" || strings.Trim(mapping.CgroupPermissions, "rwm") != "" {
+				return fmt.Errorf("device %s permissions invalid", device)
+			}
+		}
+	}
+	return nil
+}
+
+func isValidStopSignal(signal string) bool {
+	if number, err := strconv.Atoi(signal); err == nil {
+		return number > 0 && number <= 64
+	}
+	return stopSignalRegexp.MatchString(strings.ToUpper(signal))
+}
@@ -4,19 +4,22 @@ import (
 	"context"
 	"fmt"
 	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/configvol"
+	"humpback-agent/internal/credstore"
+	"humpback-agent/internal/imagepull"
+	"humpback-agent/internal/portalloc"
+	"humpback-agent/internal/regcred"
+	"humpback-agent/internal/secrets"
+	"humpback-agent/internal/stats"
+	"humpback-agent/internal/tracker"
 	"humpback-agent/model"
 	"humpback-agent/pkg/utils"
-	"net"
+	"os"
 	"path/filepath"
 	"regexp"
 	"time"
 
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/libnetwork/portallocator"
-	"github.com/google/uuid"
-	"github.com/sirupsen/logrus"
-
-	"math/rand/v2"
 )
 
 // 编译正则表达式
@@ -24,14 +27,27 @@ var re = regexp.MustCompile(`\{([^}]+)\}`)
 
 type GetConfigValueFunc func(configNames []string) (map[string][]byte, error)
 
+type GetSecretValueFunc func(secretNames []string) (map[string][]byte, error)
+
 type InternalController interface {
 	WithTimeout(ctx context.Context, callback func(context.Context) error) error
 	DockerEngine(ctx context.Context) (*model.DockerEngineInfo, error)
+	DockerPing(ctx context.Context) error
 	GetConfigNamesWithVolumes(volumes []*v1model.ServiceVolume) map[string]string
-	BuildVolumesWithConfigNames(configNames map[string]string) (map[string]string, error)
+	BuildVolumesWithConfigNames(configNames map[string]string, templates map[string]bool, templateContext *configvol.TemplateContext) (map[string]string, map[string]string, error)
+	HostInfo() *model.HostInfo
 	ConfigValues(ctx context.Context, configNames []string) (map[string][]byte, error)
-	AllocPort(proto string) (int, error)
+	SecretValues(ctx context.Context, secretNames []string) (map[string][]byte, error)
+	PortAllocator() *portalloc.Allocator
+	ConfigVolumes() *configvol.Manager
+	Secrets() *secrets.Store
+	Credentials() *credstore.Store
+	Registries() *regcred.Manager
+	Puller() *imagepull.Puller
 	FailureChan() chan model.ContainerMeta
+	Tracker() *tracker.Tracker
+	StatsSampler() *stats.Sampler
+	StatsHub() *stats.Hub
 }
 
 type ControllerInterface interface {
@@ -39,6 +55,8 @@ type ControllerInterface interface {
 	Image() ImageControllerInterface
 	Container() ContainerControllerInterface
 	Network() NetworkControllerInterface
+	Service() ServiceControllerInterface
+	Config() ConfigControllerInterface
 }
 
 type BaseController struct {
@@ -46,24 +64,50 @@ type BaseController struct {
 	volumesRootDirectory string
 	reqTimeout           time.Duration
 	getConfigFunc        GetConfigValueFunc
+	getSecretFunc        GetSecretValueFunc
 	image                ImageControllerInterface
 	container            ContainerControllerInterface
 	network              NetworkControllerInterface
+	service              ServiceControllerInterface
+	config               ConfigControllerInterface
 	failureChan          chan model.ContainerMeta
+	tracker              *tracker.Tracker
+	statsSampler         *stats.Sampler
+	statsHub             *stats.Hub
+	portAllocator        *portalloc.Allocator
+	configVolumes        *configvol.Manager
+	hostInfoFunc         func() *model.HostInfo
+	secrets              *secrets.Store
+	credentials          *credstore.Store
+	registries           *regcred.Manager
+	puller               *imagepull.Puller
 }
 
-func NewController(client *client.Client, getConfigFunc GetConfigValueFunc, volumesRootDirectory string, reqTimeout time.Duration, failureChan chan model.ContainerMeta) ControllerInterface {
+func NewController(client *client.Client, getConfigFunc GetConfigValueFunc, getSecretFunc GetSecretValueFunc, volumesRootDirectory string, reqTimeout time.Duration, failureChan chan model.ContainerMeta, tracker *tracker.Tracker, statsSampler *stats.Sampler, statsHub *stats.Hub, portAllocator *portalloc.Allocator, configVolumes *configvol.Manager, hostInfoFunc func() *model.HostInfo, secretStore *secrets.Store, credentialStore *credstore.Store, registries *regcred.Manager, puller *imagepull.Puller) ControllerInterface {
 	baseController := &BaseController{
 		client:               client,
 		volumesRootDirectory: volumesRootDirectory,
 		reqTimeout:           reqTimeout,
 		getConfigFunc:        getConfigFunc,
+		getSecretFunc:        getSecretFunc,
 		failureChan:          failureChan,
+		tracker:              tracker,
+		statsSampler:         statsSampler,
+		statsHub:             statsHub,
+		portAllocator:        portAllocator,
+		configVolumes:        configVolumes,
+		hostInfoFunc:         hostInfoFunc,
+		secrets:              secretStore,
+		credentials:          credentialStore,
+		registries:           registries,
+		puller:               puller,
 	}
 
 	baseController.image = NewImageController(baseController, client)
 	baseController.container = NewContainerController(baseController, client)
 	baseController.network = NewNetworkController(baseController, client)
+	baseController.service = NewServiceController(baseController, client)
+	baseController.config = NewConfigController(baseController, client)
 	return baseController
 }
 
@@ -85,6 +129,7 @@ func (controller *BaseController) DockerEngine(ctx context.Context) (*model.Dock
 		return nil, infoErr
 	}
 
+	engineInfo.State = model.DockerEngineStateAvailable
 	engineInfo.Version = dockerInfo.ServerVersion
 	engineInfo.APIVersion = serverVersion.APIVersion
 	engineInfo.RootDirectory = dockerInfo.DockerRootDir
@@ -95,6 +140,13 @@ func (controller *BaseController) DockerEngine(ctx context.Context) (*model.Dock
 	return &engineInfo, nil
 }
 
+func (controller *BaseController) DockerPing(ctx context.Context) error {
+	return controller.WithTimeout(ctx, func(ctx context.Context) error {
+		_, err := controller.client.Ping(ctx)
+		return err
+	})
+}
+
 func (controller *BaseController) GetConfigNamesWithVolumes(volumes []*v1model.ServiceVolume) map[string]string {
 	configPair := map[string]string{}
 	for _, volume := range volumes {
@@ -117,71 +169,62 @@ func (controller *BaseController) ConfigValues(ctx context.Context, configNames
 	return nil, fmt.Errorf("no setting config value getter")
 }
 
-func (controller *BaseController) AllocPort(proto string) (int, error) {
-	if proto == "" {
-		proto = "tcp"
-	}
-	pa := portallocator.Get()
-	begin := pa.Begin
-	end := pa.End
-	retry := 0
-	maxRetry := 5
-	port := 0
-	isFree := false
-
-	for !isFree && retry < maxRetry {
-		port = rand.IntN(end-begin) + begin
-		isFree = isPortFree(port)
-		retry++
+func (controller *BaseController) SecretValues(ctx context.Context, secretNames []string) (map[string][]byte, error) {
+	if controller.getSecretFunc != nil {
+		return controller.getSecretFunc(secretNames)
 	}
-
-	if !isFree {
-		return 0, fmt.Errorf("no free port found in %d-%d", begin, end)
-	}
-
-	logrus.Infof("Alloc port %d for %s", port, proto)
-	return port, nil
-
+	return nil, fmt.Errorf("no setting secret value getter")
 }
 
-func isPortFree(port int) bool {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return false
-	}
-	listener.Close()
-	return true
-}
-
-func (controller *BaseController) BuildVolumesWithConfigNames(configNames map[string]string) (map[string]string, error) {
+// BuildVolumesWithConfigNames 写入配置文件卷, templates中的配置先按模板渲染, 返回配置对应的文件路径以及使用的卷
+func (controller *BaseController) BuildVolumesWithConfigNames(configNames map[string]string, templates map[string]bool, templateContext *configvol.TemplateContext) (map[string]string, map[string]string, error) {
 	configPaths := map[string]string{}
+	volumes := map[string]string{}
 	if len(configNames) > 0 {
 		names := []string{}
-		for name, _ := range configNames {
+		for name := range configNames {
 			names = append(names, name)
 		}
 
 		configValues, err := controller.ConfigValues(context.Background(), names)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		var vid uuid.UUID
 		for configName, data := range configValues {
-			vid, err = uuid.NewUUID()
-			if err != nil {
-				return nil, err
-			}
 			if fileName, ret := configNames[configName]; ret {
-				filePath := fmt.Sprintf("%s/%s/_data/%s", controller.volumesRootDirectory, vid.String(), fileName)
-				if err = utils.WriteFileWithDir(filePath, []byte(data), 0755); err != nil {
-					return nil, err
+				if templates[configName] {
+					if data, err = configvol.Render(configName, data, templateContext); err != nil {
+						controller.configVolumes.Done(volumes)
+						return nil, nil, err
+					}
+				}
+				filePath, volume, err := controller.configVolumes.Prepare(configName, fileName, data)
+				if err != nil {
+					controller.configVolumes.Done(volumes)
+					return nil, nil, err
 				}
 				configPaths[configName] = filePath
+				volumes[configName] = volume
 			}
 		}
 	}
-	return configPaths, nil
+	return configPaths, volumes, nil
+}
+
+// HostInfo 最近一次心跳采集的主机信息, 尚未采集时只包含主机名与IP
+func (controller *BaseController) HostInfo() *model.HostInfo {
+	if controller.hostInfoFunc != nil {
+		if hostInfo := controller.hostInfoFunc(); hostInfo != nil {
+			return hostInfo
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	return &model.HostInfo{
+		Hostname: hostname,
+		HostIPs:  utils.HostIPs(),
+	}
 }
 
 func (controller *BaseController) Image() ImageControllerInterface {
@@ -196,6 +239,50 @@ func (controller *BaseController) Network() NetworkControllerInterface {
 	return controller.network
 }
 
+func (controller *BaseController) Service() ServiceControllerInterface {
+	return controller.service
+}
+
+func (controller *BaseController) Config() ConfigControllerInterface {
+	return controller.config
+}
+
 func (controller *BaseController) FailureChan() chan model.ContainerMeta {
 	return controller.failureChan
 }
+
+func (controller *BaseController) Tracker() *tracker.Tracker {
+	return controller.tracker
+}
+
+func (controller *BaseController) StatsSampler() *stats.Sampler {
+	return controller.statsSampler
+}
+
+func (controller *BaseController) StatsHub() *stats.Hub {
+	return controller.statsHub
+}
+
+func (controller *BaseController) PortAllocator() *portalloc.Allocator {
+	return controller.portAllocator
+}
+
+func (controller *BaseController) ConfigVolumes() *configvol.Manager {
+	return controller.configVolumes
+}
+
+func (controller *BaseController) Secrets() *secrets.Store {
+	return controller.secrets
+}
+
+func (controller *BaseController) Credentials() *credstore.Store {
+	return controller.credentials
+}
+
+func (controller *BaseController) Registries() *regcred.Manager {
+	return controller.registries
+}
+
+func (controller *BaseController) Puller() *imagepull.Puller {
+	return controller.puller
+}
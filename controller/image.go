@@ -43,6 +43,7 @@ func (controller *ImageController) BaseController() ControllerInterface {
 }
 
 func (controller *ImageController) AttemptPull(ctx context.Context, imageId string, alwaysPull bool, auth v1model.RegistryAuth) *v1model.ObjectResult {
+	imageId = controller.BaseController().Registries().Qualify(imageId)
 	pullImage := alwaysPull
 	if !pullImage {
 		imageResult := controller.BaseController().Image().Get(ctx, &v1model.GetImageRequest{ImageId: imageId})
@@ -83,41 +84,20 @@ func (controller *ImageController) Push(ctx context.Context, request *v1model.Pu
 }
 
 func (controller *ImageController) Pull(ctx context.Context, request *v1model.PullImageRequest) *v1model.ObjectResult {
+	request.Image = controller.BaseController().Registries().Qualify(request.Image)
 
-	authStr := ""
-	if request.UserName != "" && request.Password != "" {
-
-		authConfig := registry.AuthConfig{
-			Username:      request.UserName,
-			Password:      request.Password,
-			ServerAddress: request.ServerAddress,
-		}
-
-		authBytes, _ := json.Marshal(authConfig)
-		authStr = base64.URLEncoding.EncodeToString(authBytes)
-	}
-
+	//请求未携带凭据时按镜像仓库地址匹配本地凭据
 	pullOptions := image.PullOptions{
 		All:          request.All,
 		Platform:     request.Platform,
-		RegistryAuth: authStr,
+		RegistryAuth: encodeRegistryAuth(request.ServerAddress, request.UserName, request.Password),
 	}
 
-	out, err := controller.client.ImagePull(context.Background(), request.Image, pullOptions)
-	if err != nil {
+	//原仓库不可用时按配置回退到镜像源
+	if err := controller.BaseController().Puller().Pull(ctx, request.Image, pullOptions); err != nil {
 		return v1model.ObjectNotFoundErrorResult(v1model.ImagePullErrorCode, err.Error())
 	}
 
-	defer out.Close()
-
-	// wait pull image
-	for {
-		_, err := out.Read(make([]byte, 1024))
-		if err != nil {
-			break
-		}
-	}
-
 	imageInfo, _, err := controller.client.ImageInspectWithRaw(ctx, request.Image)
 	if err != nil {
 		return v1model.ObjectInternalErrorResult(v1model.ImagePullErrorCode, err.Error())
@@ -128,3 +108,17 @@ func (controller *ImageController) Pull(ctx context.Context, request *v1model.Pu
 func (controller *ImageController) Delete(ctx context.Context, request *v1model.DeleteImageRequest) *v1model.ObjectResult {
 	return nil
 }
+
+// encodeRegistryAuth 请求携带的凭据编码为docker API的X-Registry-Auth, 未携带时返回空
+func encodeRegistryAuth(serverAddress string, username string, password string) string {
+	if username == "" || password == "" {
+		return ""
+	}
+
+	authBytes, _ := json.Marshal(registry.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: serverAddress,
+	})
+	return base64.URLEncoding.EncodeToString(authBytes)
+}
@@ -2,7 +2,10 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	v1model "humpback-agent/api/v1/model"
+	"net"
 
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
@@ -48,6 +51,10 @@ func (controller *NetworkController) Get(ctx context.Context, request *v1model.G
 }
 
 func (controller *NetworkController) Create(ctx context.Context, request *v1model.CreateNetworkRequest) *v1model.ObjectResult {
+	if err := validateSubnets(request.Subnets); err != nil {
+		return v1model.ObjectRequestErrorResult(v1model.NetworkCreateErrorCode, err.Error())
+	}
+
 	ret := controller.Get(ctx, &v1model.GetNetworkRequest{NetworkId: request.NetworkName})
 	if ret.Error != nil {
 		if ret.Error.Code != v1model.NetworkNotFoundCode {
@@ -56,16 +63,38 @@ func (controller *NetworkController) Create(ctx context.Context, request *v1mode
 	}
 
 	if ret.Error == nil {
-		return v1model.ResultWithObjectId(ret.Object.(network.Inspect).ID)
+		networkBody := ret.Object.(network.Inspect)
+		if err := checkNetworkSubnets(networkBody, request.Subnets); err != nil {
+			return v1model.ObjectRequestErrorResult(v1model.NetworkCreateErrorCode, err.Error())
+		}
+		return v1model.ResultWithObjectId(networkBody.ID)
+	}
+
+	createOptions := network.CreateOptions{
+		Driver:   request.Driver,
+		Scope:    request.Scope,
+		Internal: request.Internal,
+		Options:  request.Options,
+	}
+	if request.EnableIPv6 {
+		enableIPv6 := true
+		createOptions.EnableIPv6 = &enableIPv6
+	}
+	if len(request.Subnets) > 0 {
+		createOptions.IPAM = &network.IPAM{}
+		for _, subnet := range request.Subnets {
+			createOptions.IPAM.Config = append(createOptions.IPAM.Config, network.IPAMConfig{
+				Subnet:  subnet.Subnet,
+				Gateway: subnet.Gateway,
+				IPRange: subnet.IPRange,
+			})
+		}
 	}
 
 	var networkInfo network.CreateResponse
 	if err := controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
 		var createdErr error
-		networkInfo, createdErr = controller.client.NetworkCreate(ctx, request.NetworkName, network.CreateOptions{
-			Driver: request.Driver,
-			Scope:  request.Scope,
-		})
+		networkInfo, createdErr = controller.client.NetworkCreate(ctx, request.NetworkName, createOptions)
 		return createdErr
 	}); err != nil {
 		return v1model.ObjectInternalErrorResult(v1model.NetworkCreateErrorCode, err.Error())
@@ -87,3 +116,36 @@ func (controller *NetworkController) Delete(ctx context.Context, request *v1mode
 	}
 	return v1model.ResultWithObjectId(networkId)
 }
+
+// validateSubnets 子网不能为空且必须是合法的CIDR
+func validateSubnets(subnets []*v1model.NetworkSubnet) error {
+	for _, subnet := range subnets {
+		if subnet == nil {
+			return errors.New("network subnet is empty")
+		}
+		if _, _, err := net.ParseCIDR(subnet.Subnet); err != nil {
+			return fmt.Errorf("subnet %s invalid", subnet.Subnet)
+		}
+	}
+	return nil
+}
+
+// checkNetworkSubnets 已存在的网络必须包含请求的子网
+func checkNetworkSubnets(networkBody network.Inspect, subnets []*v1model.NetworkSubnet) error {
+	for _, subnet := range subnets {
+		if subnet == nil {
+			continue
+		}
+		found := false
+		for _, ipamConfig := range networkBody.IPAM.Config {
+			if ipamConfig.Subnet == subnet.Subnet {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("network %s already exists without subnet %s", networkBody.Name, subnet.Subnet)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/tracker"
+	"humpback-agent/model"
+	"humpback-agent/pkg/utils"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// 批量操作同时执行的容器数量上限
+	maxServiceActionConcurrency = 4
+)
+
+type ServiceControllerInterface interface {
+	BaseController() ControllerInterface
+	List(ctx context.Context) *v1model.ObjectResult
+	Get(ctx context.Context, request *v1model.GetServiceRequest) *v1model.ObjectResult
+	Group(ctx context.Context, request *v1model.GetGroupRequest) *v1model.ObjectResult
+	Action(ctx context.Context, request *v1model.ServiceActionRequest) *v1model.ObjectResult
+}
+
+// ServiceController 按Humpback-ServiceId/Humpback-GroupId标签聚合本节点容器
+type ServiceController struct {
+	baseController ControllerInterface
+	client         *client.Client
+}
+
+func NewServiceController(baseController ControllerInterface, client *client.Client) ServiceControllerInterface {
+	return &ServiceController{
+		baseController: baseController,
+		client:         client,
+	}
+}
+
+func (controller *ServiceController) BaseController() ControllerInterface {
+	return controller.baseController
+}
+
+func (controller *ServiceController) List(ctx context.Context) *v1model.ObjectResult {
+	services, err := controller.services(ctx, v1model.ContainerLabelServiceId)
+	if err != nil {
+		return v1model.ObjectInternalErrorResult(v1model.ServiceGetErrorCode, err.Error())
+	}
+	return v1model.ResultWithObject(services)
+}
+
+func (controller *ServiceController) Get(ctx context.Context, request *v1model.GetServiceRequest) *v1model.ObjectResult {
+	services, err := controller.services(ctx, fmt.Sprintf("%s=%s", v1model.ContainerLabelServiceId, request.ServiceId))
+	if err != nil {
+		return v1model.ObjectInternalErrorResult(v1model.ServiceGetErrorCode, err.Error())
+	}
+
+	if len(services) == 0 {
+		return v1model.ObjectNotFoundErrorResult(v1model.ServiceNotFoundCode, fmt.Sprintf("service %s has no container on this node", request.ServiceId))
+	}
+	return v1model.ResultWithObject(services[0])
+}
+
+func (controller *ServiceController) Group(ctx context.Context, request *v1model.GetGroupRequest) *v1model.ObjectResult {
+	services, err := controller.services(ctx, fmt.Sprintf("%s=%s", v1model.ContainerLabelGroupId, request.GroupId))
+	if err != nil {
+		return v1model.ObjectInternalErrorResult(v1model.ServiceGetErrorCode, err.Error())
+	}
+
+	if len(services) == 0 {
+		return v1model.ObjectNotFoundErrorResult(v1model.ServiceNotFoundCode, fmt.Sprintf("group %s has no container on this node", request.GroupId))
+	}
+
+	group := &model.GroupInfo{GroupId: request.GroupId, Services: services}
+	for _, service := range services {
+		group.Usage.Merge(service.Usage)
+	}
+	group.Usage.CPUPercent = math.Round(group.Usage.CPUPercent*100) / 100
+	return v1model.ResultWithObject(group)
+}
+
+// Action 对服务的所有容器执行start/stop/restart/delete, 逐个返回结果, 单个容器失败不影响其他容器
+func (controller *ServiceController) Action(ctx context.Context, request *v1model.ServiceActionRequest) *v1model.ObjectResult {
+	var containers []types.Container
+	if err := controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
+		var err error
+		containers, err = controller.listContainers(ctx, fmt.Sprintf("%s=%s", v1model.ContainerLabelServiceId, request.ServiceId))
+		return err
+	}); err != nil {
+		return v1model.ObjectInternalErrorResult(v1model.ServiceActionErrCode, err.Error())
+	}
+
+	if len(containers) == 0 {
+		return v1model.ObjectNotFoundErrorResult(v1model.ServiceNotFoundCode, fmt.Sprintf("service %s has no container on this node", request.ServiceId))
+	}
+
+	if controller.baseController.Tracker().Closed() {
+		return v1model.ObjectServiceUnavailableErrorResult(v1model.ServerShuttingDownCode, v1model.ServerShuttingDownMsg)
+	}
+
+	result := &model.ServiceActionResult{
+		ServiceId: request.ServiceId,
+		Action:    request.Action,
+		Results:   make([]*model.ContainerActionResult, len(containers)),
+	}
+
+	var (
+		wg      sync.WaitGroup
+		limiter = make(chan struct{}, maxServiceActionConcurrency)
+	)
+	for i, item := range containers {
+		actionResult := &model.ContainerActionResult{ContainerId: item.ID}
+		if len(item.Names) > 0 {
+			actionResult.ContainerName = utils.ContainerName(item.Names[0])
+		}
+		result.Results[i] = actionResult
+
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func() {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			if err := controller.containerAction(ctx, request, item.ID, actionResult.ContainerName); err != nil {
+				actionResult.ErrorMsg = err.Error()
+				return
+			}
+			actionResult.Succeeded = true
+		}()
+	}
+	wg.Wait()
+	return v1model.ResultWithObject(result)
+}
+
+func (controller *ServiceController) containerAction(ctx context.Context, request *v1model.ServiceActionRequest, containerId string, containerName string) error {
+	var (
+		kind   string
+		action func(ctx context.Context) *v1model.ObjectResult
+	)
+	containerController := controller.baseController.Container()
+	switch request.Action {
+	case v1model.ServiceActionStart:
+		kind = tracker.OperationContainerStart
+		action = func(ctx context.Context) *v1model.ObjectResult {
+			return containerController.Start(ctx, &v1model.StartContainerRequest{ContainerId: containerId})
+		}
+	case v1model.ServiceActionStop:
+		kind = tracker.OperationContainerStop
+		action = func(ctx context.Context) *v1model.ObjectResult {
+			return containerController.Stop(ctx, &v1model.StopContainerRequest{ContainerId: containerId})
+		}
+	case v1model.ServiceActionRestart:
+		kind = tracker.OperationContainerRestart
+		action = func(ctx context.Context) *v1model.ObjectResult {
+			return containerController.Restart(ctx, &v1model.RestartContainerRequest{ContainerId: containerId})
+		}
+	case v1model.ServiceActionDelete:
+		kind = tracker.OperationContainerDelete
+		action = func(ctx context.Context) *v1model.ObjectResult {
+			//与单个容器删除一致, 清除该容器记录的失败状态
+			controller.baseController.FailureChan() <- model.ContainerMeta{
+				ContainerName: containerName,
+				IsDelete:      true,
+			}
+			return containerController.Delete(ctx, &v1model.DeleteContainerRequest{ContainerId: containerId, Force: request.Force})
+		}
+	default:
+		return fmt.Errorf("unsupported service action %s", request.Action)
+	}
+
+	trackCtx, done, err := controller.baseController.Tracker().Track(kind, containerId)
+	if err != nil {
+		return err
+	}
+
+	defer done()
+	//请求断开时仍完成已开始的操作, 关闭时由tracker取消
+	actionCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stop := context.AfterFunc(trackCtx, cancel)
+	defer stop()
+	if result := action(actionCtx); result.Error != nil {
+		return fmt.Errorf("%s", result.Error.ErrMsg)
+	}
+	return nil
+}
+
+// services 按标签过滤本节点容器(包括已停止的), 按服务分组并附带最近一次stats采样
+func (controller *ServiceController) services(ctx context.Context, label string) ([]*model.ServiceInfo, error) {
+	var containers []types.Container
+	if err := controller.baseController.WithTimeout(ctx, func(ctx context.Context) error {
+		var err error
+		containers, err = controller.listContainers(ctx, label)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	sampler := controller.baseController.StatsSampler()
+	serviceMap := make(map[string]*model.ServiceInfo)
+	for _, item := range containers {
+		serviceId := item.Labels[v1model.ContainerLabelServiceId]
+		service, ok := serviceMap[serviceId]
+		if !ok {
+			service = &model.ServiceInfo{
+				ServiceId:   serviceId,
+				ServiceName: item.Labels[v1model.ContainerLabelServiceName],
+				GroupId:     item.Labels[v1model.ContainerLabelGroupId],
+				Containers:  []*model.ServiceContainer{},
+			}
+			serviceMap[serviceId] = service
+		}
+
+		serviceContainer := &model.ServiceContainer{
+			ContainerId: item.ID,
+			State:       item.State,
+			Status:      item.Status,
+			Image:       item.Image,
+			Created:     item.Created * 1000,
+		}
+		if len(item.Names) > 0 {
+			serviceContainer.ContainerName = utils.ContainerName(item.Names[0])
+		}
+		if sample := sampler.Latest(item.ID); sample != nil {
+			serviceContainer.Stats = sample.Stats
+		}
+		service.Containers = append(service.Containers, serviceContainer)
+		service.Usage.Add(serviceContainer)
+	}
+
+	services := make([]*model.ServiceInfo, 0, len(serviceMap))
+	for _, service := range serviceMap {
+		service.Usage.CPUPercent = math.Round(service.Usage.CPUPercent*100) / 100
+		sort.Slice(service.Containers, func(i, j int) bool {
+			return service.Containers[i].ContainerName < service.Containers[j].ContainerName
+		})
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].ServiceId < services[j].ServiceId
+	})
+	return services, nil
+}
+
+func (controller *ServiceController) listContainers(ctx context.Context, label string) ([]types.Container, error) {
+	return controller.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
+}
@@ -3,11 +3,14 @@ package client
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 )
 
+var ErrUnauthorized = errors.New("response status unauthorized")
+
 func GetRequest(client *http.Client, url string, token string) ([]byte, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -24,6 +27,10 @@ func GetRequest(client *http.Client, url string, token string) ([]byte, error) {
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorized
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("response status error %d", resp.StatusCode)
 	}
@@ -31,15 +38,25 @@ func GetRequest(client *http.Client, url string, token string) ([]byte, error) {
 }
 
 func PostRequest(client *http.Client, url string, payload any, token string) (string, error) {
+	var regResp struct {
+		Token string `json:"token"`
+	}
+	if err := PostRequestWithResult(client, url, payload, token, &regResp); err != nil {
+		return "", err
+	}
+	return regResp.Token, nil
+}
+
+// PostRequestWithResult 发送POST请求并将响应解析到result
+func PostRequestWithResult(client *http.Client, url string, payload any, token string, result any) error {
 	data, err := json.Marshal(payload)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	// fmt.Println(string(data))
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -48,21 +65,21 @@ func PostRequest(client *http.Client, url string, payload any, token string) (st
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("response status error %d", resp.StatusCode)
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
 	}
 
-	var regResp struct {
-		Token string `json:"token"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&regResp); err != nil {
-		return "", fmt.Errorf("failed to parse registration response: %w", err)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("response status error %d", resp.StatusCode)
 	}
 
-	return regResp.Token, nil
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
 }
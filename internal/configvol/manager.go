@@ -0,0 +1,332 @@
+package configvol
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/pkg/utils"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	dataDirName = "_data"
+	hashLength  = 16
+)
+
+var (
+	unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+	//VolumeName生成的卷名, 刷新后可能带序号
+	volumeNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]*-[0-9a-f]{16}(-[0-9]+)?$`)
+	//旧版本以UUID命名的配置卷
+	legacyVolumeRegexp = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// Manager 管理配置文件卷, 卷目录按配置名与内容hash确定, 相同配置的容器复用同一目录,
+// 容器通过Humpback-ConfigVolumes标签记录使用的卷, 不再被任何容器使用的卷会被删除
+type Manager struct {
+	sync.Mutex
+	rootDirectory string
+	pending       map[string]int //已写入但容器尚未创建完成的卷
+}
+
+func NewManager(rootDirectory string) *Manager {
+	return &Manager{
+		rootDirectory: rootDirectory,
+		pending:       make(map[string]int),
+	}
+}
+
+// VolumeName 配置对应的卷目录名
+func VolumeName(configName string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s-%s", unsafeNameChars.ReplaceAllString(configName, "_"), hex.EncodeToString(sum[:])[:hashLength])
+}
+
+// Prepare 写入配置文件并返回文件路径与卷名, 调用方在容器创建结束后调用Done.
+// 卷内容被刷新后与卷名中的hash不再一致, 此时依次尝试带序号的卷名, 不覆盖正在使用的刷新内容
+func (manager *Manager) Prepare(configName string, fileName string, data []byte) (string, string, error) {
+	manager.Lock()
+	defer manager.Unlock()
+	baseName := VolumeName(configName, data)
+	volume := baseName
+	for i := 1; !manager.matches(volume, data); i++ {
+		volume = fmt.Sprintf("%s-%d", baseName, i)
+	}
+
+	filePath := filepath.Join(manager.rootDirectory, volume, dataDirName, fileName)
+	manager.pending[volume]++
+	if current, err := os.ReadFile(filePath); err == nil && bytes.Equal(current, data) {
+		return filePath, volume, nil
+	}
+
+	tmpFile := filePath + ".tmp"
+	if err := utils.WriteFileWithDir(tmpFile, data, 0644); err != nil {
+		manager.done(volume)
+		return "", "", err
+	}
+	if err := os.Rename(tmpFile, filePath); err != nil {
+		os.Remove(tmpFile)
+		manager.done(volume)
+		return "", "", err
+	}
+	return filePath, volume, nil
+}
+
+// matches 卷不存在或卷内文件内容都与data一致
+func (manager *Manager) matches(volume string, data []byte) bool {
+	dataDirectory := filepath.Join(manager.rootDirectory, volume, dataDirName)
+	entries, err := os.ReadDir(dataDirectory)
+	if err != nil {
+		return errors.Is(err, os.ErrNotExist)
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		current, err := os.ReadFile(filepath.Join(dataDirectory, entry.Name()))
+		if err != nil || !bytes.Equal(current, data) {
+			return false
+		}
+	}
+	return true
+}
+
+// Rewrite 刷新卷内的配置文件, 返回内容是否变化.
+// 单文件bind mount绑定的是inode, rename替换的新文件在容器内不可见, 因此只能原地改写, 见rewriteFile
+func (manager *Manager) Rewrite(volume string, data []byte) (bool, error) {
+	manager.Lock()
+	defer manager.Unlock()
+	if volume == "" || strings.ContainsRune(volume, filepath.Separator) || volume == "." || volume == ".." {
+		return false, fmt.Errorf("config volume %s invalid", volume)
+	}
+
+	dataDirectory := filepath.Join(manager.rootDirectory, volume, dataDirName)
+	entries, err := os.ReadDir(dataDirectory)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		filePath := filepath.Join(dataDirectory, entry.Name())
+		if current, err := os.ReadFile(filePath); err == nil && bytes.Equal(current, data) {
+			continue
+		}
+		if err = rewriteFile(filePath, data); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// rewriteFile 先从头覆盖写入新内容再截断到新长度, 容器内进程不会读到空文件.
+// 该过程不是原子的: 写入期间读取方仍可能读到新旧内容混合, 新内容较短时截断前尾部残留旧内容,
+// 刷新接口与README中已说明, 容器应在ConfigReload触发后再读取完整内容
+func rewriteFile(filePath string, data []byte) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.WriteAt(data, 0); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Truncate(int64(len(data))); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Done 容器创建结束, 卷不再受创建过程保护
+func (manager *Manager) Done(volumes map[string]string) {
+	manager.Lock()
+	defer manager.Unlock()
+	for _, volume := range volumes {
+		manager.done(volume)
+	}
+}
+
+func (manager *Manager) done(volume string) {
+	if manager.pending[volume] <= 1 {
+		delete(manager.pending, volume)
+		return
+	}
+	manager.pending[volume]--
+}
+
+// InUseFunc 返回当前被容器使用的卷, 在持有管理器锁时调用, 不能再调用Manager中加锁的方法
+type InUseFunc func() (map[string]struct{}, error)
+
+// Remove 删除不再被使用的卷.
+// 使用中的卷在持有锁时计算: 并发的容器创建要么仍在pending中, 要么已完成创建并出现在容器列表中
+func (manager *Manager) Remove(volumes map[string]string, inUseFunc InUseFunc) error {
+	manager.Lock()
+	defer manager.Unlock()
+	inUse, err := inUseFunc()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, volume := range volumes {
+		if !manager.removable(volume, inUse) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(manager.rootDirectory, volume)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Collect 清理卷根目录下没有容器使用的配置卷, 返回删除的卷.
+// 卷根目录可能与docker的卷目录相同, 只处理本管理器命名的目录, 不删除docker自己的命名卷
+func (manager *Manager) Collect(inUseFunc InUseFunc) ([]string, error) {
+	manager.Lock()
+	defer manager.Unlock()
+	entries, err := os.ReadDir(manager.rootDirectory)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	inUse, err := inUseFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	var errs []error
+	for _, entry := range entries {
+		volume := entry.Name()
+		if !entry.IsDir() || !manager.removable(volume, inUse) {
+			continue
+		}
+		//只处理配置卷布局的目录
+		if info, statErr := os.Stat(filepath.Join(manager.rootDirectory, volume, dataDirName)); statErr != nil || !info.IsDir() {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(manager.rootDirectory, volume)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, volume)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// Managed 目录名是否为配置卷, 包括旧版本以UUID命名的卷
+func Managed(volume string) bool {
+	return volumeNameRegexp.MatchString(volume) || legacyVolumeRegexp.MatchString(volume)
+}
+
+func (manager *Manager) removable(volume string, inUse map[string]struct{}) bool {
+	if !Managed(volume) {
+		return false
+	}
+	if _, ok := inUse[volume]; ok {
+		return false
+	}
+	_, ok := manager.pending[volume]
+	return !ok
+}
+
+// InUse 容器使用的配置卷, 包括标签记录的卷以及挂载源在卷根目录下的卷(旧版本创建的容器没有标签)
+func (manager *Manager) InUse(containers []types.Container) map[string]struct{} {
+	inUse := make(map[string]struct{})
+	for _, item := range containers {
+		for _, volume := range FromLabels(item.Labels) {
+			inUse[volume] = struct{}{}
+		}
+		for _, mountPoint := range item.Mounts {
+			if volume, ok := manager.volumeOfPath(mountPoint.Source); ok {
+				inUse[volume] = struct{}{}
+			}
+		}
+	}
+	return inUse
+}
+
+func (manager *Manager) volumeOfPath(source string) (string, bool) {
+	rel, err := filepath.Rel(manager.rootDirectory, source)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	volume, _, _ := strings.Cut(rel, string(filepath.Separator))
+	return volume, true
+}
+
+// FromLabels 解析容器标签记录的配置卷, 配置名 -> 卷名
+func FromLabels(labels map[string]string) map[string]string {
+	value := labels[v1model.ContainerLabelConfigVolumes]
+	if value == "" {
+		return nil
+	}
+
+	volumes := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &volumes); err != nil {
+		return nil
+	}
+	return volumes
+}
+
+// ToLabel 配置卷写入容器标签的值
+func ToLabel(volumes map[string]string) string {
+	value, _ := json.Marshal(volumes)
+	return string(value)
+}
+
+// TemplatesFromLabels 解析容器标签记录的按模板渲染的配置
+func TemplatesFromLabels(labels map[string]string) map[string]bool {
+	value := labels[v1model.ContainerLabelConfigTemplates]
+	if value == "" {
+		return nil
+	}
+
+	configNames := []string{}
+	if err := json.Unmarshal([]byte(value), &configNames); err != nil {
+		return nil
+	}
+
+	templates := make(map[string]bool, len(configNames))
+	for _, configName := range configNames {
+		templates[configName] = true
+	}
+	return templates
+}
+
+// TemplatesToLabel 按模板渲染的配置写入容器标签的值
+func TemplatesToLabel(templates map[string]bool) string {
+	configNames := make([]string, 0, len(templates))
+	for configName := range templates {
+		configNames = append(configNames, configName)
+	}
+	sort.Strings(configNames)
+	value, _ := json.Marshal(configNames)
+	return string(value)
+}
@@ -0,0 +1,352 @@
+package configvol
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func inUseOf(volumes ...string) InUseFunc {
+	return func() (map[string]struct{}, error) {
+		inUse := map[string]struct{}{}
+		for _, volume := range volumes {
+			inUse[volume] = struct{}{}
+		}
+		return inUse, nil
+	}
+}
+
+func TestManaged(t *testing.T) {
+	tests := []struct {
+		volume string
+		want   bool
+	}{
+		{volume: VolumeName("nginx.conf", []byte("a")), want: true},
+		{volume: VolumeName("nginx.conf", []byte("a")) + "-2", want: true},
+		{volume: VolumeName("app/config", []byte("a")), want: true},
+		{volume: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", want: true},
+		{volume: "mysql-data", want: false},
+		{volume: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", want: false},
+		{volume: "nginx.conf-0123456789ABCDEF", want: false},
+		{volume: "..", want: false},
+		{volume: "", want: false},
+	}
+
+	for _, test := range tests {
+		if got := Managed(test.volume); got != test.want {
+			t.Errorf("Managed(%q) = %v, want %v", test.volume, got, test.want)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	rootDirectory := t.TempDir()
+	manager := NewManager(rootDirectory)
+
+	_, unused, err := manager.Prepare("app.yaml", "app.yaml", []byte("unused"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Done(map[string]string{"app.yaml": unused})
+
+	_, used, err := manager.Prepare("nginx.conf", "nginx.conf", []byte("used"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Done(map[string]string{"nginx.conf": used})
+
+	//容器创建过程中的卷不清理
+	_, pending, err := manager.Prepare("pending.conf", "pending.conf", []byte("pending"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	for _, directory := range []string{
+		filepath.Join(legacy, dataDirName),
+		filepath.Join("mysql-data", dataDirName),
+		filepath.Join("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", dataDirName),
+		"no-data-0123456789abcdef",
+	} {
+		if err = os.MkdirAll(filepath.Join(rootDirectory, directory), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := manager.Collect(inUseOf(used))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(removed)
+	want := []string{unused, legacy}
+	sort.Strings(want)
+	if !reflect.DeepEqual(removed, want) {
+		t.Fatalf("Collect() = %q, want %q", removed, want)
+	}
+
+	tests := []struct {
+		volume string
+		exists bool
+	}{
+		{volume: unused, exists: false},
+		{volume: legacy, exists: false},
+		{volume: used, exists: true},
+		{volume: pending, exists: true},
+		{volume: "mysql-data", exists: true},
+		{volume: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", exists: true},
+		{volume: "no-data-0123456789abcdef", exists: true},
+	}
+	for _, test := range tests {
+		_, err := os.Stat(filepath.Join(rootDirectory, test.volume))
+		if exists := err == nil; exists != test.exists {
+			t.Errorf("volume %s exists = %v, want %v", test.volume, exists, test.exists)
+		}
+	}
+}
+
+func TestRewriteFile(t *testing.T) {
+	tests := []struct {
+		current string
+		data    string
+	}{
+		{current: "listen 80;\nserver_name example.com;\n", data: "listen 8080;\n"},
+		{current: "a", data: "longer content"},
+		{current: "same", data: "same"},
+		{current: "content", data: ""},
+	}
+
+	for _, test := range tests {
+		filePath := filepath.Join(t.TempDir(), "app.conf")
+		if err := os.WriteFile(filePath, []byte(test.current), 0644); err != nil {
+			t.Fatal(err)
+		}
+		before, err := os.Stat(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = rewriteFile(filePath, []byte(test.data)); err != nil {
+			t.Errorf("rewriteFile(%q -> %q) error = %v", test.current, test.data, err)
+			continue
+		}
+		got, err := os.ReadFile(filePath)
+		if err != nil || string(got) != test.data {
+			t.Errorf("rewriteFile(%q -> %q) = %q, %v", test.current, test.data, got, err)
+		}
+
+		//原地改写, bind mount的inode不变
+		after, err := os.Stat(filePath)
+		if err != nil || !os.SameFile(before, after) {
+			t.Errorf("rewriteFile(%q -> %q) replaced the file", test.current, test.data)
+		}
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	rootDirectory := t.TempDir()
+	manager := NewManager(rootDirectory)
+
+	tests := []struct {
+		configName string
+		fileName   string
+		data       string
+		volume     string
+	}{
+		{configName: "nginx.conf", fileName: "nginx.conf", data: "listen 80;", volume: VolumeName("nginx.conf", []byte("listen 80;"))},
+		//相同内容复用同一个卷
+		{configName: "nginx.conf", fileName: "nginx.conf", data: "listen 80;", volume: VolumeName("nginx.conf", []byte("listen 80;"))},
+		{configName: "nginx.conf", fileName: "nginx.conf", data: "listen 8080;", volume: VolumeName("nginx.conf", []byte("listen 8080;"))},
+		{configName: "app/config", fileName: "app.yaml", data: "debug: true", volume: VolumeName("app/config", []byte("debug: true"))},
+	}
+
+	for _, test := range tests {
+		filePath, volume, err := manager.Prepare(test.configName, test.fileName, []byte(test.data))
+		if err != nil {
+			t.Errorf("Prepare(%q, %q) error = %v", test.configName, test.data, err)
+			continue
+		}
+		if volume != test.volume {
+			t.Errorf("Prepare(%q, %q) volume = %s, want %s", test.configName, test.data, volume, test.volume)
+		}
+		if want := filepath.Join(rootDirectory, test.volume, dataDirName, test.fileName); filePath != want {
+			t.Errorf("Prepare(%q, %q) path = %s, want %s", test.configName, test.data, filePath, want)
+		}
+		if got, err := os.ReadFile(filePath); err != nil || string(got) != test.data {
+			t.Errorf("Prepare(%q, %q) content = %q, %v", test.configName, test.data, got, err)
+		}
+		manager.Done(map[string]string{test.configName: volume})
+	}
+
+	if len(manager.pending) != 0 {
+		t.Errorf("pending volumes = %v, want empty after Done", manager.pending)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	rootDirectory := t.TempDir()
+	manager := NewManager(rootDirectory)
+	filePath, volume, err := manager.Prepare("nginx.conf", "nginx.conf", []byte("listen 80;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Done(map[string]string{"nginx.conf": volume})
+
+	tests := []struct {
+		volume  string
+		data    string
+		changed bool
+		ok      bool
+	}{
+		{volume: volume, data: "listen 80;", changed: false, ok: true},
+		{volume: volume, data: "listen 8080;", changed: true, ok: true},
+		{volume: volume, data: "listen 8080;", changed: false, ok: true},
+		{volume: "", data: "x", ok: false},
+		{volume: "..", data: "x", ok: false},
+		{volume: "a/b", data: "x", ok: false},
+		{volume: "missing-0123456789abcdef", data: "x", ok: false},
+	}
+
+	for _, test := range tests {
+		changed, err := manager.Rewrite(test.volume, []byte(test.data))
+		if (err == nil) != test.ok {
+			t.Errorf("Rewrite(%q, %q) error = %v, want ok %v", test.volume, test.data, err, test.ok)
+			continue
+		}
+		if changed != test.changed {
+			t.Errorf("Rewrite(%q, %q) changed = %v, want %v", test.volume, test.data, changed, test.changed)
+		}
+	}
+
+	if got, err := os.ReadFile(filePath); err != nil || string(got) != "listen 8080;" {
+		t.Fatalf("rewritten content = %q, %v", got, err)
+	}
+
+	//刷新后的卷内容与卷名hash不一致, 原内容再次Prepare时使用带序号的卷, 不覆盖刷新内容
+	_, next, err := manager.Prepare("nginx.conf", "nginx.conf", []byte("listen 80;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := volume + "-1"; next != want {
+		t.Fatalf("Prepare after Rewrite volume = %s, want %s", next, want)
+	}
+	if got, err := os.ReadFile(filePath); err != nil || string(got) != "listen 8080;" {
+		t.Fatalf("refreshed content overwritten = %q, %v", got, err)
+	}
+}
+
+func TestRemoveRecreate(t *testing.T) {
+	rootDirectory := t.TempDir()
+	manager := NewManager(rootDirectory)
+	data := []byte("listen 80;")
+	volume := VolumeName("nginx.conf", data)
+	volumes := map[string]string{"nginx.conf": volume}
+
+	//模拟docker中的容器, 容器使用的卷
+	containers := map[string]string{}
+	inUse := func() (map[string]struct{}, error) {
+		current := map[string]struct{}{}
+		for _, containerVolume := range containers {
+			current[containerVolume] = struct{}{}
+		}
+		return current, nil
+	}
+	create := func(containerName string) {
+		t.Helper()
+		if _, prepared, err := manager.Prepare("nginx.conf", "nginx.conf", data); err != nil || prepared != volume {
+			t.Fatalf("Prepare() = %s, %v, want %s", prepared, err, volume)
+		}
+		containers[containerName] = volume
+		manager.Done(volumes)
+	}
+	exists := func() bool {
+		_, err := os.Stat(filepath.Join(rootDirectory, volume))
+		return err == nil
+	}
+
+	tests := []struct {
+		name   string
+		steps  func()
+		exists bool
+	}{
+		{
+			//删除旧容器后立即重新部署, 新容器复用相同的卷, 清理在新容器创建之后执行
+			name: "recreated before release",
+			steps: func() {
+				create("web-1")
+				delete(containers, "web-1")
+				create("web-2")
+			},
+			exists: true,
+		},
+		{
+			//清理时新容器仍在创建中
+			name: "recreating during release",
+			steps: func() {
+				create("web-1")
+				delete(containers, "web-1")
+				if _, _, err := manager.Prepare("nginx.conf", "nginx.conf", data); err != nil {
+					t.Fatal(err)
+				}
+				if err := manager.Remove(volumes, inUse); err != nil {
+					t.Fatal(err)
+				}
+				containers["web-2"] = volume
+				manager.Done(volumes)
+			},
+			exists: true,
+		},
+		{
+			name: "no container left",
+			steps: func() {
+				create("web-1")
+				delete(containers, "web-1")
+			},
+			exists: false,
+		},
+	}
+
+	for _, test := range tests {
+		clear(containers)
+		test.steps()
+		if err := manager.Remove(volumes, inUse); err != nil {
+			t.Fatalf("%s: Remove() error = %v", test.name, err)
+		}
+		if got := exists(); got != test.exists {
+			t.Errorf("%s: volume exists = %v, want %v", test.name, got, test.exists)
+		}
+	}
+}
+
+func TestRemoveHoldsLock(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	data := []byte("listen 80;")
+	volume := VolumeName("nginx.conf", data)
+
+	//计算使用中的卷期间, 并发的Prepare等待清理结束, 不会在列表之后写入随即被删除的卷
+	prepared := make(chan struct{})
+	inUse := func() (map[string]struct{}, error) {
+		go func() {
+			defer close(prepared)
+			if _, _, err := manager.Prepare("nginx.conf", "nginx.conf", data); err != nil {
+				t.Error(err)
+			}
+		}()
+		select {
+		case <-prepared:
+			t.Error("Prepare finished while Remove holds the lock")
+		case <-time.After(time.Millisecond * 50):
+		}
+		return map[string]struct{}{}, nil
+	}
+
+	if err := manager.Remove(map[string]string{"nginx.conf": volume}, inUse); err != nil {
+		t.Fatal(err)
+	}
+	<-prepared
+	if _, err := os.Stat(filepath.Join(manager.rootDirectory, volume, dataDirName, "nginx.conf")); err != nil {
+		t.Fatalf("volume prepared after Remove missing, %v", err)
+	}
+}
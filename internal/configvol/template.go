@@ -0,0 +1,109 @@
+package configvol
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	v1model "humpback-agent/api/v1/model"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// TemplateContext 配置模板渲染时可访问的容器与主机信息
+type TemplateContext struct {
+	Container TemplateContainer
+	Host      TemplateHost
+	Ports     map[string]int //容器端口(如 80/tcp) -> 主机端口
+}
+
+type TemplateContainer struct {
+	Name        string
+	Image       string
+	Env         map[string]string
+	Labels      map[string]string
+	ServiceId   string
+	ServiceName string
+	GroupId     string
+}
+
+type TemplateHost struct {
+	Hostname string
+	IP       string
+	IPs      []string
+}
+
+// NewTemplateContext 构建模板上下文, env为KEY=VALUE格式
+func NewTemplateContext(name string, image string, env []string, labels map[string]string, hostname string, hostIPs []string, portBindings nat.PortMap) *TemplateContext {
+	templateContext := &TemplateContext{
+		Container: TemplateContainer{
+			Name:        strings.TrimPrefix(name, "/"),
+			Image:       image,
+			Env:         make(map[string]string, len(env)),
+			Labels:      labels,
+			ServiceId:   labels[v1model.ContainerLabelServiceId],
+			ServiceName: labels[v1model.ContainerLabelServiceName],
+			GroupId:     labels[v1model.ContainerLabelGroupId],
+		},
+		Host: TemplateHost{
+			Hostname: hostname,
+			IPs:      hostIPs,
+		},
+		Ports: make(map[string]int),
+	}
+
+	for _, item := range env {
+		key, value, _ := strings.Cut(item, "=")
+		templateContext.Container.Env[key] = value
+	}
+
+	if len(hostIPs) > 0 {
+		templateContext.Host.IP = hostIPs[0]
+	}
+
+	for containerPort, bindings := range portBindings {
+		for _, binding := range bindings {
+			if hostPort, err := strconv.Atoi(binding.HostPort); err == nil && hostPort > 0 {
+				templateContext.Ports[string(containerPort)] = hostPort
+				break
+			}
+		}
+	}
+	return templateContext
+}
+
+// Render 按Go模板渲染配置内容, 引用不存在的字段时返回错误
+func Render(configName string, data []byte, templateContext *TemplateContext) ([]byte, error) {
+	tmpl, err := template.New(configName).Option("missingkey=error").Funcs(template.FuncMap{
+		"default": func(defaultValue string, value any) string {
+			if value == nil || fmt.Sprint(value) == "" {
+				return defaultValue
+			}
+			return fmt.Sprint(value)
+		},
+		"port": func(containerPort string) (int, error) {
+			if !strings.Contains(containerPort, "/") {
+				containerPort += "/tcp"
+			}
+			hostPort, ok := templateContext.Ports[containerPort]
+			if !ok {
+				return 0, fmt.Errorf("container port %s is not published", containerPort)
+			}
+			return hostPort, nil
+		},
+		"join":  strings.Join,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse config %s template error, %w", configName, err)
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, templateContext); err != nil {
+		return nil, fmt.Errorf("render config %s template error, %w", configName, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,155 @@
+package crashloop
+
+import (
+	"sync"
+	"time"
+
+	"humpback-agent/model"
+)
+
+const (
+	// kill事件之后的退出视为主动停止(stop/restart/kill), 不计入CrashLoop
+	killGracePeriod = time.Second * 30
+)
+
+type record struct {
+	exits        []time.Time
+	lastExitCode int
+	oomKilled    bool
+	pendingOOM   bool
+	killedAt     time.Time
+	lastLogs     []string
+	stopped      bool
+}
+
+// Detector 按容器统计滑动窗口内的异常退出次数
+type Detector struct {
+	sync.Mutex
+	window    time.Duration
+	threshold int
+	records   map[string]*record
+}
+
+func NewDetector(window time.Duration, threshold int) *Detector {
+	return &Detector{
+		window:    window,
+		threshold: threshold,
+		records:   make(map[string]*record),
+	}
+}
+
+func (detector *Detector) get(containerId string) *record {
+	r, ok := detector.records[containerId]
+	if !ok {
+		r = &record{}
+		detector.records[containerId] = r
+	}
+	return r
+}
+
+// Kill 记录kill事件, 随后的一次die不计入
+func (detector *Detector) Kill(containerId string, at time.Time) {
+	detector.Lock()
+	defer detector.Unlock()
+	detector.get(containerId).killedAt = at
+}
+
+// OOM 记录oom事件, 由随后的die消费
+func (detector *Detector) OOM(containerId string) {
+	detector.Lock()
+	defer detector.Unlock()
+	detector.get(containerId).pendingOOM = true
+}
+
+// Start 容器重新被启动, 清除agent停止标记
+func (detector *Detector) Start(containerId string) {
+	detector.Lock()
+	defer detector.Unlock()
+	if r, ok := detector.records[containerId]; ok {
+		r.stopped = false
+	}
+}
+
+// Die 记录一次退出, 返回窗口内的退出次数以及是否本次刚进入CrashLoop
+func (detector *Detector) Die(containerId string, exitCode int, at time.Time) (int, bool) {
+	detector.Lock()
+	defer detector.Unlock()
+	r := detector.get(containerId)
+	oomKilled := r.pendingOOM
+	r.pendingOOM = false
+	//kill只对应随后的一次退出, 之后的退出即使仍在宽限期内也计入
+	killedAt := r.killedAt
+	r.killedAt = time.Time{}
+	if !oomKilled && !killedAt.IsZero() && at.Sub(killedAt) < killGracePeriod {
+		return len(r.prune(at, detector.window)), false
+	}
+
+	wasCrashLoop := len(r.prune(at, detector.window)) >= detector.threshold
+	r.exits = append(r.exits, at)
+	r.lastExitCode = exitCode
+	r.oomKilled = oomKilled
+	restarts := len(r.exits)
+	return restarts, !wasCrashLoop && restarts >= detector.threshold
+}
+
+// SetLastLogs 保存进入CrashLoop时的最后日志
+func (detector *Detector) SetLastLogs(containerId string, logs []string) {
+	detector.Lock()
+	defer detector.Unlock()
+	if r, ok := detector.records[containerId]; ok {
+		r.lastLogs = logs
+	}
+}
+
+// SetStopped 标记容器已因CrashLoop被agent停止
+func (detector *Detector) SetStopped(containerId string) {
+	detector.Lock()
+	defer detector.Unlock()
+	if r, ok := detector.records[containerId]; ok {
+		r.stopped = true
+	}
+}
+
+func (detector *Detector) Remove(containerId string) {
+	detector.Lock()
+	defer detector.Unlock()
+	delete(detector.records, containerId)
+}
+
+// Info 返回容器的CrashLoop信息, 未处于CrashLoop且未被停止时返回nil
+func (detector *Detector) Info(containerId string) *model.CrashLoopInfo {
+	detector.Lock()
+	defer detector.Unlock()
+	r, ok := detector.records[containerId]
+	if !ok {
+		return nil
+	}
+
+	exits := r.prune(time.Now(), detector.window)
+	if len(exits) < detector.threshold && !r.stopped {
+		return nil
+	}
+
+	info := &model.CrashLoopInfo{
+		Restarts:     len(exits),
+		Window:       int64(detector.window.Seconds()),
+		LastExitCode: r.lastExitCode,
+		OOMKilled:    r.oomKilled,
+		LastLogs:     r.lastLogs,
+		Stopped:      r.stopped,
+	}
+	if len(exits) > 0 {
+		info.Since = exits[0].UnixMilli()
+	}
+	return info
+}
+
+// prune 丢弃窗口外的退出记录
+func (r *record) prune(now time.Time, window time.Duration) []time.Time {
+	begin := 0
+	for begin < len(r.exits) && now.Sub(r.exits[begin]) > window {
+		begin++
+	}
+	r.exits = r.exits[begin:]
+	return r.exits
+}
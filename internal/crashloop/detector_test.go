@@ -0,0 +1,143 @@
+package crashloop
+
+import (
+	"testing"
+	"time"
+)
+
+type event struct {
+	kind     string //kill, oom, die
+	offset   time.Duration
+	exitCode int
+}
+
+func TestDie(t *testing.T) {
+	tests := []struct {
+		name         string
+		events       []event
+		restarts     int
+		entered      bool
+		crashLoop    bool
+		lastExitCode int
+		oomKilled    bool
+	}{
+		{
+			name:         "below threshold",
+			events:       []event{{kind: "die", exitCode: 1}, {kind: "die", offset: time.Second, exitCode: 2}},
+			restarts:     2,
+			lastExitCode: 2,
+		},
+		{
+			name:         "threshold crossed",
+			events:       []event{{kind: "die", exitCode: 1}, {kind: "die", offset: time.Second, exitCode: 1}, {kind: "die", offset: time.Second * 2, exitCode: 137}},
+			restarts:     3,
+			entered:      true,
+			crashLoop:    true,
+			lastExitCode: 137,
+		},
+		{
+			name:         "already in crash loop",
+			events:       []event{{kind: "die", exitCode: 1}, {kind: "die", offset: time.Second, exitCode: 1}, {kind: "die", offset: time.Second * 2, exitCode: 1}, {kind: "die", offset: time.Second * 3, exitCode: 1}},
+			restarts:     4,
+			crashLoop:    true,
+			lastExitCode: 1,
+		},
+		{
+			name:         "exits outside window dropped",
+			events:       []event{{kind: "die", exitCode: 1}, {kind: "die", offset: time.Second, exitCode: 1}, {kind: "die", offset: time.Minute * 2, exitCode: 3}},
+			restarts:     1,
+			lastExitCode: 3,
+		},
+		{
+			name:     "kill excuses the following exit",
+			events:   []event{{kind: "kill"}, {kind: "die", offset: time.Second, exitCode: 137}},
+			restarts: 0,
+		},
+		{
+			name:         "kill excuses only one exit",
+			events:       []event{{kind: "kill"}, {kind: "die", offset: time.Second, exitCode: 137}, {kind: "die", offset: time.Second * 2, exitCode: 1}, {kind: "die", offset: time.Second * 3, exitCode: 1}, {kind: "die", offset: time.Second * 4, exitCode: 1}},
+			restarts:     3,
+			entered:      true,
+			crashLoop:    true,
+			lastExitCode: 1,
+		},
+		{
+			name:         "kill grace expired",
+			events:       []event{{kind: "kill"}, {kind: "die", offset: time.Minute, exitCode: 1}},
+			restarts:     1,
+			lastExitCode: 1,
+		},
+		{
+			name:         "oom exit counted after kill",
+			events:       []event{{kind: "kill"}, {kind: "oom"}, {kind: "die", offset: time.Second, exitCode: 137}},
+			restarts:     1,
+			lastExitCode: 137,
+			oomKilled:    true,
+		},
+		{
+			name:         "oom consumed by one exit",
+			events:       []event{{kind: "oom"}, {kind: "die", exitCode: 137}, {kind: "die", offset: time.Second, exitCode: 1}},
+			restarts:     2,
+			lastExitCode: 1,
+			oomKilled:    false,
+		},
+	}
+
+	for _, test := range tests {
+		detector := NewDetector(time.Minute, 3)
+		begin := time.Now().Add(-time.Second * 10)
+		var restarts int
+		var entered bool
+		for _, item := range test.events {
+			at := begin.Add(item.offset)
+			switch item.kind {
+			case "kill":
+				detector.Kill("c1", at)
+			case "oom":
+				detector.OOM("c1")
+			case "die":
+				restarts, entered = detector.Die("c1", item.exitCode, at)
+			}
+		}
+
+		if restarts != test.restarts || entered != test.entered {
+			t.Errorf("%s: Die() = %d, %v, want %d, %v", test.name, restarts, entered, test.restarts, test.entered)
+			continue
+		}
+
+		record := detector.records["c1"]
+		if record.lastExitCode != test.lastExitCode || record.oomKilled != test.oomKilled {
+			t.Errorf("%s: last exit = %d, oom %v, want %d, oom %v", test.name, record.lastExitCode, record.oomKilled, test.lastExitCode, test.oomKilled)
+		}
+
+		info := detector.Info("c1")
+		if (info != nil) != test.crashLoop {
+			t.Errorf("%s: Info() = %+v, want crash loop %v", test.name, info, test.crashLoop)
+		}
+	}
+}
+
+func TestInfoStopped(t *testing.T) {
+	detector := NewDetector(time.Minute, 2)
+	now := time.Now()
+	detector.Die("c1", 1, now.Add(-time.Second*2))
+	detector.Die("c1", 1, now.Add(-time.Second))
+	detector.SetLastLogs("c1", []string{"panic: boom"})
+	detector.SetStopped("c1")
+
+	info := detector.Info("c1")
+	if info == nil || !info.Stopped || info.Restarts != 2 || len(info.LastLogs) != 1 {
+		t.Fatalf("Info() = %+v, want stopped crash loop with 2 restarts", info)
+	}
+
+	//重新启动后清除停止标记, 窗口内的退出仍然保留
+	detector.Start("c1")
+	if info = detector.Info("c1"); info == nil || info.Stopped {
+		t.Fatalf("Info() after Start = %+v", info)
+	}
+
+	detector.Remove("c1")
+	if info = detector.Info("c1"); info != nil {
+		t.Fatalf("Info() after Remove = %+v, want nil", info)
+	}
+}
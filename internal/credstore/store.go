@@ -0,0 +1,280 @@
+package credstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"humpback-agent/pkg/utils"
+)
+
+const (
+	credentialsFileName = "credentials.json"
+	keyFileName         = "credentials.key"
+	legacySeparator     = "^^"
+)
+
+var (
+	ErrCredentialNotFound = errors.New("registry credential not found")
+	ErrCredentialKey      = errors.New("registry credential decrypt failed, node key invalid")
+	ErrLegacyAuthInvalid  = errors.New("legacy image auth label invalid")
+)
+
+// Credential 镜像仓库凭据
+type Credential struct {
+	Registry string
+	Username string
+	Password string
+}
+
+type entry struct {
+	Registry  string `json:"registry"`
+	Username  string `json:"username"`
+	Password  string `json:"password"` //节点密钥加密后的密码
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// Store Job镜像仓库凭据的本地存储, 按仓库地址与用户名保存, 密码使用节点密钥加密,
+// 容器标签只记录凭据ID
+type Store struct {
+	sync.Mutex
+	filePath string
+	gcm      cipher.AEAD
+	entries  map[string]*entry
+}
+
+// NewStore 加载凭据存储, key为空时使用数据目录下自动生成的节点密钥
+func NewStore(dataDirectory string, key []byte) (*Store, error) {
+	if key == nil {
+		var err error
+		if key, err = loadOrCreateKey(filepath.Join(dataDirectory, keyFileName)); err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &Store{
+		filePath: filepath.Join(dataDirectory, credentialsFileName),
+		gcm:      gcm,
+		entries:  make(map[string]*entry),
+	}
+	if err = store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Put 保存凭据并返回ID, 相同仓库与用户名的凭据复用同一ID
+func (store *Store) Put(credential Credential) (string, error) {
+	registry := normalizeRegistry(credential.Registry)
+	password, err := store.encrypt(credential.Password)
+	if err != nil {
+		return "", err
+	}
+
+	store.Lock()
+	defer store.Unlock()
+	id := ""
+	for entryId, current := range store.entries {
+		if current.Registry == registry && current.Username == credential.Username {
+			id = entryId
+			break
+		}
+	}
+
+	if id == "" {
+		if id, err = newId(); err != nil {
+			return "", err
+		}
+	} else if plaintext, err := store.decrypt(store.entries[id].Password); err == nil && plaintext == credential.Password {
+		return id, nil
+	}
+
+	previous := store.entries[id]
+	store.entries[id] = &entry{
+		Registry:  registry,
+		Username:  credential.Username,
+		Password:  password,
+		UpdatedAt: time.Now().UnixMilli(),
+	}
+	if err = store.save(); err != nil {
+		if previous != nil {
+			store.entries[id] = previous
+		} else {
+			delete(store.entries, id)
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+// Get 按ID获取解密后的凭据
+func (store *Store) Get(id string) (*Credential, error) {
+	store.Lock()
+	defer store.Unlock()
+	current, ok := store.entries[id]
+	if !ok {
+		return nil, fmt.Errorf("%w, %s", ErrCredentialNotFound, id)
+	}
+
+	password, err := store.decrypt(current.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &Credential{Registry: current.Registry, Username: current.Username, Password: password}, nil
+}
+
+// Collect 删除没有容器引用的凭据
+func (store *Store) Collect(inUse map[string]struct{}) (int, error) {
+	store.Lock()
+	defer store.Unlock()
+	removed := map[string]*entry{}
+	for id, current := range store.entries {
+		if _, ok := inUse[id]; !ok {
+			removed[id] = current
+			delete(store.entries, id)
+		}
+	}
+
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	if err := store.save(); err != nil {
+		for id, current := range removed {
+			store.entries[id] = current
+		}
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+// ParseLegacy 解析旧版本 base64(username^^password^^server) 格式的标签,
+// 用户名和仓库地址不包含^^, 密码中可能包含, 因此按第一个和最后一个^^拆分
+func ParseLegacy(value string) (Credential, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return Credential{}, ErrLegacyAuthInvalid
+	}
+
+	decoded := string(data)
+	first := strings.Index(decoded, legacySeparator)
+	last := strings.LastIndex(decoded, legacySeparator)
+	if first < 0 || first == last {
+		return Credential{}, ErrLegacyAuthInvalid
+	}
+	return Credential{
+		Username: decoded[:first],
+		Password: decoded[first+len(legacySeparator) : last],
+		Registry: decoded[last+len(legacySeparator):],
+	}, nil
+}
+
+func (store *Store) load() error {
+	data, err := os.ReadFile(store.filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if err = json.Unmarshal(data, &store.entries); err != nil {
+		return fmt.Errorf("parse credentials file error, %w", err)
+	}
+	return nil
+}
+
+func (store *Store) save() error {
+	data, err := json.MarshalIndent(store.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile := store.filePath + ".tmp"
+	if err = utils.WriteFileWithDir(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmpFile, 0600); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, store.filePath)
+}
+
+func (store *Store) encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, store.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(store.gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+func (store *Store) decrypt(ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < store.gcm.NonceSize() {
+		return "", ErrCredentialKey
+	}
+
+	plaintext, err := store.gcm.Open(nil, data[:store.gcm.NonceSize()], data[store.gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrCredentialKey
+	}
+	return string(plaintext), nil
+}
+
+func loadOrCreateKey(keyFile string) ([]byte, error) {
+	key, err := os.ReadFile(keyFile)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("credentials key file %s invalid", keyFile)
+		}
+		return key, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err = utils.WriteFileWithDir(keyFile, key, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newId() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func normalizeRegistry(registry string) string {
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	return strings.TrimSuffix(registry, "/")
+}
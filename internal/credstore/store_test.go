@@ -0,0 +1,74 @@
+package credstore
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestParseLegacy(t *testing.T) {
+	tests := []struct {
+		decoded string
+		want    Credential
+		err     error
+	}{
+		{decoded: "user^^pass^^registry.example.com", want: Credential{Username: "user", Password: "pass", Registry: "registry.example.com"}},
+		{decoded: "user^^pa^^ss^^registry.example.com:5000", want: Credential{Username: "user", Password: "pa^^ss", Registry: "registry.example.com:5000"}},
+		{decoded: "user^^^^^^registry.example.com", want: Credential{Username: "user", Password: "^^", Registry: "registry.example.com"}},
+		{decoded: "user^^pass^^", want: Credential{Username: "user", Password: "pass"}},
+		{decoded: "user^^pass", err: ErrLegacyAuthInvalid},
+		{decoded: "userpass", err: ErrLegacyAuthInvalid},
+	}
+
+	for _, test := range tests {
+		got, err := ParseLegacy(base64.StdEncoding.EncodeToString([]byte(test.decoded)))
+		if !errors.Is(err, test.err) {
+			t.Errorf("ParseLegacy(%q) error = %v, want %v", test.decoded, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseLegacy(%q) = %+v, want %+v", test.decoded, got, test.want)
+		}
+	}
+
+	if _, err := ParseLegacy("not base64!"); !errors.Is(err, ErrLegacyAuthInvalid) {
+		t.Errorf("ParseLegacy(invalid base64) error = %v", err)
+	}
+}
+
+func TestStorePutGet(t *testing.T) {
+	directory := t.TempDir()
+	store, err := NewStore(directory, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := store.Put(Credential{Registry: "https://registry.example.com/", Username: "user", Password: "pa^^ss"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//相同仓库与用户名复用ID
+	sameId, err := store.Put(Credential{Registry: "registry.example.com", Username: "user", Password: "new"})
+	if err != nil || sameId != id {
+		t.Fatalf("Put same registry and user = %s, %v, want %s", sameId, err, id)
+	}
+
+	//重新加载后使用自动生成的节点密钥解密
+	reloaded, err := NewStore(directory, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := reloaded.Get(id)
+	if err != nil || credential.Password != "new" || credential.Registry != "registry.example.com" {
+		t.Fatalf("Get = %+v, %v", credential, err)
+	}
+
+	other, err := NewStore(directory, make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.Get(id); !errors.Is(err, ErrCredentialKey) {
+		t.Fatalf("Get with wrong key error = %v", err)
+	}
+}
@@ -1,11 +1,29 @@
 package docker
 
 import (
-	"github.com/docker/docker/client"
+	"fmt"
+	"net/http"
+
 	"humpback-agent/config"
+	"humpback-agent/internal/metrics"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/sockets"
+	"github.com/docker/go-connections/tlsconfig"
 )
 
 func BuildDockerClient(config *config.DockerConfig) (*client.Client, error) {
+	hostURL, err := client.ParseHostURL(config.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	//自行构建transport, 以便包装一层docker API调用指标
+	transport := &http.Transport{}
+	if err = sockets.ConfigureTransport(transport, hostURL.Scheme, hostURL.Host); err != nil {
+		return nil, err
+	}
+
 	opts := []client.Opt{
 		client.WithHost(config.Host),
 		//client.WithHTTPClient(&http.Client{
@@ -14,9 +32,24 @@ func BuildDockerClient(config *config.DockerConfig) (*client.Client, error) {
 	}
 
 	if config.DockerTLSOpts.Enabled {
-		opts = append(opts, client.WithTLSClientConfig(config.DockerTLSOpts.CAPath, config.DockerTLSOpts.CertPath, config.DockerTLSOpts.KeyPath))
+		tlsConfig, tlsErr := tlsconfig.Client(tlsconfig.Options{
+			CAFile:             config.DockerTLSOpts.CAPath,
+			CertFile:           config.DockerTLSOpts.CertPath,
+			KeyFile:            config.DockerTLSOpts.KeyPath,
+			ExclusiveRootPools: true,
+		})
+		if tlsErr != nil {
+			return nil, fmt.Errorf("failed to create docker tls config, %w", tlsErr)
+		}
+		transport.TLSClientConfig = tlsConfig
+		opts = append(opts, client.WithScheme("https"))
 	}
 
+	opts = append(opts, client.WithHTTPClient(&http.Client{
+		Transport:     metrics.InstrumentDockerTransport(transport),
+		CheckRedirect: client.CheckRedirect,
+	}))
+
 	if config.AutoNegotiate {
 		opts = append(opts, client.WithAPIVersionNegotiation()) // Humpback 使用 docker sdk 与 docker daemon 自动协商版本
 	} else {
@@ -0,0 +1,215 @@
+package identity
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	identityFileName = "identity.json"
+)
+
+var (
+	ErrIdentityKeyRequired = errors.New("identity private key is encrypted, but no identity key configured")
+	ErrIdentityKeyInvalid  = errors.New("identity private key decrypt failed, identity key invalid")
+)
+
+// Identity 节点注册后由Master下发的身份信息
+type Identity struct {
+	NodeId       string `json:"nodeId"`
+	Token        string `json:"token"`
+	CertPEM      string `json:"certPem"`
+	KeyPEM       string `json:"keyPem"`
+	CAPEM        string `json:"caPem"`
+	KeyEncrypted bool   `json:"keyEncrypted"`
+	UpdatedAt    int64  `json:"updatedAt"`
+}
+
+// Store 负责身份信息的本地持久化, 文件权限为0600, 私钥可选加密存储
+type Store struct {
+	sync.Mutex
+	filePath string
+	key      []byte
+}
+
+// LoadKey 从环境变量值或密钥文件加载私钥加密密钥, 都未设置时返回nil表示不加密
+func LoadKey(key string, keyFile string) ([]byte, error) {
+	material := key
+	if material == "" && keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read identity key file error, %w", err)
+		}
+		material = strings.TrimSpace(string(data))
+	}
+
+	if material == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(material))
+	return sum[:], nil
+}
+
+func NewStore(dataDirectory string, key []byte) *Store {
+	return &Store{
+		filePath: filepath.Join(dataDirectory, identityFileName),
+		key:      key,
+	}
+}
+
+func (store *Store) FilePath() string {
+	return store.filePath
+}
+
+// Load 读取本地身份信息, 文件不存在时返回nil
+func (store *Store) Load() (*Identity, error) {
+	store.Lock()
+	defer store.Unlock()
+	return store.load()
+}
+
+func (store *Store) load() (*Identity, error) {
+	data, err := os.ReadFile(store.filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	identity := &Identity{}
+	if err = json.Unmarshal(data, identity); err != nil {
+		return nil, fmt.Errorf("parse identity file error, %w", err)
+	}
+
+	if identity.KeyEncrypted {
+		if store.key == nil {
+			return nil, ErrIdentityKeyRequired
+		}
+		keyPEM, err := store.decrypt(identity.KeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		identity.KeyPEM = keyPEM
+		identity.KeyEncrypted = false
+	}
+	return identity, nil
+}
+
+// Save 原子写入身份信息, 配置了密钥时私钥加密后落盘
+func (store *Store) Save(identity *Identity) error {
+	store.Lock()
+	defer store.Unlock()
+	return store.save(identity)
+}
+
+func (store *Store) save(identity *Identity) error {
+	persisted := *identity
+	persisted.UpdatedAt = time.Now().UnixMilli()
+	if store.key != nil {
+		keyPEM, err := store.encrypt(identity.KeyPEM)
+		if err != nil {
+			return err
+		}
+		persisted.KeyPEM = keyPEM
+		persisted.KeyEncrypted = true
+	}
+
+	data, err := json.MarshalIndent(&persisted, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(store.filePath), 0700); err != nil {
+		return err
+	}
+
+	tmpFile := store.filePath + ".tmp"
+	if err = os.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile不会修改已存在文件的权限, 这里再强制一次
+	if err = os.Chmod(tmpFile, 0600); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, store.filePath)
+}
+
+// UpdateToken 心跳下发新token后更新本地身份信息
+func (store *Store) UpdateToken(token string) error {
+	store.Lock()
+	defer store.Unlock()
+	identity, err := store.load()
+	if err != nil {
+		return err
+	}
+
+	if identity == nil {
+		return nil
+	}
+	identity.Token = token
+	return store.save(identity)
+}
+
+// Remove 删除本地身份信息, 下次启动时重新注册
+func (store *Store) Remove() error {
+	store.Lock()
+	defer store.Unlock()
+	if err := os.Remove(store.filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (store *Store) encrypt(plaintext string) (string, error) {
+	gcm, err := store.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (store *Store) decrypt(ciphertext string) (string, error) {
+	gcm, err := store.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", ErrIdentityKeyInvalid
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrIdentityKeyInvalid
+	}
+	return string(plaintext), nil
+}
+
+func (store *Store) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(store.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,344 @@
+package imagegc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/model"
+	"humpback-agent/pkg/utils"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const usageFileName = "image-usage.json"
+
+// Policy 回收策略, 水位为Docker根目录所在文件系统的使用率百分比
+type Policy struct {
+	Interval      time.Duration
+	HighWatermark int
+	LowWatermark  int
+	MinAge        time.Duration //agent首次发现镜像后至少保留的时长
+	Allowlist     []string      //不回收的镜像, 支持path.Match通配符, 匹配镜像名称或ID
+}
+
+type imageUsage struct {
+	FirstSeen int64 `json:"firstSeen"`
+	LastUsed  int64 `json:"lastUsed"` //最后一次被容器使用的时间, 未被使用过时为0
+}
+
+type candidate struct {
+	summary  image.Summary
+	lastUsed int64
+}
+
+// Collector 磁盘使用率超过高水位时按最后使用时间(LRU)删除未使用的镜像, 直到低于低水位
+type Collector struct {
+	sync.Mutex
+	client   *client.Client
+	policy   Policy
+	filePath string
+	usage    map[string]*imageUsage //imageId
+	status   model.ImageGCStatus
+	busy     func() bool //有容器创建或Job执行时不回收, 刚拉取的镜像在容器创建前不被任何容器引用
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewCollector(client *client.Client, dataDirectory string, policy Policy, busy func() bool) (*Collector, error) {
+	collector := &Collector{
+		client:   client,
+		policy:   policy,
+		filePath: filepath.Join(dataDirectory, usageFileName),
+		usage:    make(map[string]*imageUsage),
+		busy:     busy,
+	}
+
+	data, err := os.ReadFile(collector.filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return collector, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &collector.usage); err != nil {
+		return nil, fmt.Errorf("parse image usage file error, %w", err)
+	}
+	return collector, nil
+}
+
+func (collector *Collector) Start(ctx context.Context) {
+	ctx, collector.cancel = context.WithCancel(ctx)
+	collector.done = make(chan struct{})
+	go func() {
+		defer close(collector.done)
+		for {
+			collector.collectOnce(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(collector.policy.Interval):
+			}
+		}
+	}()
+}
+
+func (collector *Collector) Stop() {
+	if collector.cancel != nil {
+		collector.cancel()
+		<-collector.done
+	}
+}
+
+// Status 最近一次回收及累计的回收情况, 随心跳上报
+func (collector *Collector) Status() *model.ImageGCStatus {
+	collector.Lock()
+	defer collector.Unlock()
+	status := collector.status
+	if status.LastRun != nil {
+		lastRun := *status.LastRun
+		status.LastRun = &lastRun
+	}
+	return &status
+}
+
+func (collector *Collector) collectOnce(ctx context.Context) {
+	images, inUse, err := collector.refreshUsage(ctx)
+	if err != nil {
+		logrus.Errorf("image gc refresh usage error, %v", err)
+		return
+	}
+
+	dockerInfo, err := collector.client.Info(ctx)
+	if err != nil {
+		logrus.Errorf("image gc get docker info error, %v", err)
+		return
+	}
+
+	usage, err := diskUsage(dockerInfo.DockerRootDir)
+	if err != nil {
+		logrus.Errorf("image gc stat %s error, %v", dockerInfo.DockerRootDir, err)
+		return
+	}
+
+	if usage < float64(collector.policy.HighWatermark) || collector.isBusy() {
+		return
+	}
+
+	run := &model.ImageGCRun{
+		StartedAt:       time.Now().UnixMilli(),
+		DiskUsageBefore: usage,
+	}
+
+	var errs []error
+	removedIds := []string{}
+	for _, candidate := range collector.candidates(images, inUse) {
+		if usage < float64(collector.policy.LowWatermark) || ctx.Err() != nil || collector.isBusy() {
+			break
+		}
+
+		if err = collector.remove(ctx, candidate.summary); err != nil {
+			logrus.Warnf("image gc remove image %s error, %v", candidate.summary.ID, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		logrus.Infof("image gc removed image %s %v, size %d", candidate.summary.ID, candidate.summary.RepoTags, candidate.summary.Size)
+		removedIds = append(removedIds, candidate.summary.ID)
+		run.RemovedImages = append(run.RemovedImages, imageName(candidate.summary))
+		run.ReclaimedBytes += candidate.summary.Size
+		if usage, err = diskUsage(dockerInfo.DockerRootDir); err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+
+	run.FinishedAt = time.Now().UnixMilli()
+	run.DiskUsageAfter = usage
+	if err = errors.Join(errs...); err != nil {
+		run.Error = err.Error()
+	}
+
+	collector.Lock()
+	for _, imageId := range removedIds {
+		delete(collector.usage, imageId)
+	}
+	collector.status.LastRun = run
+	collector.status.TotalRuns++
+	collector.status.TotalRemoved += len(run.RemovedImages)
+	collector.status.TotalReclaimed += run.ReclaimedBytes
+	collector.Unlock()
+	logrus.Infof("image gc finished, disk usage %.1f%% -> %.1f%%, %d images removed", run.DiskUsageBefore, run.DiskUsageAfter, len(run.RemovedImages))
+}
+
+// refreshUsage 记录容器正在使用的镜像, 返回本地镜像及不可删除的镜像ID
+// 所有容器引用的镜像都不删除, Humpback管理的容器还保留其镜像名称当前指向的镜像, 避免Job重建时重新拉取
+func (collector *Collector) refreshUsage(ctx context.Context) ([]image.Summary, map[string]struct{}, error) {
+	images, err := collector.client.ImageList(ctx, image.ListOptions{All: false})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	containers, err := collector.client.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	references := make(map[string]string) //镜像名称 -> 镜像ID
+	for _, summary := range images {
+		for _, name := range append(append([]string{}, summary.RepoTags...), summary.RepoDigests...) {
+			if named, err := reference.ParseNormalizedNamed(name); err == nil {
+				references[named.String()] = summary.ID
+			}
+		}
+	}
+
+	inUse := make(map[string]struct{})
+	for _, containerInfo := range containers {
+		inUse[containerInfo.ImageID] = struct{}{}
+		if isManaged(containerInfo) {
+			if named, err := reference.ParseNormalizedNamed(containerInfo.Image); err == nil {
+				if imageId, ok := references[reference.TagNameOnly(named).String()]; ok {
+					inUse[imageId] = struct{}{}
+				}
+			}
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	collector.Lock()
+	defer collector.Unlock()
+	current := make(map[string]*imageUsage, len(images))
+	for _, summary := range images {
+		usage, ok := collector.usage[summary.ID]
+		if !ok {
+			usage = &imageUsage{FirstSeen: now}
+		}
+		if _, ok = inUse[summary.ID]; ok {
+			usage.LastUsed = now
+		}
+		current[summary.ID] = usage
+	}
+	collector.usage = current
+
+	data, err := json.Marshal(collector.usage)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = utils.WriteFileWithDir(collector.filePath, data, 0644); err != nil {
+		return nil, nil, err
+	}
+	return images, inUse, nil
+}
+
+// candidates 可删除的镜像, 最久未使用的在前, 从未被使用的镜像以首次发现时间计
+func (collector *Collector) candidates(images []image.Summary, inUse map[string]struct{}) []candidate {
+	minSeen := time.Now().Add(-collector.policy.MinAge).UnixMilli()
+	collector.Lock()
+	candidates := make([]candidate, 0, len(images))
+	for _, summary := range images {
+		if _, ok := inUse[summary.ID]; ok || summary.Containers > 0 {
+			continue
+		}
+
+		usage := collector.usage[summary.ID]
+		if usage == nil || usage.FirstSeen > minSeen || collector.allowed(summary) {
+			continue
+		}
+
+		lastUsed := usage.LastUsed
+		if lastUsed == 0 {
+			lastUsed = usage.FirstSeen
+		}
+		candidates = append(candidates, candidate{summary: summary, lastUsed: lastUsed})
+	}
+	collector.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastUsed < candidates[j].lastUsed
+	})
+	return candidates
+}
+
+func (collector *Collector) isBusy() bool {
+	return collector.busy != nil && collector.busy()
+}
+
+func (collector *Collector) allowed(summary image.Summary) bool {
+	for _, pattern := range collector.policy.Allowlist {
+		if strings.HasPrefix(summary.ID, pattern) || strings.HasPrefix(strings.TrimPrefix(summary.ID, "sha256:"), pattern) {
+			return true
+		}
+
+		for _, name := range append(append([]string{}, summary.RepoTags...), summary.RepoDigests...) {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+			//同时匹配完整名称, 如 docker.io/library/nginx:*
+			if named, err := reference.ParseNormalizedNamed(name); err == nil {
+				if matched, _ := path.Match(pattern, named.String()); matched {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// remove 不使用Force, 由docker保证不删除仍被容器引用的镜像, 多个标签的镜像逐个删除标签
+func (collector *Collector) remove(ctx context.Context, summary image.Summary) error {
+	if len(summary.RepoTags) <= 1 {
+		_, err := collector.client.ImageRemove(ctx, summary.ID, image.RemoveOptions{PruneChildren: true})
+		return err
+	}
+
+	for _, tag := range summary.RepoTags {
+		if _, err := collector.client.ImageRemove(ctx, tag, image.RemoveOptions{PruneChildren: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isManaged(containerInfo types.Container) bool {
+	_, ok := containerInfo.Labels[v1model.ContainerLabelServiceId]
+	return ok
+}
+
+func imageName(summary image.Summary) string {
+	if len(summary.RepoTags) > 0 && summary.RepoTags[0] != "<none>:<none>" {
+		return summary.RepoTags[0]
+	}
+	return summary.ID
+}
+
+// diskUsage 文件系统使用率百分比, 与df一致不计入保留给root的空间
+func diskUsage(directory string) (float64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(directory, &stat); err != nil {
+		return 0, err
+	}
+
+	used := stat.Blocks - stat.Bfree
+	total := used + stat.Bavail
+	if total == 0 {
+		return 0, nil
+	}
+	return float64(used) * 100 / float64(total), nil
+}
@@ -0,0 +1,76 @@
+package imagegc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+)
+
+func TestCandidates(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) int64 {
+		return now.Add(-d).UnixMilli()
+	}
+
+	collector := &Collector{
+		policy: Policy{MinAge: time.Hour, Allowlist: []string{"redis:*"}},
+		usage: map[string]*imageUsage{
+			"sha256:old":       {FirstSeen: ago(time.Hour * 72), LastUsed: ago(time.Hour * 48)},
+			"sha256:recent":    {FirstSeen: ago(time.Hour * 72), LastUsed: ago(time.Hour * 2)},
+			"sha256:neverused": {FirstSeen: ago(time.Hour * 24)},
+			"sha256:young":     {FirstSeen: ago(time.Minute * 10)},
+			"sha256:inuse":     {FirstSeen: ago(time.Hour * 72)},
+			"sha256:container": {FirstSeen: ago(time.Hour * 72)},
+			"sha256:allowed":   {FirstSeen: ago(time.Hour * 72)},
+		},
+	}
+
+	images := []image.Summary{
+		{ID: "sha256:recent", RepoTags: []string{"nginx:1.27"}},
+		{ID: "sha256:neverused", RepoTags: []string{"busybox:latest"}},
+		{ID: "sha256:old", RepoTags: []string{"nginx:1.25"}},
+		{ID: "sha256:young", RepoTags: []string{"alpine:3.20"}},
+		{ID: "sha256:inuse", RepoTags: []string{"mysql:8"}},
+		{ID: "sha256:container", RepoTags: []string{"postgres:16"}, Containers: 1},
+		{ID: "sha256:allowed", RepoTags: []string{"redis:7"}},
+		{ID: "sha256:unknown", RepoTags: []string{"unknown:latest"}},
+	}
+
+	got := []string{}
+	for _, candidate := range collector.candidates(images, map[string]struct{}{"sha256:inuse": {}}) {
+		got = append(got, candidate.summary.ID)
+	}
+
+	//最久未使用的在前, 从未使用的镜像按首次发现时间排序
+	want := []string{"sha256:old", "sha256:neverused", "sha256:recent"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("candidates() = %v, want %v", got, want)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		pattern string
+		summary image.Summary
+		want    bool
+	}{
+		{pattern: "nginx:*", summary: image.Summary{ID: "sha256:abc", RepoTags: []string{"nginx:1.27"}}, want: true},
+		{pattern: "docker.io/library/nginx:*", summary: image.Summary{ID: "sha256:abc", RepoTags: []string{"nginx:1.27"}}, want: true},
+		{pattern: "registry.example.com/*/*", summary: image.Summary{ID: "sha256:abc", RepoTags: []string{"registry.example.com/team/app:v1"}}, want: true},
+		{pattern: "nginx@sha256:*", summary: image.Summary{ID: "sha256:abc", RepoDigests: []string{"nginx@sha256:0123"}}, want: true},
+		{pattern: "sha256:abc", summary: image.Summary{ID: "sha256:abcdef"}, want: true},
+		{pattern: "abc", summary: image.Summary{ID: "sha256:abcdef"}, want: true},
+		{pattern: "nginx:*", summary: image.Summary{ID: "sha256:abc", RepoTags: []string{"redis:7"}}, want: false},
+		{pattern: "nginx", summary: image.Summary{ID: "sha256:abc", RepoTags: []string{"nginx:latest"}}, want: false},
+		{pattern: "def", summary: image.Summary{ID: "sha256:abcdef"}, want: false},
+	}
+
+	for _, test := range tests {
+		collector := &Collector{policy: Policy{Allowlist: []string{test.pattern}}}
+		if got := collector.allowed(test.summary); got != test.want {
+			t.Errorf("allowed(%q, %v) = %v, want %v", test.pattern, test.summary.RepoTags, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package imagepull
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"humpback-agent/internal/regcred"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+// Mirror 镜像源地址, Host可包含路径前缀, Timeout为0时不单独限制
+type Mirror struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// MirrorRule 仓库的镜像源规则, 原仓库拉取失败后按顺序尝试镜像源
+type MirrorRule struct {
+	Registry string
+	Timeout  time.Duration //原仓库的拉取超时, 为0时不单独限制
+	Mirrors  []Mirror
+}
+
+type candidate struct {
+	reference string
+	timeout   time.Duration
+	mirror    bool
+}
+
+// Puller 镜像拉取, 按仓库地址匹配凭据, 原仓库不可用时回退到镜像源
+type Puller struct {
+	client     *client.Client
+	registries *regcred.Manager
+	rules      map[string]MirrorRule
+}
+
+func NewPuller(client *client.Client, registries *regcred.Manager, rules []MirrorRule) *Puller {
+	puller := &Puller{
+		client:     client,
+		registries: registries,
+		rules:      make(map[string]MirrorRule),
+	}
+
+	for _, rule := range rules {
+		host := regcred.NormalizeHost(rule.Registry)
+		if host == "" {
+			continue
+		}
+
+		//镜像源地址需要能被识别为仓库地址, 否则会被当作docker hub上的镜像
+		mirrors := make([]Mirror, 0, len(rule.Mirrors))
+		for _, mirror := range rule.Mirrors {
+			mirror.Host = strings.TrimSuffix(trimScheme(mirror.Host), "/")
+			if !regcred.HasRegistry(mirror.Host + "/image") {
+				logrus.Warnf("registry %s mirror %s invalid, ignored", rule.Registry, mirror.Host)
+				continue
+			}
+			mirrors = append(mirrors, mirror)
+		}
+		rule.Mirrors = mirrors
+		puller.rules[host] = rule
+	}
+	return puller
+}
+
+// Pull 拉取镜像, options.RegistryAuth为空时使用凭据管理中匹配的凭据, 只用于原仓库
+// 从镜像源拉取成功后重新打上原镜像名称的标签, 容器配置中的镜像名称保持不变
+func (puller *Puller) Pull(ctx context.Context, imageName string, options image.PullOptions) error {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, candidate := range puller.candidates(named) {
+		candidateOptions := options
+		if candidate.mirror || candidateOptions.RegistryAuth == "" {
+			candidateOptions.RegistryAuth = puller.lookupAuth(candidate.reference)
+		}
+
+		if err = puller.pull(ctx, candidate, candidateOptions); err != nil {
+			logrus.Warnf("pull image %s error, %v", candidate.reference, err)
+			errs = append(errs, fmt.Errorf("%s: %w", candidate.reference, err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		if candidate.mirror {
+			return puller.retag(ctx, candidate.reference, imageName)
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// ResolveDigest 返回本地镜像的manifest digest, 从镜像源拉取的镜像使用镜像源的digest, 与原仓库相同; 本地构建时返回空
+func (puller *Puller) ResolveDigest(ctx context.Context, imageName string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return "", err
+	}
+
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical.Digest().String(), nil
+	}
+
+	imageInfo, _, err := puller.client.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		return "", err
+	}
+
+	names := puller.candidateNames(named)
+	for _, repoDigest := range imageInfo.RepoDigests {
+		repoNamed, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil || !names[repoNamed.Name()] {
+			continue
+		}
+		if canonical, ok := repoNamed.(reference.Canonical); ok {
+			return canonical.Digest().String(), nil
+		}
+	}
+	return "", nil
+}
+
+// RemoteDigest 查询镜像tag在仓库中当前的manifest digest, 原仓库不可用时查询镜像源,
+// 各节点按该digest拉取并创建容器, 不受本地缓存的旧镜像影响
+func (puller *Puller) RemoteDigest(ctx context.Context, imageName string, registryAuth string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return "", err
+	}
+
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical.Digest().String(), nil
+	}
+
+	var errs []error
+	for _, candidate := range puller.candidates(reference.TagNameOnly(named)) {
+		auth := registryAuth
+		if candidate.mirror || auth == "" {
+			auth = puller.lookupAuth(candidate.reference)
+		}
+
+		inspect, err := puller.distributionInspect(ctx, candidate, auth)
+		if err != nil {
+			logrus.Warnf("inspect image %s digest error, %v", candidate.reference, err)
+			errs = append(errs, fmt.Errorf("%s: %w", candidate.reference, err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		return inspect.Descriptor.Digest.String(), nil
+	}
+	return "", errors.Join(errs...)
+}
+
+// LocalReference 返回本地可用于创建容器的digest引用, 从镜像源拉取的镜像无法按原名称的digest引用,
+// 此时返回镜像源的digest引用, 两者的manifest相同
+func (puller *Puller) LocalReference(ctx context.Context, imageName string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := named.(reference.Canonical); !ok {
+		return "", fmt.Errorf("image %s is not a digest reference", imageName)
+	}
+
+	for _, candidate := range puller.candidates(named) {
+		if _, _, err = puller.client.ImageInspectWithRaw(ctx, candidate.reference); err == nil {
+			return candidate.reference, nil
+		}
+	}
+	return "", fmt.Errorf("image %s not found locally", imageName)
+}
+
+func (puller *Puller) candidateNames(named reference.Named) map[string]bool {
+	names := map[string]bool{}
+	for _, candidate := range puller.candidates(reference.TrimNamed(named)) {
+		if candidateNamed, err := reference.ParseNormalizedNamed(candidate.reference); err == nil {
+			names[candidateNamed.Name()] = true
+		}
+	}
+	return names
+}
+
+func (puller *Puller) candidates(named reference.Named) []candidate {
+	rule := puller.rules[regcred.NormalizeHost(reference.Domain(named))]
+	candidates := []candidate{{reference: reference.FamiliarString(named), timeout: rule.Timeout}}
+	suffix := strings.TrimPrefix(named.String(), named.Name())
+	for _, mirror := range rule.Mirrors {
+		candidates = append(candidates, candidate{
+			reference: mirror.Host + "/" + reference.Path(named) + suffix,
+			timeout:   mirror.Timeout,
+			mirror:    true,
+		})
+	}
+	return candidates
+}
+
+func (puller *Puller) distributionInspect(ctx context.Context, candidate candidate, registryAuth string) (registry.DistributionInspect, error) {
+	if candidate.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, candidate.timeout)
+		defer cancel()
+	}
+	return puller.client.DistributionInspect(ctx, candidate.reference, registryAuth)
+}
+
+func (puller *Puller) pull(ctx context.Context, candidate candidate, options image.PullOptions) error {
+	if candidate.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, candidate.timeout)
+		defer cancel()
+	}
+
+	out, err := puller.client.ImagePull(ctx, candidate.reference, options)
+	if err != nil {
+		return err
+	}
+
+	//读取完整个拉取进度流, 拉取失败时错误在流中返回
+	defer out.Close()
+	decoder := json.NewDecoder(out)
+	for {
+		message := struct {
+			Error string `json:"error"`
+		}{}
+		if err = decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if message.Error != "" {
+			return errors.New(message.Error)
+		}
+	}
+}
+
+// retag 镜像源拉取的镜像打上原名称标签后删除镜像源标签, 按digest引用的镜像无法打标签
+func (puller *Puller) retag(ctx context.Context, source string, target string) error {
+	named, err := reference.ParseNormalizedNamed(target)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := named.(reference.Canonical); ok {
+		if _, tagged := named.(reference.Tagged); !tagged {
+			//digest引用不能打标签, 保留镜像源的引用, 创建容器时通过LocalReference使用
+			logrus.Infof("image %s pulled from mirror %s", target, source)
+			return nil
+		}
+		named, _ = reference.WithTag(reference.TrimNamed(named), named.(reference.Tagged).Tag())
+	}
+
+	if err = puller.client.ImageTag(ctx, source, reference.FamiliarString(reference.TagNameOnly(named))); err != nil {
+		return err
+	}
+
+	if _, err = puller.client.ImageRemove(ctx, source, image.RemoveOptions{}); err != nil {
+		logrus.Warnf("remove mirror image tag %s error, %v", source, err)
+	}
+	logrus.Infof("image %s pulled from mirror %s", target, source)
+	return nil
+}
+
+func (puller *Puller) lookupAuth(imageName string) string {
+	authConfig, ok := puller.registries.Lookup(imageName)
+	if !ok {
+		return ""
+	}
+	authBytes, _ := json.Marshal(authConfig)
+	return base64.URLEncoding.EncodeToString(authBytes)
+}
+
+func trimScheme(server string) string {
+	if _, after, ok := strings.Cut(strings.TrimSpace(server), "://"); ok {
+		return after
+	}
+	return strings.TrimSpace(server)
+}
@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/stats"
+	"humpback-agent/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var containerLabels = []string{"container_id", "container_name", "service_id", "service_name", "group_id"}
+
+// containerCollector 从后台stats采样中读取容器指标, 抓取时不调用docker
+type containerCollector struct {
+	sampler        *stats.Sampler
+	cpuPercent     *prometheus.Desc
+	memoryUsage    *prometheus.Desc
+	memoryLimit    *prometheus.Desc
+	networkRxBytes *prometheus.Desc
+	networkTxBytes *prometheus.Desc
+	blockReadBytes *prometheus.Desc
+	blockWrite     *prometheus.Desc
+}
+
+func NewContainerCollector(sampler *stats.Sampler) prometheus.Collector {
+	networkLabels := append(append([]string{}, containerLabels...), "interface")
+	return &containerCollector{
+		sampler:        sampler,
+		cpuPercent:     prometheus.NewDesc("humpback_container_cpu_percent", "Container CPU usage percent.", containerLabels, nil),
+		memoryUsage:    prometheus.NewDesc("humpback_container_memory_usage_bytes", "Container memory usage in bytes.", containerLabels, nil),
+		memoryLimit:    prometheus.NewDesc("humpback_container_memory_limit_bytes", "Container memory limit in bytes.", containerLabels, nil),
+		networkRxBytes: prometheus.NewDesc("humpback_container_network_receive_bytes_total", "Container network received bytes.", networkLabels, nil),
+		networkTxBytes: prometheus.NewDesc("humpback_container_network_transmit_bytes_total", "Container network transmitted bytes.", networkLabels, nil),
+		blockReadBytes: prometheus.NewDesc("humpback_container_blkio_read_bytes_total", "Container block IO read bytes.", containerLabels, nil),
+		blockWrite:     prometheus.NewDesc("humpback_container_blkio_write_bytes_total", "Container block IO written bytes.", containerLabels, nil),
+	}
+}
+
+func (collector *containerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.cpuPercent
+	ch <- collector.memoryUsage
+	ch <- collector.memoryLimit
+	ch <- collector.networkRxBytes
+	ch <- collector.networkTxBytes
+	ch <- collector.blockReadBytes
+	ch <- collector.blockWrite
+}
+
+func (collector *containerCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, sample := range collector.sampler.Samples() {
+		labels := []string{
+			sample.ContainerId,
+			sample.ContainerName,
+			sample.Labels[v1model.ContainerLabelServiceId],
+			sample.Labels[v1model.ContainerLabelServiceName],
+			sample.Labels[v1model.ContainerLabelGroupId],
+		}
+		containerStats := sample.Stats
+		ch <- prometheus.MustNewConstMetric(collector.cpuPercent, prometheus.GaugeValue, containerStats.CPUPercent, labels...)
+		ch <- prometheus.MustNewConstMetric(collector.memoryUsage, prometheus.GaugeValue, float64(containerStats.MemoryUsageBytes), labels...)
+		ch <- prometheus.MustNewConstMetric(collector.memoryLimit, prometheus.GaugeValue, float64(containerStats.MemoryLimitBytes), labels...)
+		ch <- prometheus.MustNewConstMetric(collector.blockReadBytes, prometheus.CounterValue, float64(containerStats.DiskReadBytes), labels...)
+		ch <- prometheus.MustNewConstMetric(collector.blockWrite, prometheus.CounterValue, float64(containerStats.DiskWriteBytes), labels...)
+		for _, network := range containerStats.Networks {
+			networkLabels := append(append([]string{}, labels...), network.Name)
+			ch <- prometheus.MustNewConstMetric(collector.networkRxBytes, prometheus.CounterValue, float64(network.RxBytes), networkLabels...)
+			ch <- prometheus.MustNewConstMetric(collector.networkTxBytes, prometheus.CounterValue, float64(network.TxBytes), networkLabels...)
+		}
+	}
+}
+
+// hostCollector 输出最近一次心跳采集的主机信息
+type hostCollector struct {
+	hostInfo       func() *model.HostInfo
+	cpuUsage       *prometheus.Desc
+	cpuTotal       *prometheus.Desc
+	memoryTotal    *prometheus.Desc
+	memoryUsed     *prometheus.Desc
+	swapTotal      *prometheus.Desc
+	swapUsed       *prometheus.Desc
+	load           *prometheus.Desc
+	uptime         *prometheus.Desc
+	diskTotal      *prometheus.Desc
+	diskUsed       *prometheus.Desc
+	inodesTotal    *prometheus.Desc
+	inodesUsed     *prometheus.Desc
+	networkRxBytes *prometheus.Desc
+	networkTxBytes *prometheus.Desc
+}
+
+func NewHostCollector(hostInfo func() *model.HostInfo) prometheus.Collector {
+	return &hostCollector{
+		hostInfo:       hostInfo,
+		cpuUsage:       prometheus.NewDesc("humpback_host_cpu_usage_percent", "Host CPU usage percent.", nil, nil),
+		cpuTotal:       prometheus.NewDesc("humpback_host_cpu_count", "Host logical CPU count.", nil, nil),
+		memoryTotal:    prometheus.NewDesc("humpback_host_memory_total_bytes", "Host total memory in bytes.", nil, nil),
+		memoryUsed:     prometheus.NewDesc("humpback_host_memory_used_bytes", "Host used memory in bytes.", nil, nil),
+		swapTotal:      prometheus.NewDesc("humpback_host_swap_total_bytes", "Host total swap in bytes.", nil, nil),
+		swapUsed:       prometheus.NewDesc("humpback_host_swap_used_bytes", "Host used swap in bytes.", nil, nil),
+		load:           prometheus.NewDesc("humpback_host_load_average", "Host load average.", []string{"period"}, nil),
+		uptime:         prometheus.NewDesc("humpback_host_uptime_seconds", "Host uptime in seconds.", nil, nil),
+		diskTotal:      prometheus.NewDesc("humpback_host_disk_total_bytes", "Host filesystem size in bytes.", []string{"path"}, nil),
+		diskUsed:       prometheus.NewDesc("humpback_host_disk_used_bytes", "Host filesystem used bytes.", []string{"path"}, nil),
+		inodesTotal:    prometheus.NewDesc("humpback_host_disk_inodes_total", "Host filesystem inodes.", []string{"path"}, nil),
+		inodesUsed:     prometheus.NewDesc("humpback_host_disk_inodes_used", "Host filesystem used inodes.", []string{"path"}, nil),
+		networkRxBytes: prometheus.NewDesc("humpback_host_network_receive_bytes_total", "Host network interface received bytes.", []string{"interface"}, nil),
+		networkTxBytes: prometheus.NewDesc("humpback_host_network_transmit_bytes_total", "Host network interface transmitted bytes.", []string{"interface"}, nil),
+	}
+}
+
+func (collector *hostCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.cpuUsage
+	ch <- collector.cpuTotal
+	ch <- collector.memoryTotal
+	ch <- collector.memoryUsed
+	ch <- collector.swapTotal
+	ch <- collector.swapUsed
+	ch <- collector.load
+	ch <- collector.uptime
+	ch <- collector.diskTotal
+	ch <- collector.diskUsed
+	ch <- collector.inodesTotal
+	ch <- collector.inodesUsed
+	ch <- collector.networkRxBytes
+	ch <- collector.networkTxBytes
+}
+
+func (collector *hostCollector) Collect(ch chan<- prometheus.Metric) {
+	hostInfo := collector.hostInfo()
+	if hostInfo == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(collector.cpuUsage, prometheus.GaugeValue, float64(hostInfo.CPUUsage))
+	ch <- prometheus.MustNewConstMetric(collector.cpuTotal, prometheus.GaugeValue, float64(hostInfo.TotalCPU))
+	ch <- prometheus.MustNewConstMetric(collector.memoryTotal, prometheus.GaugeValue, float64(hostInfo.TotalMemory))
+	ch <- prometheus.MustNewConstMetric(collector.memoryUsed, prometheus.GaugeValue, float64(hostInfo.UsedMemory))
+	ch <- prometheus.MustNewConstMetric(collector.swapTotal, prometheus.GaugeValue, float64(hostInfo.TotalSwap))
+	ch <- prometheus.MustNewConstMetric(collector.swapUsed, prometheus.GaugeValue, float64(hostInfo.UsedSwap))
+	ch <- prometheus.MustNewConstMetric(collector.load, prometheus.GaugeValue, hostInfo.LoadAverage.Load1, "1m")
+	ch <- prometheus.MustNewConstMetric(collector.load, prometheus.GaugeValue, hostInfo.LoadAverage.Load5, "5m")
+	ch <- prometheus.MustNewConstMetric(collector.load, prometheus.GaugeValue, hostInfo.LoadAverage.Load15, "15m")
+	ch <- prometheus.MustNewConstMetric(collector.uptime, prometheus.GaugeValue, float64(hostInfo.Uptime))
+
+	disks := map[string]model.DiskUsage{}
+	for _, disk := range hostInfo.Disks {
+		disks[disk.Path] = disk
+	}
+	for _, disk := range []*model.DiskUsage{hostInfo.DockerRootDisk, hostInfo.VolumesRootDisk} {
+		if disk != nil {
+			disks[disk.Path] = *disk
+		}
+	}
+	for path, disk := range disks {
+		ch <- prometheus.MustNewConstMetric(collector.diskTotal, prometheus.GaugeValue, float64(disk.Total), path)
+		ch <- prometheus.MustNewConstMetric(collector.diskUsed, prometheus.GaugeValue, float64(disk.Used), path)
+		ch <- prometheus.MustNewConstMetric(collector.inodesTotal, prometheus.GaugeValue, float64(disk.InodesTotal), path)
+		ch <- prometheus.MustNewConstMetric(collector.inodesUsed, prometheus.GaugeValue, float64(disk.InodesUsed), path)
+	}
+
+	for _, network := range hostInfo.Networks {
+		ch <- prometheus.MustNewConstMetric(collector.networkRxBytes, prometheus.CounterValue, float64(network.RxBytes), network.Name)
+		ch <- prometheus.MustNewConstMetric(collector.networkTxBytes, prometheus.CounterValue, float64(network.TxBytes), network.Name)
+	}
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var apiVersionRegexp = regexp.MustCompile(`^v\d+\.\d+$`)
+
+// 资源集合级别的接口, 第二段不是对象ID
+var collectionActions = map[string]bool{
+	"containers/json":   true,
+	"containers/create": true,
+	"containers/prune":  true,
+	"images/json":       true,
+	"images/create":     true,
+	"images/search":     true,
+	"images/prune":      true,
+	"images/load":       true,
+	"images/get":        true,
+	"networks/create":   true,
+	"networks/prune":    true,
+	"volumes/create":    true,
+	"volumes/prune":     true,
+	"system/df":         true,
+	"build/prune":       true,
+}
+
+// 镜像名称可能包含'/', 只保留末尾的操作名
+var imageActions = map[string]bool{
+	"json":    true,
+	"history": true,
+	"push":    true,
+	"tag":     true,
+}
+
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+// InstrumentDockerTransport 记录每次docker API调用的耗时及错误
+func InstrumentDockerTransport(next http.RoundTripper) http.RoundTripper {
+	return &instrumentedTransport{next: next}
+}
+
+func (transport *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation := DockerOperation(req.Method, req.URL.Path)
+	begin := time.Now()
+	resp, err := transport.next.RoundTrip(req)
+	DockerRequestDuration.WithLabelValues(operation).Observe(time.Since(begin).Seconds())
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		DockerRequestErrors.WithLabelValues(operation).Inc()
+	}
+	return resp, err
+}
+
+// DockerOperation 将docker API请求路径归一为操作名称, 对象ID替换为{id}, 避免指标标签基数膨胀
+func DockerOperation(method string, path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 0 && apiVersionRegexp.MatchString(segments[0]) {
+		segments = segments[1:]
+	}
+
+	if len(segments) == 0 || segments[0] == "" {
+		return method + " /"
+	}
+
+	resource := segments[0]
+	if len(segments) == 1 {
+		return method + " /" + resource
+	}
+
+	if len(segments) == 2 && collectionActions[resource+"/"+segments[1]] {
+		return method + " /" + resource + "/" + segments[1]
+	}
+
+	operation := method + " /" + resource + "/{id}"
+	switch resource {
+	case "images", "distribution", "plugins":
+		if last := segments[len(segments)-1]; len(segments) > 2 && imageActions[last] {
+			operation += "/" + last
+		}
+		return operation
+	}
+
+	if len(segments) > 2 {
+		operation += "/" + strings.Join(segments[2:], "/")
+	}
+	return operation
+}
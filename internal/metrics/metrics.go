@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "humpback_agent"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	HeartbeatDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_duration_seconds",
+		Help:      "Latency of heartbeat requests sent to humpback server.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	HeartbeatFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_failures_total",
+		Help:      "Total number of failed heartbeat requests.",
+	})
+
+	DockerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "docker_request_duration_seconds",
+		Help:      "Latency of docker engine API calls by operation.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"operation"})
+
+	DockerRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "docker_request_errors_total",
+		Help:      "Total number of failed docker engine API calls by operation.",
+	}, []string{"operation"})
+
+	TaskQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "task_queue_depth",
+		Help:      "Number of in-flight agent operations by kind.",
+	}, []string{"kind"})
+
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Total number of scheduled job runs by job and result.",
+	}, []string{"job", "result"})
+
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of scheduled job runs.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200},
+	}, []string{"job"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HeartbeatDuration,
+		HeartbeatFailures,
+		DockerRequestDuration,
+		DockerRequestErrors,
+		TaskQueueDepth,
+		JobRuns,
+		JobDuration,
+	)
+}
+
+// Register 注册额外的指标采集器
+func Register(collector prometheus.Collector) error {
+	return registry.Register(collector)
+}
+
+// Handler Prometheus文本格式的指标输出
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+func ObserveJobRun(job string, result string, duration time.Duration) {
+	JobRuns.WithLabelValues(job, result).Inc()
+	JobDuration.WithLabelValues(job).Observe(duration.Seconds())
+}
+
+// RemoveJob job从调度器移除后清理其指标
+func RemoveJob(job string) {
+	JobRuns.DeletePartialMatch(prometheus.Labels{"job": job})
+	JobDuration.DeleteLabelValues(job)
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Server 独立监听地址上的指标服务, 不经过API鉴权, 建议只监听本地地址
+type Server struct {
+	svc *http.Server
+}
+
+func NewServer(address string) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return &Server{
+		svc: &http.Server{
+			Addr:              address,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func (server *Server) Startup() error {
+	listener, err := net.Listen("tcp", server.svc.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := server.svc.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Errorf("[Metrics] Server serve error, %s", err.Error())
+		}
+	}()
+	logrus.Infof("[Metrics] Server listening on [%s]...", server.svc.Addr)
+	return nil
+}
+
+func (server *Server) Stop(ctx context.Context) error {
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	return server.svc.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,351 @@
+package portalloc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"humpback-agent/model"
+	"humpback-agent/pkg/utils"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	allocatorFileName = "ports.json"
+	ProtocolTCP       = "tcp"
+	ProtocolUDP       = "udp"
+)
+
+var ErrNoFreePort = errors.New("no free port")
+
+// Range 端口范围, 包含Begin和End
+type Range struct {
+	Begin int
+	End   int
+}
+
+// ParseRange 解析 begin-end 格式的端口范围
+func ParseRange(value string) (Range, error) {
+	beginValue, endValue, ok := strings.Cut(strings.TrimSpace(value), "-")
+	if !ok {
+		return Range{}, fmt.Errorf("port range %s invalid", value)
+	}
+
+	begin, beginErr := strconv.Atoi(strings.TrimSpace(beginValue))
+	end, endErr := strconv.Atoi(strings.TrimSpace(endValue))
+	if beginErr != nil || endErr != nil || begin <= 0 || end > 65535 || begin > end {
+		return Range{}, fmt.Errorf("port range %s invalid", value)
+	}
+	return Range{Begin: begin, End: end}, nil
+}
+
+func (r Range) String() string {
+	return fmt.Sprintf("%d-%d", r.Begin, r.End)
+}
+
+// Port 容器绑定的主机端口
+type Port struct {
+	Protocol string
+	Port     int
+}
+
+// PortsFromContainer 容器绑定的主机端口, 停止的容器从HostConfig中获取配置的端口
+func PortsFromContainer(hostConfig *container.HostConfig, portMap nat.PortMap) []Port {
+	ports := []Port{}
+	seen := map[Port]struct{}{}
+	collect := func(bindings nat.PortMap) {
+		for containerPort, portBindings := range bindings {
+			for _, binding := range portBindings {
+				hostPort, err := strconv.Atoi(binding.HostPort)
+				if err != nil || hostPort <= 0 {
+					continue
+				}
+				port := Port{Protocol: containerPort.Proto(), Port: hostPort}
+				if _, ok := seen[port]; !ok {
+					seen[port] = struct{}{}
+					ports = append(ports, port)
+				}
+			}
+		}
+	}
+
+	if hostConfig != nil {
+		collect(hostConfig.PortBindings)
+	}
+	collect(portMap)
+	return ports
+}
+
+type binding struct {
+	ContainerId   string `json:"containerId,omitempty"`
+	ContainerName string `json:"containerName"`
+	ReservedAt    int64  `json:"reservedAt"`
+}
+
+// Allocator 主机端口分配器, 记录所有容器(包括停止的容器)绑定的端口,
+// TCP与UDP分别检查, 分配给尚未创建容器的预留持久化保存, 重启后不会重复分配
+type Allocator struct {
+	sync.Mutex
+	filePath       string
+	ranges         map[string]Range
+	reservationTTL time.Duration
+	bindings       map[Port]*binding
+}
+
+func NewAllocator(dataDirectory string, ranges map[string]Range, reservationTTL time.Duration) (*Allocator, error) {
+	for _, proto := range []string{ProtocolTCP, ProtocolUDP} {
+		if _, ok := ranges[proto]; !ok {
+			return nil, fmt.Errorf("%s port range is not configured", proto)
+		}
+	}
+
+	allocator := &Allocator{
+		filePath:       filepath.Join(dataDirectory, allocatorFileName),
+		ranges:         ranges,
+		reservationTTL: reservationTTL,
+		bindings:       make(map[Port]*binding),
+	}
+	if err := allocator.load(); err != nil {
+		return nil, err
+	}
+	return allocator, nil
+}
+
+// Allocate 为容器在协议对应的范围内分配一个空闲端口
+func (allocator *Allocator) Allocate(proto string, containerName string) (int, error) {
+	proto = normalizeProtocol(proto)
+	allocator.Lock()
+	defer allocator.Unlock()
+	portRange := allocator.ranges[proto]
+	size := portRange.End - portRange.Begin + 1
+	offset := rand.IntN(size)
+	for i := 0; i < size; i++ {
+		port := Port{Protocol: proto, Port: portRange.Begin + (offset+i)%size}
+		if _, used := allocator.bindings[port]; used || !isPortFree(port) {
+			continue
+		}
+		allocator.bindings[port] = &binding{ContainerName: containerName, ReservedAt: time.Now().UnixMilli()}
+		if err := allocator.save(); err != nil {
+			delete(allocator.bindings, port)
+			return 0, err
+		}
+		return port.Port, nil
+	}
+	return 0, fmt.Errorf("%w for %s in %s", ErrNoFreePort, proto, portRange)
+}
+
+// Reserve 为容器预留指定端口, 端口已被其他容器使用时返回错误
+func (allocator *Allocator) Reserve(proto string, port int, containerName string) error {
+	key := Port{Protocol: normalizeProtocol(proto), Port: port}
+	allocator.Lock()
+	defer allocator.Unlock()
+	if current, used := allocator.bindings[key]; used {
+		if current.ContainerName == containerName {
+			return nil
+		}
+		return fmt.Errorf("host port %d/%s is already used by container %s", port, key.Protocol, current.ContainerName)
+	}
+
+	allocator.bindings[key] = &binding{ContainerName: containerName, ReservedAt: time.Now().UnixMilli()}
+	if err := allocator.save(); err != nil {
+		delete(allocator.bindings, key)
+		return err
+	}
+	return nil
+}
+
+// ReleaseReserved 容器创建失败时释放为其预留且尚未绑定的端口
+func (allocator *Allocator) ReleaseReserved(containerName string) {
+	allocator.Lock()
+	defer allocator.Unlock()
+	changed := false
+	for port, current := range allocator.bindings {
+		if current.ContainerId == "" && current.ContainerName == containerName {
+			delete(allocator.bindings, port)
+			changed = true
+		}
+	}
+	if changed {
+		allocator.saveLogged()
+	}
+}
+
+// Bind 记录容器当前绑定的端口, 同名容器的预留转为绑定
+func (allocator *Allocator) Bind(containerId string, containerName string, ports []Port) {
+	containerName = strings.TrimPrefix(containerName, "/")
+	allocator.Lock()
+	defer allocator.Unlock()
+	allocator.bind(containerId, containerName, ports)
+	allocator.saveLogged()
+}
+
+// Release 容器删除后释放其绑定的端口
+func (allocator *Allocator) Release(containerId string) {
+	allocator.Lock()
+	defer allocator.Unlock()
+	changed := false
+	for port, current := range allocator.bindings {
+		if current.ContainerId == containerId {
+			delete(allocator.bindings, port)
+			changed = true
+		}
+	}
+	if changed {
+		allocator.saveLogged()
+	}
+}
+
+// Sync 按本地全部容器重建端口绑定, 保留未过期的预留
+func (allocator *Allocator) Sync(containers map[string][]Port, names map[string]string) {
+	allocator.Lock()
+	defer allocator.Unlock()
+	expireAt := time.Now().Add(-allocator.reservationTTL).UnixMilli()
+	for port, current := range allocator.bindings {
+		if current.ContainerId != "" || current.ReservedAt < expireAt {
+			delete(allocator.bindings, port)
+		}
+	}
+
+	for containerId, ports := range containers {
+		allocator.bind(containerId, strings.TrimPrefix(names[containerId], "/"), ports)
+	}
+	allocator.saveLogged()
+}
+
+// Ports 当前已分配的端口, 用于心跳上报
+func (allocator *Allocator) Ports() []model.AllocatedPort {
+	allocator.Lock()
+	defer allocator.Unlock()
+	ports := make([]model.AllocatedPort, 0, len(allocator.bindings))
+	for port, current := range allocator.bindings {
+		ports = append(ports, model.AllocatedPort{
+			Protocol:      port.Protocol,
+			Port:          port.Port,
+			ContainerId:   current.ContainerId,
+			ContainerName: current.ContainerName,
+			Reserved:      current.ContainerId == "",
+		})
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Port == ports[j].Port {
+			return ports[i].Protocol < ports[j].Protocol
+		}
+		return ports[i].Port < ports[j].Port
+	})
+	return ports
+}
+
+func (allocator *Allocator) bind(containerId string, containerName string, ports []Port) {
+	now := time.Now().UnixMilli()
+	current := make(map[Port]struct{}, len(ports))
+	for _, port := range ports {
+		current[port] = struct{}{}
+		allocator.bindings[port] = &binding{ContainerId: containerId, ContainerName: containerName, ReservedAt: now}
+	}
+
+	for port, item := range allocator.bindings {
+		if _, ok := current[port]; ok {
+			continue
+		}
+		//容器不再使用的端口以及已转为绑定的同名预留
+		if item.ContainerId == containerId || (item.ContainerId == "" && item.ContainerName == containerName) {
+			delete(allocator.bindings, port)
+		}
+	}
+}
+
+type persistedBinding struct {
+	Protocol string `json:"protocol"`
+	Port     int    `json:"port"`
+	binding
+}
+
+func (allocator *Allocator) load() error {
+	data, err := os.ReadFile(allocator.filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	persisted := []*persistedBinding{}
+	if err = json.Unmarshal(data, &persisted); err != nil {
+		return fmt.Errorf("parse port allocator file error, %w", err)
+	}
+
+	for _, item := range persisted {
+		current := item.binding
+		allocator.bindings[Port{Protocol: item.Protocol, Port: item.Port}] = &current
+	}
+	return nil
+}
+
+func (allocator *Allocator) save() error {
+	persisted := make([]*persistedBinding, 0, len(allocator.bindings))
+	for port, current := range allocator.bindings {
+		persisted = append(persisted, &persistedBinding{Protocol: port.Protocol, Port: port.Port, binding: *current})
+	}
+	sort.Slice(persisted, func(i, j int) bool {
+		if persisted[i].Port == persisted[j].Port {
+			return persisted[i].Protocol < persisted[j].Protocol
+		}
+		return persisted[i].Port < persisted[j].Port
+	})
+
+	data, err := json.MarshalIndent(persisted, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile := allocator.filePath + ".tmp"
+	if err = utils.WriteFileWithDir(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, allocator.filePath)
+}
+
+// saveLogged 容器状态同步时保存失败不影响内存中的记录, 下次变更时再次写入
+func (allocator *Allocator) saveLogged() {
+	if err := allocator.save(); err != nil {
+		logrus.Errorf("save port allocator error, %v", err)
+	}
+}
+
+func normalizeProtocol(proto string) string {
+	if strings.ToLower(proto) == ProtocolUDP {
+		return ProtocolUDP
+	}
+	return ProtocolTCP
+}
+
+func isPortFree(port Port) bool {
+	address := fmt.Sprintf(":%d", port.Port)
+	if port.Protocol == ProtocolUDP {
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
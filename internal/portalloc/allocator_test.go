@@ -0,0 +1,211 @@
+package portalloc
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"humpback-agent/model"
+)
+
+func newTestAllocator(t *testing.T, directory string, ttl time.Duration) *Allocator {
+	t.Helper()
+	ranges := map[string]Range{
+		ProtocolTCP: {Begin: 30000, End: 30009},
+		ProtocolUDP: {Begin: 30000, End: 30009},
+	}
+	allocator, err := NewAllocator(directory, ranges, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return allocator
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Range
+		ok    bool
+	}{
+		{value: "30000-32767", want: Range{Begin: 30000, End: 32767}, ok: true},
+		{value: " 80 - 80 ", want: Range{Begin: 80, End: 80}, ok: true},
+		{value: "1-65535", want: Range{Begin: 1, End: 65535}, ok: true},
+		{value: "30000", ok: false},
+		{value: "0-100", ok: false},
+		{value: "100-65536", ok: false},
+		{value: "200-100", ok: false},
+		{value: "a-b", ok: false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseRange(test.value)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseRange(%q) error = %v, want ok %v", test.value, err, test.ok)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseRange(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	allocator := newTestAllocator(t, t.TempDir(), time.Hour)
+	tests := []struct {
+		proto         string
+		port          int
+		containerName string
+		ok            bool
+	}{
+		{proto: "tcp", port: 8080, containerName: "web", ok: true},
+		{proto: "TCP", port: 8080, containerName: "web", ok: true},
+		{proto: "tcp", port: 8080, containerName: "api", ok: false},
+		{proto: "udp", port: 8080, containerName: "api", ok: true},
+		{proto: "", port: 8080, containerName: "api", ok: false},
+		{proto: "udp", port: 8080, containerName: "dns", ok: false},
+	}
+
+	for _, test := range tests {
+		err := allocator.Reserve(test.proto, test.port, test.containerName)
+		if (err == nil) != test.ok {
+			t.Errorf("Reserve(%q, %d, %q) error = %v, want ok %v", test.proto, test.port, test.containerName, err, test.ok)
+		}
+	}
+}
+
+func TestBindAndRelease(t *testing.T) {
+	directory := t.TempDir()
+	allocator := newTestAllocator(t, directory, time.Hour)
+	for _, port := range []int{8080, 8443} {
+		if err := allocator.Reserve(ProtocolTCP, port, "web"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := allocator.Reserve(ProtocolTCP, 9090, "api"); err != nil {
+		t.Fatal(err)
+	}
+
+	//同名容器的预留转为绑定, 未使用的预留随之删除
+	allocator.Bind("web-id", "/web", []Port{{Protocol: ProtocolTCP, Port: 8080}})
+	want := []model.AllocatedPort{
+		{Protocol: ProtocolTCP, Port: 8080, ContainerId: "web-id", ContainerName: "web"},
+		{Protocol: ProtocolTCP, Port: 9090, ContainerName: "api", Reserved: true},
+	}
+	if got := allocator.Ports(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Ports() after Bind = %+v, want %+v", got, want)
+	}
+
+	//已绑定的端口不会被ReleaseReserved释放
+	allocator.ReleaseReserved("web")
+	if got := allocator.Ports(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Ports() after ReleaseReserved = %+v, want %+v", got, want)
+	}
+
+	//重启后从文件恢复
+	reloaded := newTestAllocator(t, directory, time.Hour)
+	if got := reloaded.Ports(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Ports() after reload = %+v, want %+v", got, want)
+	}
+
+	//容器端口变化后不再使用的端口释放
+	allocator.Bind("web-id", "web", []Port{{Protocol: ProtocolUDP, Port: 8080}})
+	want = []model.AllocatedPort{
+		{Protocol: ProtocolUDP, Port: 8080, ContainerId: "web-id", ContainerName: "web"},
+		{Protocol: ProtocolTCP, Port: 9090, ContainerName: "api", Reserved: true},
+	}
+	if got := allocator.Ports(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Ports() after rebind = %+v, want %+v", got, want)
+	}
+
+	allocator.Release("web-id")
+	allocator.ReleaseReserved("api")
+	if got := allocator.Ports(); len(got) != 0 {
+		t.Fatalf("Ports() after release = %+v, want empty", got)
+	}
+}
+
+func TestSync(t *testing.T) {
+	directory := t.TempDir()
+	now := time.Now()
+	persisted := []*persistedBinding{
+		{Protocol: ProtocolTCP, Port: 8001, binding: binding{ContainerName: "fresh", ReservedAt: now.Add(-time.Minute).UnixMilli()}},
+		{Protocol: ProtocolTCP, Port: 8002, binding: binding{ContainerName: "expired", ReservedAt: now.Add(-time.Hour * 2).UnixMilli()}},
+		{Protocol: ProtocolTCP, Port: 8003, binding: binding{ContainerId: "removed-id", ContainerName: "removed", ReservedAt: now.UnixMilli()}},
+		{Protocol: ProtocolTCP, Port: 8004, binding: binding{ContainerId: "kept-id", ContainerName: "kept", ReservedAt: now.UnixMilli()}},
+	}
+	data, err := json.Marshal(persisted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(directory, allocatorFileName), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := newTestAllocator(t, directory, time.Hour)
+	allocator.Sync(map[string][]Port{
+		"kept-id": {{Protocol: ProtocolTCP, Port: 8004}},
+		"new-id":  {{Protocol: ProtocolUDP, Port: 8005}},
+	}, map[string]string{"kept-id": "/kept", "new-id": "/new"})
+
+	tests := []struct {
+		port    Port
+		exists  bool
+		id      string
+		name    string
+		comment string
+	}{
+		{port: Port{ProtocolTCP, 8001}, exists: true, name: "fresh", comment: "unexpired reservation"},
+		{port: Port{ProtocolTCP, 8002}, exists: false, comment: "expired reservation"},
+		{port: Port{ProtocolTCP, 8003}, exists: false, comment: "container no longer exists"},
+		{port: Port{ProtocolTCP, 8004}, exists: true, id: "kept-id", name: "kept", comment: "container still exists"},
+		{port: Port{ProtocolUDP, 8005}, exists: true, id: "new-id", name: "new", comment: "container found on sync"},
+	}
+	for _, test := range tests {
+		current, ok := allocator.bindings[test.port]
+		if ok != test.exists {
+			t.Errorf("%s: port %v exists = %v, want %v", test.comment, test.port, ok, test.exists)
+			continue
+		}
+		if ok && (current.ContainerId != test.id || current.ContainerName != test.name) {
+			t.Errorf("%s: port %v bound to %s/%s, want %s/%s", test.comment, test.port, current.ContainerId, current.ContainerName, test.id, test.name)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	freePort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	ranges := map[string]Range{
+		ProtocolTCP: {Begin: freePort, End: freePort},
+		ProtocolUDP: {Begin: 30000, End: 30009},
+	}
+	allocator, err := NewAllocator(t.TempDir(), ranges, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := allocator.Allocate(ProtocolTCP, "web")
+	if err != nil || port != freePort {
+		t.Fatalf("Allocate() = %d, %v, want %d", port, err, freePort)
+	}
+
+	//范围内的端口都已分配
+	if _, err = allocator.Allocate(ProtocolTCP, "api"); !errors.Is(err, ErrNoFreePort) {
+		t.Fatalf("Allocate() on exhausted range error = %v, want %v", err, ErrNoFreePort)
+	}
+
+	allocator.ReleaseReserved("web")
+	if port, err = allocator.Allocate(ProtocolTCP, "api"); err != nil || port != freePort {
+		t.Fatalf("Allocate() after release = %d, %v, want %d", port, err, freePort)
+	}
+}
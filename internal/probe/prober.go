@@ -0,0 +1,319 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/model"
+)
+
+const (
+	// 同时执行的探测数量上限
+	maxConcurrentProbes     = 16
+	scheduleTick            = time.Second
+	defaultInterval         = time.Second * 10
+	defaultTimeout          = time.Second * 3
+	defaultSuccessThreshold = 1
+	defaultFailureThreshold = 3
+)
+
+// Spec 解析后的探测配置
+type Spec struct {
+	probe            *v1model.ReadinessProbe
+	initialDelay     time.Duration
+	interval         time.Duration
+	timeout          time.Duration
+	successThreshold int
+	failureThreshold int
+}
+
+// ParseSpec 解析Humpback-ReadinessProbe标签, 没有配置时返回nil
+func ParseSpec(labels map[string]string) (*Spec, error) {
+	value, ok := labels[v1model.ContainerLabelReadiness]
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	readinessProbe := &v1model.ReadinessProbe{}
+	if err := json.Unmarshal([]byte(value), readinessProbe); err != nil {
+		return nil, err
+	}
+
+	if readinessProbe.Type != v1model.ProbeTypeHTTP && readinessProbe.Type != v1model.ProbeTypeTCP {
+		return nil, fmt.Errorf("unsupported readiness probe type %s", readinessProbe.Type)
+	}
+
+	if readinessProbe.Port == 0 {
+		return nil, errors.New("readiness probe port is empty")
+	}
+
+	if readinessProbe.Port > 65535 {
+		return nil, fmt.Errorf("readiness probe port %d invalid", readinessProbe.Port)
+	}
+
+	spec := &Spec{
+		probe:            readinessProbe,
+		interval:         defaultInterval,
+		timeout:          defaultTimeout,
+		successThreshold: defaultSuccessThreshold,
+		failureThreshold: defaultFailureThreshold,
+	}
+	for _, item := range []struct {
+		value  string
+		target *time.Duration
+	}{
+		{readinessProbe.InitialDelay, &spec.initialDelay},
+		{readinessProbe.Interval, &spec.interval},
+		{readinessProbe.Timeout, &spec.timeout},
+	} {
+		if item.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(item.value)
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("readiness probe duration %s invalid", item.value)
+		}
+		*item.target = duration
+	}
+
+	if spec.interval <= 0 {
+		spec.interval = defaultInterval
+	}
+	if spec.timeout <= 0 {
+		spec.timeout = defaultTimeout
+	}
+	if readinessProbe.SuccessThreshold > 0 {
+		spec.successThreshold = readinessProbe.SuccessThreshold
+	}
+	if readinessProbe.FailureThreshold > 0 {
+		spec.failureThreshold = readinessProbe.FailureThreshold
+	}
+	return spec, nil
+}
+
+// Port 探测的容器端口
+func (spec *Spec) Port() uint {
+	return spec.probe.Port
+}
+
+type target struct {
+	spec    *Spec
+	nextRun time.Time
+	running bool
+	info    model.ReadinessInfo
+}
+
+// Prober 按各容器的间隔执行就绪探测, 并发数有上限, 就绪状态变化时回调onChange
+type Prober struct {
+	sync.Mutex
+	targets    map[string]*target
+	httpClient *http.Client
+	limiter    chan struct{}
+	onChange   func(containerId string, ready bool)
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+func NewProber(onChange func(containerId string, ready bool)) *Prober {
+	return &Prober{
+		targets: make(map[string]*target),
+		httpClient: &http.Client{
+			//探测结果以第一个响应为准, 不跟随跳转
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Transport: &http.Transport{DisableKeepAlives: true},
+		},
+		limiter:  make(chan struct{}, maxConcurrentProbes),
+		onChange: onChange,
+	}
+}
+
+// Set 添加或更新容器的探测, 容器重启或地址变化时重新计算就绪状态
+func (prober *Prober) Set(containerId string, spec *Spec, address string) {
+	prober.Lock()
+	defer prober.Unlock()
+	if current, ok := prober.targets[containerId]; ok && current.info.Address == address {
+		current.spec = spec
+		return
+	}
+
+	prober.targets[containerId] = &target{
+		spec:    spec,
+		nextRun: time.Now().Add(spec.initialDelay),
+		info:    model.ReadinessInfo{Address: address},
+	}
+}
+
+func (prober *Prober) Remove(containerId string) {
+	prober.Lock()
+	defer prober.Unlock()
+	delete(prober.targets, containerId)
+}
+
+// Info 返回容器的就绪状态, 未配置探测时返回nil
+func (prober *Prober) Info(containerId string) *model.ReadinessInfo {
+	prober.Lock()
+	defer prober.Unlock()
+	if t, ok := prober.targets[containerId]; ok {
+		info := t.info
+		return &info
+	}
+	return nil
+}
+
+func (prober *Prober) Start(ctx context.Context) {
+	ctx, prober.cancel = context.WithCancel(ctx)
+	prober.wg.Add(1)
+	go func() {
+		defer prober.wg.Done()
+		ticker := time.NewTicker(scheduleTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				prober.schedule(ctx)
+			}
+		}
+	}()
+}
+
+// Stop 停止调度并等待执行中的探测结束
+func (prober *Prober) Stop() {
+	if prober.cancel != nil {
+		prober.cancel()
+		prober.wg.Wait()
+	}
+}
+
+func (prober *Prober) schedule(ctx context.Context) {
+	now := time.Now()
+	prober.Lock()
+	defer prober.Unlock()
+	for containerId, t := range prober.targets {
+		if t.running || now.Before(t.nextRun) {
+			continue
+		}
+
+		select {
+		case prober.limiter <- struct{}{}:
+		default:
+			//并发已满, 下一轮再调度
+			return
+		}
+
+		t.running = true
+		prober.wg.Add(1)
+		go func(containerId string, t *target, spec *Spec, address string) {
+			defer func() {
+				<-prober.limiter
+				prober.wg.Done()
+			}()
+			err := prober.probe(ctx, spec, address)
+			if ctx.Err() != nil {
+				return
+			}
+			prober.report(containerId, t, err)
+		}(containerId, t, t.spec, t.info.Address)
+	}
+}
+
+func (prober *Prober) report(containerId string, t *target, err error) {
+	prober.Lock()
+	now := time.Now()
+	t.running = false
+	t.nextRun = now.Add(t.spec.interval)
+	if current, ok := prober.targets[containerId]; !ok || current != t {
+		prober.Unlock()
+		return
+	}
+
+	ready := t.info.Ready
+	t.info.LastProbe = now.UnixMilli()
+	if err != nil {
+		t.info.LastError = err.Error()
+		t.info.ConsecutiveFailures++
+		t.info.ConsecutiveSuccesses = 0
+		if t.info.ConsecutiveFailures >= t.spec.failureThreshold {
+			t.info.Ready = false
+		}
+	} else {
+		t.info.LastError = ""
+		t.info.ConsecutiveSuccesses++
+		t.info.ConsecutiveFailures = 0
+		if t.info.ConsecutiveSuccesses >= t.spec.successThreshold {
+			t.info.Ready = true
+		}
+	}
+	changed := ready != t.info.Ready
+	ready = t.info.Ready
+	prober.Unlock()
+
+	if changed && prober.onChange != nil {
+		prober.onChange(containerId, ready)
+	}
+}
+
+func (prober *Prober) probe(ctx context.Context, spec *Spec, address string) error {
+	if address == "" {
+		return errors.New("container has no reachable address")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, spec.timeout)
+	defer cancel()
+	if spec.probe.Type == v1model.ProbeTypeTCP {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	path := spec.probe.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", address, path), nil)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range spec.probe.Headers {
+		if strings.EqualFold(key, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+
+	resp, err := prober.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if len(spec.probe.ExpectedStatus) > 0 {
+		if !slices.Contains(spec.probe.ExpectedStatus, resp.StatusCode) {
+			return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return nil
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
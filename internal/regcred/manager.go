@@ -0,0 +1,304 @@
+package regcred
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"humpback-agent/model"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dockerHubHost        = "docker.io"
+	dockerHubAuthServer  = "https://index.docker.io/v1/"
+	credentialHelperTime = 10 * time.Second
+	identityTokenUser    = "<token>"
+)
+
+// Credential 镜像仓库凭据
+type Credential struct {
+	Server   string
+	Username string
+	Password string
+}
+
+// Manager 镜像仓库凭据管理, 按镜像引用的仓库地址匹配凭据,
+// 优先级: Master下发 > config.yaml > 主机docker config.json
+type Manager struct {
+	sync.RWMutex
+	defaultRegistry  string
+	local            map[string]Credential
+	server           map[string]Credential
+	dockerConfigPath string
+	dockerConfig     *dockerConfigFile
+	dockerConfigTime time.Time
+}
+
+// NewManager defaultRegistry为空时不改写未指定仓库的镜像名称, dockerConfigPath为空时使用docker默认路径
+func NewManager(defaultRegistry string, local []Credential, dockerConfigPath string) *Manager {
+	if dockerConfigPath == "" {
+		dockerConfigPath = defaultDockerConfigPath()
+	}
+
+	manager := &Manager{
+		defaultRegistry:  strings.TrimSuffix(trimScheme(strings.TrimSpace(defaultRegistry)), "/"),
+		local:            make(map[string]Credential),
+		server:           make(map[string]Credential),
+		dockerConfigPath: dockerConfigPath,
+	}
+
+	for _, credential := range local {
+		if host := NormalizeHost(credential.Server); host != "" && credential.Username != "" {
+			manager.local[host] = credential
+		}
+	}
+	return manager
+}
+
+// DefaultRegistry 默认镜像仓库
+func (manager *Manager) DefaultRegistry() string {
+	return manager.defaultRegistry
+}
+
+// Qualify 未指定仓库的镜像名称加上默认仓库前缀
+func (manager *Manager) Qualify(image string) string {
+	if manager.defaultRegistry == "" || image == "" || HasRegistry(image) {
+		return image
+	}
+	return manager.defaultRegistry + "/" + image
+}
+
+// ParseImage 解析请求中的仓库地址与镜像名称, 镜像名称已包含仓库地址时忽略registryDomain, 都未指定时使用默认仓库
+func (manager *Manager) ParseImage(registryDomain string, image string) (reference.Named, error) {
+	registryDomain = strings.TrimSuffix(trimScheme(strings.TrimSpace(registryDomain)), "/")
+	image = strings.TrimSpace(image)
+	if registryDomain != "" && !HasRegistry(image) {
+		image = registryDomain + "/" + image
+	}
+	return reference.ParseNormalizedNamed(manager.Qualify(image))
+}
+
+// SetServerCredentials 替换Master下发的凭据
+func (manager *Manager) SetServerCredentials(credentials []model.RegistryCredential) {
+	server := make(map[string]Credential, len(credentials))
+	for _, credential := range credentials {
+		if host := NormalizeHost(credential.ServerAddress); host != "" && credential.Username != "" {
+			server[host] = Credential{Server: credential.ServerAddress, Username: credential.Username, Password: credential.Password}
+		}
+	}
+
+	manager.Lock()
+	manager.server = server
+	manager.Unlock()
+}
+
+// Lookup 按镜像引用的仓库地址查找凭据
+func (manager *Manager) Lookup(image string) (registry.AuthConfig, bool) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return registry.AuthConfig{}, false
+	}
+	return manager.LookupHost(reference.Domain(named))
+}
+
+// LookupHost 按仓库地址查找凭据
+func (manager *Manager) LookupHost(server string) (registry.AuthConfig, bool) {
+	host := NormalizeHost(server)
+	if host == "" {
+		return registry.AuthConfig{}, false
+	}
+
+	manager.RLock()
+	credential, ok := manager.server[host]
+	if !ok {
+		credential, ok = manager.local[host]
+	}
+	manager.RUnlock()
+	if ok {
+		return registry.AuthConfig{Username: credential.Username, Password: credential.Password, ServerAddress: authServerAddress(host)}, true
+	}
+	return manager.lookupDockerConfig(host)
+}
+
+func (manager *Manager) lookupDockerConfig(host string) (registry.AuthConfig, bool) {
+	config := manager.loadDockerConfig()
+	if config == nil {
+		return registry.AuthConfig{}, false
+	}
+
+	if helper := config.CredHelpers[host]; helper != "" {
+		return lookupCredentialHelper(helper, host)
+	}
+
+	for server, entry := range config.Auths {
+		if NormalizeHost(server) != host {
+			continue
+		}
+		if authConfig, ok := entry.authConfig(authServerAddress(host)); ok {
+			return authConfig, true
+		}
+	}
+
+	if config.CredsStore != "" {
+		return lookupCredentialHelper(config.CredsStore, host)
+	}
+	return registry.AuthConfig{}, false
+}
+
+// loadDockerConfig 文件修改后重新加载, 文件不存在时返回nil
+func (manager *Manager) loadDockerConfig() *dockerConfigFile {
+	fileInfo, err := os.Stat(manager.dockerConfigPath)
+	if err != nil {
+		return nil
+	}
+
+	manager.Lock()
+	defer manager.Unlock()
+	if manager.dockerConfig != nil && fileInfo.ModTime().Equal(manager.dockerConfigTime) {
+		return manager.dockerConfig
+	}
+
+	data, err := os.ReadFile(manager.dockerConfigPath)
+	if err != nil {
+		logrus.Warnf("read docker config %s error, %v", manager.dockerConfigPath, err)
+		return nil
+	}
+
+	config := &dockerConfigFile{}
+	if err = json.Unmarshal(data, config); err != nil {
+		logrus.Warnf("parse docker config %s error, %v", manager.dockerConfigPath, err)
+		return nil
+	}
+	manager.dockerConfig, manager.dockerConfigTime = config, fileInfo.ModTime()
+	return config
+}
+
+type dockerConfigFile struct {
+	Auths       map[string]dockerAuthEntry `json:"auths"`
+	CredsStore  string                     `json:"credsStore"`
+	CredHelpers map[string]string          `json:"credHelpers"`
+}
+
+type dockerAuthEntry struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+	RegistryToken string `json:"registrytoken"`
+}
+
+func (entry dockerAuthEntry) authConfig(serverAddress string) (registry.AuthConfig, bool) {
+	authConfig := registry.AuthConfig{
+		Username:      entry.Username,
+		Password:      entry.Password,
+		IdentityToken: entry.IdentityToken,
+		RegistryToken: entry.RegistryToken,
+		ServerAddress: serverAddress,
+	}
+
+	if entry.Auth != "" {
+		data, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return registry.AuthConfig{}, false
+		}
+		username, password, ok := strings.Cut(string(data), ":")
+		if !ok {
+			return registry.AuthConfig{}, false
+		}
+		authConfig.Username, authConfig.Password = username, password
+	}
+
+	if authConfig.Username == "" && authConfig.IdentityToken == "" && authConfig.RegistryToken == "" {
+		return registry.AuthConfig{}, false
+	}
+	return authConfig, true
+}
+
+// lookupCredentialHelper 调用 docker-credential-<helper> get 获取凭据
+func lookupCredentialHelper(helper string, host string) (registry.AuthConfig, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTime)
+	defer cancel()
+
+	serverAddress := authServerAddress(host)
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverAddress)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || !bytes.Contains(output, []byte("credentials not found")) {
+			logrus.Warnf("docker credential helper %s get %s error, %v", helper, host, err)
+		}
+		return registry.AuthConfig{}, false
+	}
+
+	result := struct {
+		Username string
+		Secret   string
+	}{}
+	if err = json.Unmarshal(output, &result); err != nil || result.Secret == "" {
+		return registry.AuthConfig{}, false
+	}
+
+	if result.Username == identityTokenUser {
+		return registry.AuthConfig{IdentityToken: result.Secret, ServerAddress: serverAddress}, true
+	}
+	return registry.AuthConfig{Username: result.Username, Password: result.Secret, ServerAddress: serverAddress}, true
+}
+
+func defaultDockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// HasRegistry 与docker规则一致, 第一段包含.或:或为localhost时视为仓库地址
+func HasRegistry(image string) bool {
+	first, _, ok := strings.Cut(image, "/")
+	if !ok {
+		return false
+	}
+	return strings.ContainsAny(first, ".:") || first == "localhost" || strings.ToLower(first) != first
+}
+
+// NormalizeHost 去掉协议和路径, docker hub的各种地址统一为docker.io
+func NormalizeHost(server string) string {
+	host, _, _ := strings.Cut(trimScheme(strings.TrimSpace(server)), "/")
+	host = strings.ToLower(host)
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return dockerHubHost
+	}
+	return host
+}
+
+func authServerAddress(host string) string {
+	if host == dockerHubHost {
+		return dockerHubAuthServer
+	}
+	return host
+}
+
+func trimScheme(server string) string {
+	if _, after, ok := strings.Cut(server, "://"); ok {
+		return after
+	}
+	return server
+}
@@ -0,0 +1,103 @@
+package regcred
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHasRegistry(t *testing.T) {
+	tests := map[string]bool{
+		"nginx":                           false,
+		"library/nginx:1.25":              false,
+		"team/app":                        false,
+		"registry.example.com/app":        true,
+		"registry.example.com:5000/app:1": true,
+		"localhost/app":                   true,
+		"localhost:5000/app":              true,
+		"10.0.0.1:5000/app":               true,
+		"Registry/app":                    true,
+	}
+
+	for image, want := range tests {
+		if got := HasRegistry(image); got != want {
+			t.Errorf("HasRegistry(%q) = %v, want %v", image, got, want)
+		}
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	tests := map[string]string{
+		"":                                     "",
+		"registry.example.com":                 "registry.example.com",
+		"https://registry.example.com/":        "registry.example.com",
+		"http://Registry.Example.com:5000/v2/": "registry.example.com:5000",
+		"localhost:5000":                       "localhost:5000",
+		"https://index.docker.io/v1/":          "docker.io",
+		"registry-1.docker.io":                 "docker.io",
+		"docker.io":                            "docker.io",
+	}
+
+	for server, want := range tests {
+		if got := NormalizeHost(server); got != want {
+			t.Errorf("NormalizeHost(%q) = %q, want %q", server, got, want)
+		}
+	}
+}
+
+func TestParseImage(t *testing.T) {
+	manager := NewManager("registry.example.com", nil, filepath.Join(t.TempDir(), "config.json"))
+	tests := []struct {
+		registryDomain string
+		image          string
+		want           string
+	}{
+		{image: "nginx", want: "registry.example.com/nginx"},
+		{registryDomain: "localhost:5000", image: "app:1", want: "localhost:5000/app:1"},
+		{registryDomain: "https://registry.other.com:5000/", image: "team/app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", want: "registry.other.com:5000/team/app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+		{registryDomain: "registry.other.com", image: "quay.io/team/app:1", want: "quay.io/team/app:1"},
+	}
+
+	for _, test := range tests {
+		named, err := manager.ParseImage(test.registryDomain, test.image)
+		if err != nil {
+			t.Errorf("ParseImage(%q, %q) error = %v", test.registryDomain, test.image, err)
+			continue
+		}
+		if got := named.String(); got != test.want {
+			t.Errorf("ParseImage(%q, %q) = %q, want %q", test.registryDomain, test.image, got, test.want)
+		}
+	}
+
+	if _, err := manager.ParseImage("", "Bad Name"); err == nil {
+		t.Error("ParseImage(invalid) error = nil")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dockerConfig := filepath.Join(t.TempDir(), "config.json")
+	data := `{"auths":{"https://index.docker.io/v1/":{"auth":"dXNlcjpwYTpzcw=="},"localhost:5000":{"username":"local","password":"secret"}}}`
+	if err := os.WriteFile(dockerConfig, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager("", []Credential{{Server: "https://registry.example.com:5000", Username: "config", Password: "secret"}}, dockerConfig)
+	tests := []struct {
+		image    string
+		username string
+		password string
+		found    bool
+	}{
+		{image: "nginx", username: "user", password: "pa:ss", found: true},
+		{image: "localhost:5000/app", username: "local", password: "secret", found: true},
+		{image: "registry.example.com:5000/app:1", username: "config", password: "secret", found: true},
+		{image: "registry.example.com/app", found: false},
+	}
+
+	for _, test := range tests {
+		authConfig, found := manager.Lookup(test.image)
+		if found != test.found || authConfig.Username != test.username || authConfig.Password != test.password {
+			t.Errorf("Lookup(%q) = %+v, %v", test.image, authConfig, found)
+		}
+	}
+}
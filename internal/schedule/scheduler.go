@@ -5,15 +5,22 @@ import (
 	"sync"
 	"time"
 
+	"humpback-agent/internal/credstore"
+	"humpback-agent/internal/imagepull"
+	"humpback-agent/internal/metrics"
+	"humpback-agent/internal/tracker"
+
 	"github.com/docker/docker/client"
 	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
 )
 
 const (
 	HumpbackJobRulesLabel      = "HUMPBACK_JOB_RULES"
 	HumpbackJobAlwaysPullLabel = "HUMPBACK_JOB_ALWAYS_PULL"
 	HumpbackJobMaxTimeoutLabel = "HUMPBACK_JOB_MAX_TIMEOUT"
-	HumpbackJobImageAuth       = "HUMPBACK_JOB_IMAGE_AUTH"
+	HumpbackJobImageAuth       = "HUMPBACK_JOB_IMAGE_AUTH" //旧版本的base64凭据, 只用于迁移
+	HumpbackJobImageAuthId     = "HUMPBACK_JOB_IMAGE_AUTH_ID"
 )
 
 const (
@@ -23,22 +30,28 @@ const (
 type TaskSchedulerInterface interface {
 	Start()
 	Stop()
-	AddContainer(containerId string, name string, image string, alwaysPull bool, rules []string, authStr string, timeout time.Duration) error
+	AddContainer(containerId string, name string, image string, alwaysPull bool, rules []string, authId string, timeout time.Duration) error
 	RemoveContainer(containerId string) error
 }
 
 type TaskScheduler struct {
 	sync.RWMutex
-	c      *cron.Cron
-	client *client.Client
-	tasks  map[cron.EntryID]*Task //entryId, *task
+	c           *cron.Cron
+	client      *client.Client
+	tracker     *tracker.Tracker
+	credentials *credstore.Store
+	puller      *imagepull.Puller
+	tasks       map[cron.EntryID]*Task //entryId, *task
 }
 
-func NewJobScheduler(client *client.Client) TaskSchedulerInterface {
+func NewJobScheduler(client *client.Client, tracker *tracker.Tracker, credentials *credstore.Store, puller *imagepull.Puller) TaskSchedulerInterface {
 	return &TaskScheduler{
-		c:      cron.New(),
-		client: client,
-		tasks:  make(map[cron.EntryID]*Task),
+		c:           cron.New(),
+		client:      client,
+		tracker:     tracker,
+		credentials: credentials,
+		puller:      puller,
+		tasks:       make(map[cron.EntryID]*Task),
 	}
 }
 
@@ -46,11 +59,12 @@ func (scheduler *TaskScheduler) Start() {
 	scheduler.c.Start()
 }
 
+// Stop 停止调度新的任务, 执行中的任务由tracker等待排空
 func (scheduler *TaskScheduler) Stop() {
 	scheduler.c.Stop()
 }
 
-func (scheduler *TaskScheduler) AddContainer(containerId string, name string, image string, alwaysPull bool, rules []string, authStr string, timeout time.Duration) error {
+func (scheduler *TaskScheduler) AddContainer(containerId string, name string, image string, alwaysPull bool, rules []string, authId string, timeout time.Duration) error {
 	scheduler.Lock()
 	defer scheduler.Unlock()
 	//同名的容器不能反复进入调度器, 因为可能是dockerEvent捕获到了task内部因AlwaysPull导致的容器替换reCreate
@@ -61,9 +75,15 @@ func (scheduler *TaskScheduler) AddContainer(containerId string, name string, im
 	}
 
 	for _, rule := range rules {
-		task := NewTask(containerId, name, image, alwaysPull, timeout, rule, authStr, scheduler.client)
+		task := NewTask(containerId, name, image, alwaysPull, timeout, rule, authId, scheduler.client, scheduler.credentials, scheduler.puller)
 		entryId, err := scheduler.c.AddFunc(rule, func() {
-			task.Execute() //根据rule定时执行这个任务
+			ctx, done, err := scheduler.tracker.Track(tracker.OperationJobExecute, task.Name)
+			if err != nil {
+				logrus.Warnf("container %s task [%s] skipped, %s", task.Name, task.Rule, err.Error())
+				return
+			}
+			defer done()
+			task.Execute(ctx) //根据rule定时执行这个任务
 		})
 
 		if err != nil {
@@ -81,6 +101,7 @@ func (scheduler *TaskScheduler) RemoveContainer(containerId string) error {
 		if task.ContainerId == containerId {
 			scheduler.c.Remove(entryId)
 			delete(scheduler.tasks, entryId)
+			metrics.RemoveJob(task.Name)
 		}
 	}
 	return nil
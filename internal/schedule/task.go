@@ -6,9 +6,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
+	"regexp"
 	"time"
 
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/credstore"
+	"humpback-agent/internal/imagepull"
+	"humpback-agent/internal/metrics"
+
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/registry"
 
@@ -18,6 +23,19 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const discardContainerSuffix = "-discard"
+
+var discardContainerNameRegexp = regexp.MustCompile(`^/?(.+)-\d+` + discardContainerSuffix + `$`)
+
+// ParseDiscardContainerName 解析reCreate过程中被重命名的废弃容器名称, 返回原容器名称
+func ParseDiscardContainerName(name string) (string, bool) {
+	matches := discardContainerNameRegexp.FindStringSubmatch(name)
+	if len(matches) != 2 {
+		return "", false
+	}
+	return matches[1], true
+}
+
 type Task struct {
 	ContainerId string
 	Name        string
@@ -27,10 +45,12 @@ type Task struct {
 	Rule        string
 	client      *client.Client
 	executing   bool
-	Auth        string
+	AuthId      string
+	credentials *credstore.Store
+	puller      *imagepull.Puller
 }
 
-func NewTask(containerId string, name string, image string, alwaysPull bool, timeout time.Duration, rule string, authStr string, client *client.Client) *Task {
+func NewTask(containerId string, name string, image string, alwaysPull bool, timeout time.Duration, rule string, authId string, client *client.Client, credentials *credstore.Store, puller *imagepull.Puller) *Task {
 	logrus.Infof("container %s task [%s] created.", name, rule)
 	return &Task{
 		ContainerId: containerId,
@@ -41,11 +61,20 @@ func NewTask(containerId string, name string, image string, alwaysPull bool, tim
 		Rule:        rule,
 		client:      client,
 		executing:   false,
-		Auth:        authStr,
+		AuthId:      authId,
+		credentials: credentials,
+		puller:      puller,
 	}
 }
 
-func (task *Task) Execute() {
+const (
+	jobResultSucceeded   = "succeeded"
+	jobResultFailed      = "failed"
+	jobResultTimeout     = "timeout"
+	jobResultInterrupted = "interrupted"
+)
+
+func (task *Task) Execute(ctx context.Context) {
 	if task.executing {
 		logrus.Warnf("container %s task [%s] currently executing", task.Name, task.Rule)
 		return
@@ -54,15 +83,21 @@ func (task *Task) Execute() {
 	logrus.Infof("container %s task [%s] start executing", task.Name, task.Rule)
 
 	task.executing = true
+	begin := time.Now()
+	result := jobResultFailed
+	defer func() {
+		metrics.ObserveJobRun(task.Name, result, time.Since(begin))
+	}()
+
 	reCreate := false
 	if task.AlwaysPull { //检查镜像是否需要重启拉取
-		currentImageId, err := task.getImageId()
+		currentImageId, err := task.getImageId(ctx)
 		if err != nil {
 			task.executing = false
 			return
 		}
 
-		newImageId, err := task.pullImage()
+		newImageId, err := task.pullImage(ctx)
 		if err != nil {
 			logrus.Errorf("container %s task [%s] pull image execute error, %v", task.Name, task.Rule, err)
 			task.executing = false
@@ -74,15 +109,17 @@ func (task *Task) Execute() {
 		}
 	}
 	if task.Timeout <= 0 {
-		if err := task.startContainer(context.Background(), reCreate); err != nil {
+		if err := task.startContainer(ctx, reCreate); err != nil {
 			logrus.Errorf("container %s task [%s] start container execute error, %v", task.Name, task.Rule, err)
+		} else {
+			result = jobResultSucceeded
 		}
 		task.executing = false
 		return
 	}
 
-	// 设置任务的最大执行时间（超时时间）
-	ctx, cancel := context.WithTimeout(context.Background(), task.Timeout)
+	// 设置任务的最大执行时间（超时时间）, Agent关闭排空超时后同样会取消
+	ctx, cancel := context.WithTimeout(ctx, task.Timeout)
 	defer func() {
 		cancel()
 		task.executing = false
@@ -98,45 +135,39 @@ func (task *Task) Execute() {
 	select {
 	case <-task.waitForContainerExit(ctx): // 等待容器完成任务
 		logrus.Infof("container %s task [%s] executed.", task.Name, task.Rule)
+		result = jobResultSucceeded
 	case <-ctx.Done(): // 容器执行超时
-		logrus.Infof("container %s task [%s] executing timeout.", task.Name, task.Rule)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			logrus.Warnf("container %s task [%s] executing interrupted by agent shutdown.", task.Name, task.Rule)
+			result = jobResultInterrupted
+		} else {
+			logrus.Infof("container %s task [%s] executing timeout.", task.Name, task.Rule)
+			result = jobResultTimeout
+		}
 		task.stopContainer()
 	}
 }
 
-func (task *Task) getImageId() (string, error) {
-	imageInfo, _, err := task.client.ImageInspectWithRaw(context.Background(), task.Image)
+func (task *Task) getImageId(ctx context.Context) (string, error) {
+	imageInfo, _, err := task.client.ImageInspectWithRaw(ctx, task.Image)
 	if err != nil {
 		return "", err
 	}
 	return imageInfo.ID, nil
 }
 
-func (task *Task) pullImage() (string, error) {
-
+func (task *Task) pullImage(ctx context.Context) (string, error) {
 	authStr := ""
-	if task.Auth != "" {
-
-		decodedBytes, err := base64.StdEncoding.DecodeString(task.Auth)
+	if task.AuthId != "" {
+		credential, err := task.credentials.Get(task.AuthId)
 		if err != nil {
 			return "", err
 		}
-		decodedStr := string(decodedBytes)
-
-		// 按 ^^ 分割字符串
-		parts := strings.Split(decodedStr, "^^")
-		if len(parts) != 3 {
-			return "", errors.New("image auth config invalid")
-		}
-
-		username := parts[0]
-		password := parts[1]
-		address := parts[2]
 
 		authConfig := registry.AuthConfig{
-			Username:      username,
-			Password:      password,
-			ServerAddress: address,
+			Username:      credential.Username,
+			Password:      credential.Password,
+			ServerAddress: credential.Registry,
 		}
 
 		authBytes, _ := json.Marshal(authConfig)
@@ -148,18 +179,16 @@ func (task *Task) pullImage() (string, error) {
 		RegistryAuth: authStr,
 	}
 
-	out, err := task.client.ImagePull(context.Background(), task.Image, pullOptions)
-	if err != nil {
+	if err := task.puller.Pull(ctx, task.Image, pullOptions); err != nil {
 		return "", err
 	}
-
-	out.Close()
-	return task.getImageId()
+	return task.getImageId(ctx)
 }
 
 func (task *Task) startContainer(ctx context.Context, reCreate bool) error {
 	if reCreate {
-		if err := task.reCreateContainer(); err != nil {
+		//重命名、创建、删除必须完整执行, 不响应取消, 避免残留-discard容器
+		if err := task.reCreateContainer(context.WithoutCancel(ctx)); err != nil {
 			return err
 		}
 	}
@@ -194,33 +223,66 @@ func (task *Task) stopContainer() error {
 	return err
 }
 
-func (task *Task) reCreateContainer() error {
-	originContainerInfo, err := task.client.ContainerInspect(context.Background(), task.ContainerId)
+func (task *Task) reCreateContainer(ctx context.Context) error {
+	imageDigest, err := task.puller.ResolveDigest(ctx, task.Image)
 	if err != nil {
 		return err
 	}
 
-	discardContainerName := fmt.Sprintf("%s-%d-discard", originContainerInfo.Name, time.Now().Unix())
-	//先将当前容器名称修改为废弃名称
-	if err := task.client.ContainerRename(context.Background(), task.ContainerId, discardContainerName); err != nil {
-		logrus.Errorf("container %s rename to %s error, always pull recreate give up. %s.", originContainerInfo.Name, discardContainerName, err.Error())
+	containerId, err := RecreateContainer(ctx, task.client, task.ContainerId, func(config *container.Config) {
+		//重新拉取后镜像digest已变化
+		if imageDigest != "" {
+			config.Labels[v1model.ContainerLabelImageDigest] = imageDigest
+		} else {
+			delete(config.Labels, v1model.ContainerLabelImageDigest)
+		}
+
+		//旧版本凭据标签在重建时改写为凭据ID
+		if _, ok := config.Labels[HumpbackJobImageAuth]; ok {
+			delete(config.Labels, HumpbackJobImageAuth)
+			if task.AuthId != "" {
+				config.Labels[HumpbackJobImageAuthId] = task.AuthId
+			}
+		}
+	})
+	if err != nil {
 		return err
 	}
+	task.ContainerId = containerId
+	return nil
+}
+
+// RecreateContainer 按原容器配置重建同名容器并删除原容器, configure可在创建前修改容器配置
+func RecreateContainer(ctx context.Context, client *client.Client, containerId string, configure func(config *container.Config)) (string, error) {
+	originContainerInfo, err := client.ContainerInspect(ctx, containerId)
+	if err != nil {
+		return "", err
+	}
+
+	discardContainerName := fmt.Sprintf("%s-%d%s", originContainerInfo.Name, time.Now().Unix(), discardContainerSuffix)
+	//先将当前容器名称修改为废弃名称
+	if err := client.ContainerRename(ctx, containerId, discardContainerName); err != nil {
+		logrus.Errorf("container %s rename to %s error, recreate give up. %s.", originContainerInfo.Name, discardContainerName, err.Error())
+		return "", err
+	}
 
 	networkingConfig := &network.NetworkingConfig{
 		EndpointsConfig: originContainerInfo.NetworkSettings.Networks,
 	}
 
-	containerInfo, err := task.client.ContainerCreate(context.Background(), originContainerInfo.Config, originContainerInfo.HostConfig, networkingConfig, nil, originContainerInfo.Name)
+	if configure != nil {
+		configure(originContainerInfo.Config)
+	}
+
+	containerInfo, err := client.ContainerCreate(ctx, originContainerInfo.Config, originContainerInfo.HostConfig, networkingConfig, nil, originContainerInfo.Name)
 	if err != nil {
-		logrus.Errorf("container %s always pull recreate error, %s.", originContainerInfo.Name, err.Error())
-		task.client.ContainerRename(context.Background(), task.ContainerId, originContainerInfo.Name) //老容器还原名称
-		return err
+		logrus.Errorf("container %s recreate error, %s.", originContainerInfo.Name, err.Error())
+		client.ContainerRename(ctx, containerId, originContainerInfo.Name) //老容器还原名称
+		return "", err
 	}
 
 	//删除老容器
-	task.ContainerId = containerInfo.ID
-	task.client.ContainerRemove(context.Background(), originContainerInfo.ID, container.RemoveOptions{Force: true})
+	client.ContainerRemove(ctx, originContainerInfo.ID, container.RemoveOptions{Force: true})
 	logrus.Infof("container %s recreated succeed.", originContainerInfo.Name)
-	return nil
+	return containerInfo.ID, nil
 }
@@ -0,0 +1,186 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const secretFileMode = 0400
+
+var (
+	ErrNotTmpfs    = errors.New("secrets root directory is not on tmpfs")
+	ErrUnavailable = errors.New("secrets unavailable on this node")
+
+	idRegexp   = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+)
+
+// Store 容器secret的本地存储, 每个容器一个目录, 以标签中的随机ID命名,
+// 目录位于tmpfs上, 文件权限为0400, 容器删除后整个目录清除
+type Store struct {
+	sync.Mutex
+	rootDirectory string
+	unavailable   error
+}
+
+// NewStore 创建secret根目录, requireTmpfs为true时根目录必须位于tmpfs,
+// 根目录不可用时不影响agent启动, 只有使用secret的请求失败
+func NewStore(rootDirectory string, requireTmpfs bool) *Store {
+	store := &Store{rootDirectory: rootDirectory}
+	if err := checkRootDirectory(rootDirectory, requireTmpfs); err != nil {
+		store.unavailable = fmt.Errorf("%w, %v", ErrUnavailable, err)
+	}
+	return store
+}
+
+func checkRootDirectory(rootDirectory string, requireTmpfs bool) error {
+	if err := os.MkdirAll(rootDirectory, 0700); err != nil {
+		return err
+	}
+
+	if requireTmpfs {
+		var statfs unix.Statfs_t
+		if err := unix.Statfs(rootDirectory, &statfs); err != nil {
+			return err
+		}
+		if statfs.Type != unix.TMPFS_MAGIC {
+			return fmt.Errorf("%w, %s", ErrNotTmpfs, rootDirectory)
+		}
+	}
+	return nil
+}
+
+// Available 根目录不可用时返回原因, agent以容器运行时需要挂载主机tmpfs上的同名目录
+func (store *Store) Available() error {
+	return store.unavailable
+}
+
+// NewId 生成容器secret目录ID, 标签中只保存该ID
+func NewId() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ValidName secret名称同时作为文件名, 只允许安全字符
+func ValidName(name string) bool {
+	return nameRegexp.MatchString(name)
+}
+
+// Path secret在主机上的文件路径
+func (store *Store) Path(id string, name string) string {
+	return filepath.Join(store.rootDirectory, id, name)
+}
+
+// Exists secret文件是否存在, 主机重启后tmpfs上的文件会丢失
+func (store *Store) Exists(id string, name string) bool {
+	_, err := os.Stat(store.Path(id, name))
+	return err == nil
+}
+
+// Write 写入secret文件, 文件属主为uid/gid, 权限0400
+func (store *Store) Write(id string, name string, data []byte, uid int, gid int) (string, error) {
+	if store.unavailable != nil {
+		return "", store.unavailable
+	}
+
+	if !idRegexp.MatchString(id) {
+		return "", fmt.Errorf("secret id %s invalid", id)
+	}
+
+	if !ValidName(name) {
+		return "", fmt.Errorf("secret name %s invalid", name)
+	}
+
+	store.Lock()
+	defer store.Unlock()
+	directory := filepath.Join(store.rootDirectory, id)
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return "", err
+	}
+
+	filePath := filepath.Join(directory, name)
+	tmpFile, err := os.CreateTemp(directory, "."+name+".*")
+	if err != nil {
+		return "", err
+	}
+
+	tmpName := tmpFile.Name()
+	if err = writeSecret(tmpFile, data, uid, gid); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+
+	if err = os.Rename(tmpName, filePath); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+	return filePath, nil
+}
+
+func writeSecret(file *os.File, data []byte, uid int, gid int) error {
+	defer file.Close()
+	if err := file.Chmod(secretFileMode); err != nil {
+		return err
+	}
+	if err := file.Chown(uid, gid); err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Remove 清除容器的secret目录
+func (store *Store) Remove(id string) error {
+	if !idRegexp.MatchString(id) {
+		return nil
+	}
+
+	store.Lock()
+	defer store.Unlock()
+	return os.RemoveAll(filepath.Join(store.rootDirectory, id))
+}
+
+// Collect 清除没有容器使用的secret目录, 返回清除的数量
+func (store *Store) Collect(inUse map[string]struct{}) (int, error) {
+	if store.unavailable != nil {
+		return 0, nil
+	}
+
+	entries, err := os.ReadDir(store.rootDirectory)
+	if err != nil {
+		return 0, err
+	}
+
+	store.Lock()
+	defer store.Unlock()
+	removed := 0
+	var errs []error
+	for _, entry := range entries {
+		id := entry.Name()
+		if !entry.IsDir() || !idRegexp.MatchString(id) {
+			continue
+		}
+		if _, ok := inUse[id]; ok {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(store.rootDirectory, id)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,184 @@
+package stats
+
+import (
+	"math"
+	"time"
+
+	"humpback-agent/model"
+)
+
+const (
+	// 单次查询返回的最大点数, 超出时自动放大step
+	maxSeriesPoints = 1000
+)
+
+// ring 固定容量的环形缓冲, 按时间顺序保存容器stats
+type ring struct {
+	points []*model.ContainerStatsPoint
+	next   int
+	full   bool
+}
+
+func newRing(capacity int) *ring {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &ring{points: make([]*model.ContainerStatsPoint, capacity)}
+}
+
+func (r *ring) push(point *model.ContainerStatsPoint) {
+	r.points[r.next] = point
+	r.next = (r.next + 1) % len(r.points)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *ring) last() *model.ContainerStatsPoint {
+	if !r.full && r.next == 0 {
+		return nil
+	}
+	return r.points[(r.next-1+len(r.points))%len(r.points)]
+}
+
+// between 返回[from, to]内的点, 按时间升序
+func (r *ring) between(from int64, to int64) []*model.ContainerStatsPoint {
+	start, count := 0, r.next
+	if r.full {
+		start, count = r.next, len(r.points)
+	}
+
+	points := []*model.ContainerStatsPoint{}
+	for i := 0; i < count; i++ {
+		point := r.points[(start+i)%len(r.points)]
+		if point.Timestamp >= from && point.Timestamp <= to {
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+// downsample 将点按step分桶, CPU与内存取平均, 累计值取桶内最后一个
+func downsample(points []*model.ContainerStatsPoint, from int64, step int64) []*model.ContainerStatsPoint {
+	series := []*model.ContainerStatsPoint{}
+	var (
+		bucket     *model.ContainerStatsPoint
+		bucketId   int64 = -1
+		count      int
+		cpuSum     float64
+		memorySum  float64
+		flushPoint = func() {
+			if bucket != nil {
+				bucket.CPUPercent = math.Round(cpuSum/float64(count)*100) / 100
+				bucket.MemoryUsageBytes = uint64(memorySum / float64(count))
+				series = append(series, bucket)
+			}
+		}
+	)
+
+	for _, point := range points {
+		id := (point.Timestamp - from) / step
+		if id != bucketId {
+			flushPoint()
+			bucketId, count, cpuSum, memorySum = id, 0, 0, 0
+			bucket = &model.ContainerStatsPoint{Timestamp: from + id*step}
+		}
+		count++
+		cpuSum += point.CPUPercent
+		memorySum += float64(point.MemoryUsageBytes)
+		bucket.MemoryLimitBytes = point.MemoryLimitBytes
+		bucket.NetworkRxBytes = point.NetworkRxBytes
+		bucket.NetworkTxBytes = point.NetworkTxBytes
+		bucket.DiskReadBytes = point.DiskReadBytes
+		bucket.DiskWriteBytes = point.DiskWriteBytes
+	}
+	flushPoint()
+	return series
+}
+
+func summarize(points []*model.ContainerStatsPoint) *model.ContainerStatsSummary {
+	if len(points) == 0 {
+		return nil
+	}
+
+	summary := &model.ContainerStatsSummary{
+		From:             points[0].Timestamp,
+		To:               points[len(points)-1].Timestamp,
+		Samples:          len(points),
+		CPUPercent:       model.StatsRange{Min: math.MaxFloat64},
+		MemoryUsageBytes: model.StatsRange{Min: math.MaxFloat64},
+	}
+	for _, point := range points {
+		accumulate(&summary.CPUPercent, point.CPUPercent)
+		accumulate(&summary.MemoryUsageBytes, float64(point.MemoryUsageBytes))
+	}
+	summary.CPUPercent.Avg = math.Round(summary.CPUPercent.Avg/float64(len(points))*100) / 100
+	summary.MemoryUsageBytes.Avg = math.Round(summary.MemoryUsageBytes.Avg / float64(len(points)))
+	return summary
+}
+
+// accumulate Avg先累加求和, 由调用方求平均
+func accumulate(statsRange *model.StatsRange, value float64) {
+	statsRange.Min = math.Min(statsRange.Min, value)
+	statsRange.Max = math.Max(statsRange.Max, value)
+	statsRange.Avg += value
+}
+
+// History 查询容器[from, to]内的stats序列, step不大于采样间隔时返回原始点
+func (sampler *Sampler) History(containerId string, from time.Time, to time.Time, step time.Duration) (*model.ContainerStatsSeries, bool) {
+	sampler.RLock()
+	history, ok := sampler.history[containerId]
+	var points []*model.ContainerStatsPoint
+	if ok {
+		points = history.between(from.UnixMilli(), to.UnixMilli())
+	}
+	sampler.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	if step < sampler.interval {
+		step = sampler.interval
+	}
+	if minStep := to.Sub(from) / maxSeriesPoints; step < minStep {
+		step = minStep
+	}
+
+	series := &model.ContainerStatsSeries{
+		ContainerId: containerId,
+		From:        from.UnixMilli(),
+		To:          to.UnixMilli(),
+		Step:        step.Milliseconds(),
+		Points:      points,
+	}
+	if step > sampler.interval {
+		series.Points = downsample(points, series.From, series.Step)
+	}
+	return series, true
+}
+
+// Summary 返回容器保留窗口内stats的min/avg/max, 没有历史时返回nil
+func (sampler *Sampler) Summary(containerId string) *model.ContainerStatsSummary {
+	sampler.RLock()
+	defer sampler.RUnlock()
+	history, ok := sampler.history[containerId]
+	if !ok {
+		return nil
+	}
+	return summarize(history.between(math.MinInt64, math.MaxInt64))
+}
+
+// ClampWindow 查询窗口的from未指定或早于保留窗口时从保留窗口开始, 避免时间跨度过大导致降采样步长溢出
+func (sampler *Sampler) ClampWindow(from time.Time, to time.Time) (time.Time, time.Time) {
+	return clampWindow(from, to, time.Now().Add(-sampler.retention))
+}
+
+func clampWindow(from time.Time, to time.Time, oldest time.Time) (time.Time, time.Time) {
+	if from.Before(oldest) {
+		from = oldest
+	}
+	if to.Before(from) {
+		from = to
+	}
+	return from, to
+}
@@ -0,0 +1,168 @@
+package stats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"humpback-agent/model"
+)
+
+func timestamps(points []*model.ContainerStatsPoint) []int64 {
+	values := []int64{}
+	for _, point := range points {
+		values = append(values, point.Timestamp)
+	}
+	return values
+}
+
+func TestRing(t *testing.T) {
+	tests := []struct {
+		capacity int
+		pushes   int
+		from     int64
+		to       int64
+		want     []int64
+		last     int64
+	}{
+		{capacity: 3, pushes: 0, from: math.MinInt64, to: math.MaxInt64, want: []int64{}},
+		{capacity: 3, pushes: 2, from: math.MinInt64, to: math.MaxInt64, want: []int64{1, 2}, last: 2},
+		{capacity: 3, pushes: 3, from: math.MinInt64, to: math.MaxInt64, want: []int64{1, 2, 3}, last: 3},
+		//写满后覆盖最旧的点, 仍按时间升序返回
+		{capacity: 3, pushes: 5, from: math.MinInt64, to: math.MaxInt64, want: []int64{3, 4, 5}, last: 5},
+		{capacity: 3, pushes: 7, from: 5, to: 6, want: []int64{5, 6}, last: 7},
+		{capacity: 0, pushes: 2, from: math.MinInt64, to: math.MaxInt64, want: []int64{2}, last: 2},
+	}
+
+	for _, test := range tests {
+		r := newRing(test.capacity)
+		for i := 1; i <= test.pushes; i++ {
+			r.push(&model.ContainerStatsPoint{Timestamp: int64(i)})
+		}
+
+		if got := timestamps(r.between(test.from, test.to)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ring(%d) after %d pushes between(%d, %d) = %v, want %v", test.capacity, test.pushes, test.from, test.to, got, test.want)
+		}
+
+		last := r.last()
+		if test.pushes == 0 {
+			if last != nil {
+				t.Errorf("ring(%d) empty last() = %+v, want nil", test.capacity, last)
+			}
+			continue
+		}
+		if last == nil || last.Timestamp != test.last {
+			t.Errorf("ring(%d) after %d pushes last() = %+v, want %d", test.capacity, test.pushes, last, test.last)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	points := []*model.ContainerStatsPoint{
+		{Timestamp: 1000, CPUPercent: 10, MemoryUsageBytes: 100, NetworkRxBytes: 1},
+		{Timestamp: 2000, CPUPercent: 20, MemoryUsageBytes: 300, NetworkRxBytes: 2},
+		{Timestamp: 6000, CPUPercent: 33.333, MemoryUsageBytes: 500, NetworkRxBytes: 3},
+		{Timestamp: 14000, CPUPercent: 1, MemoryUsageBytes: 50, NetworkRxBytes: 4, MemoryLimitBytes: 1024},
+	}
+
+	want := []*model.ContainerStatsPoint{
+		{Timestamp: 0, CPUPercent: 15, MemoryUsageBytes: 200, NetworkRxBytes: 2},
+		{Timestamp: 5000, CPUPercent: 33.33, MemoryUsageBytes: 500, NetworkRxBytes: 3},
+		{Timestamp: 10000, CPUPercent: 1, MemoryUsageBytes: 50, NetworkRxBytes: 4, MemoryLimitBytes: 1024},
+	}
+	if got := downsample(points, 0, 5000); !reflect.DeepEqual(got, want) {
+		t.Fatalf("downsample() = %+v, want %+v", got, want)
+	}
+
+	if got := downsample(nil, 0, 5000); len(got) != 0 {
+		t.Fatalf("downsample(nil) = %+v, want empty", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	if summary := summarize(nil); summary != nil {
+		t.Fatalf("summarize(nil) = %+v, want nil", summary)
+	}
+
+	points := []*model.ContainerStatsPoint{
+		{Timestamp: 1000, CPUPercent: 10, MemoryUsageBytes: 100},
+		{Timestamp: 2000, CPUPercent: 50, MemoryUsageBytes: 400},
+		{Timestamp: 3000, CPUPercent: 0.5, MemoryUsageBytes: 101},
+	}
+	want := &model.ContainerStatsSummary{
+		From:             1000,
+		To:               3000,
+		Samples:          3,
+		CPUPercent:       model.StatsRange{Min: 0.5, Avg: 20.17, Max: 50},
+		MemoryUsageBytes: model.StatsRange{Min: 100, Avg: 200, Max: 400},
+	}
+	if got := summarize(points); !reflect.DeepEqual(got, want) {
+		t.Fatalf("summarize() = %+v, want %+v", got, want)
+	}
+}
+
+func TestClampWindow(t *testing.T) {
+	now := time.Now()
+	oldest := now.Add(-time.Hour)
+	tests := []struct {
+		from     time.Time
+		to       time.Time
+		wantFrom time.Time
+		wantTo   time.Time
+	}{
+		{from: now.Add(-time.Minute), to: now, wantFrom: now.Add(-time.Minute), wantTo: now},
+		{from: time.Time{}, to: now, wantFrom: oldest, wantTo: now},
+		{from: now.Add(-time.Hour * 24), to: now, wantFrom: oldest, wantTo: now},
+		//to早于保留窗口时返回空窗口
+		{from: time.Time{}, to: now.Add(-time.Hour * 2), wantFrom: now.Add(-time.Hour * 2), wantTo: now.Add(-time.Hour * 2)},
+		{from: now, to: now.Add(-time.Minute), wantFrom: now.Add(-time.Minute), wantTo: now.Add(-time.Minute)},
+	}
+
+	for _, test := range tests {
+		from, to := clampWindow(test.from, test.to, oldest)
+		if !from.Equal(test.wantFrom) || !to.Equal(test.wantTo) {
+			t.Errorf("clampWindow(%v, %v) = %v, %v, want %v, %v", test.from, test.to, from, to, test.wantFrom, test.wantTo)
+		}
+	}
+}
+
+func TestHistoryStep(t *testing.T) {
+	sampler := NewSampler(nil, time.Second, time.Hour)
+	history := newRing(100)
+	begin := time.UnixMilli(1_000_000)
+	for i := 0; i < 10; i++ {
+		history.push(&model.ContainerStatsPoint{Timestamp: begin.Add(time.Second * time.Duration(i)).UnixMilli(), CPUPercent: float64(i)})
+	}
+	sampler.history["c1"] = history
+
+	tests := []struct {
+		from     time.Time
+		to       time.Time
+		step     time.Duration
+		wantStep time.Duration
+		points   int
+	}{
+		//不大于采样间隔时返回原始点
+		{from: begin, to: begin.Add(time.Second * 9), step: 0, wantStep: time.Second, points: 10},
+		{from: begin, to: begin.Add(time.Second * 9), step: time.Millisecond * 100, wantStep: time.Second, points: 10},
+		{from: begin.Add(time.Second * 5), to: begin.Add(time.Second * 9), step: time.Second, wantStep: time.Second, points: 5},
+		{from: begin, to: begin.Add(time.Second * 9), step: time.Second * 5, wantStep: time.Second * 5, points: 2},
+		//时间跨度过大时放大step, 点数不超过上限
+		{from: begin.Add(-time.Hour * 10), to: begin.Add(time.Second * 9), step: time.Second, wantStep: (time.Hour*10 + time.Second*9) / maxSeriesPoints, points: 2},
+	}
+
+	for _, test := range tests {
+		series, ok := sampler.History("c1", test.from, test.to, test.step)
+		if !ok {
+			t.Fatalf("History() found no history")
+		}
+		if series.Step != test.wantStep.Milliseconds() || len(series.Points) != test.points {
+			t.Errorf("History(%v, %v, %v) step = %d, points = %d, want %d, %d", test.from, test.to, test.step, series.Step, len(series.Points), test.wantStep.Milliseconds(), test.points)
+		}
+	}
+
+	if _, ok := sampler.History("missing", begin, begin, 0); ok {
+		t.Errorf("History(missing) found history")
+	}
+}
@@ -0,0 +1,181 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	"humpback-agent/model"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// 订阅者缓冲, 消费过慢时丢弃新的stats而不阻塞共享流
+	subscriptionBuffer = 64
+)
+
+// Hub 管理容器实时stats流, 同一容器无论多少订阅者只保持一条docker stats流
+type Hub struct {
+	sync.Mutex
+	client  *client.Client
+	streams map[string]*stream
+}
+
+type stream struct {
+	containerId   string
+	containerName string
+	cancel        context.CancelFunc
+	subscribers   map[*Subscription]struct{}
+}
+
+// Subscription 一次订阅, 通过C接收事件, 使用完毕必须Close
+type Subscription struct {
+	C            chan *model.ContainerStatsEvent
+	hub          *Hub
+	containerIds []string
+	closeOnce    sync.Once
+}
+
+func NewHub(client *client.Client) *Hub {
+	return &Hub{
+		client:  client,
+		streams: make(map[string]*stream),
+	}
+}
+
+// Subscribe 订阅一组容器的实时stats, targets为容器ID到容器名称的映射
+func (hub *Hub) Subscribe(ctx context.Context, targets map[string]string) *Subscription {
+	subscription := &Subscription{
+		C:   make(chan *model.ContainerStatsEvent, subscriptionBuffer),
+		hub: hub,
+	}
+
+	hub.Lock()
+	defer hub.Unlock()
+	for containerId, containerName := range targets {
+		subscription.containerIds = append(subscription.containerIds, containerId)
+		s, ok := hub.streams[containerId]
+		if !ok {
+			s = &stream{
+				containerId:   containerId,
+				containerName: containerName,
+				subscribers:   make(map[*Subscription]struct{}),
+			}
+			//共享流不跟随单个订阅者的请求ctx, 只在最后一个订阅者离开时取消
+			var streamCtx context.Context
+			streamCtx, s.cancel = context.WithCancel(context.WithoutCancel(ctx))
+			hub.streams[containerId] = s
+			go hub.run(streamCtx, s)
+		}
+		s.subscribers[subscription] = struct{}{}
+	}
+	return subscription
+}
+
+// Len 订阅的容器数量
+func (subscription *Subscription) Len() int {
+	return len(subscription.containerIds)
+}
+
+func (subscription *Subscription) Close() {
+	subscription.closeOnce.Do(func() {
+		hub := subscription.hub
+		hub.Lock()
+		defer hub.Unlock()
+		for _, containerId := range subscription.containerIds {
+			s, ok := hub.streams[containerId]
+			if !ok {
+				continue
+			}
+			delete(s.subscribers, subscription)
+			if len(s.subscribers) == 0 {
+				s.cancel()
+				delete(hub.streams, containerId)
+			}
+		}
+	})
+}
+
+func (hub *Hub) run(ctx context.Context, s *stream) {
+	err := hub.consume(ctx, s)
+	if ctx.Err() != nil {
+		//所有订阅者已离开
+		return
+	}
+
+	event := &model.ContainerStatsEvent{
+		ContainerId:   s.containerId,
+		ContainerName: s.containerName,
+		Closed:        true,
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		logrus.Debugf("stats stream container %s closed, %v", s.containerId, err)
+		event.ErrorMsg = err.Error()
+	}
+
+	hub.Lock()
+	defer hub.Unlock()
+	hub.broadcast(s, event)
+	if hub.streams[s.containerId] == s {
+		delete(hub.streams, s.containerId)
+	}
+	s.cancel()
+}
+
+func (hub *Hub) consume(ctx context.Context, s *stream) error {
+	statsReader, err := hub.client.ContainerStats(ctx, s.containerId, true)
+	if err != nil {
+		return err
+	}
+
+	defer statsReader.Body.Close()
+	decoder := json.NewDecoder(statsReader.Body)
+	for {
+		containerStats := &container.StatsResponse{}
+		if err = decoder.Decode(containerStats); err != nil {
+			return err
+		}
+
+		event := &model.ContainerStatsEvent{
+			ContainerId:   s.containerId,
+			ContainerName: s.containerName,
+			Stats:         model.ParseContainerStats(containerStats),
+		}
+		hub.Lock()
+		hub.broadcast(s, event)
+		hub.Unlock()
+	}
+}
+
+// broadcast 调用方需持有hub锁
+func (hub *Hub) broadcast(s *stream, event *model.ContainerStatsEvent) {
+	for subscription := range s.subscribers {
+		subscription.deliver(event)
+	}
+}
+
+// deliver 缓冲已满时丢弃stats事件, Closed事件必须送达, 否则订阅者无法得知流已结束,
+// 此时丢弃最早的事件腾出位置. 事件只在持有hub锁时写入, 不会与其他写入竞争
+func (subscription *Subscription) deliver(event *model.ContainerStatsEvent) {
+	for {
+		select {
+		case subscription.C <- event:
+			return
+		default:
+		}
+
+		if !event.Closed {
+			return
+		}
+
+		select {
+		case <-subscription.C:
+		default:
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"humpback-agent/model"
+	"humpback-agent/pkg/utils"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// 同时采集stats的容器数量上限
+	maxSampleConcurrency = 8
+	sampleTimeout        = time.Second * 30
+)
+
+// Sample 容器最近一次的stats采样
+type Sample struct {
+	ContainerId   string
+	ContainerName string
+	Labels        map[string]string
+	Stats         *model.ContainerStats
+}
+
+// Sampler 后台按固定间隔采集所有运行中容器的stats, 供指标、统计等读取, 避免每次读取都阻塞调用docker
+// 每个容器保留retention时长的历史, 容器停止后历史保留到过期为止
+type Sampler struct {
+	sync.RWMutex
+	client    *client.Client
+	interval  time.Duration
+	retention time.Duration
+	samples   map[string]*Sample
+	history   map[string]*ring
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewSampler(client *client.Client, interval time.Duration, retention time.Duration) *Sampler {
+	return &Sampler{
+		client:    client,
+		interval:  interval,
+		retention: retention,
+		samples:   make(map[string]*Sample),
+		history:   make(map[string]*ring),
+	}
+}
+
+func (sampler *Sampler) Start(ctx context.Context) {
+	ctx, sampler.cancel = context.WithCancel(ctx)
+	sampler.done = make(chan struct{})
+	go func() {
+		defer close(sampler.done)
+		for {
+			begin := time.Now()
+			sampler.sampleOnce(ctx)
+			wait := sampler.interval - time.Since(begin)
+			if wait < 0 {
+				wait = 0
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+func (sampler *Sampler) Stop() {
+	if sampler.cancel != nil {
+		sampler.cancel()
+		<-sampler.done
+	}
+}
+
+// Latest 返回容器最近一次采样, 不存在时返回nil
+func (sampler *Sampler) Latest(containerId string) *Sample {
+	sampler.RLock()
+	defer sampler.RUnlock()
+	return sampler.samples[containerId]
+}
+
+func (sampler *Sampler) Samples() []*Sample {
+	sampler.RLock()
+	defer sampler.RUnlock()
+	samples := make([]*Sample, 0, len(sampler.samples))
+	for _, sample := range sampler.samples {
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+func (sampler *Sampler) sampleOnce(ctx context.Context) {
+	containers, err := sampler.client.ContainerList(ctx, container.ListOptions{})
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.Debugf("stats sampler list containers error, %v", err)
+		}
+		return
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		samples = make(map[string]*Sample, len(containers))
+		limiter = make(chan struct{}, maxSampleConcurrency)
+	)
+
+	for _, item := range containers {
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func(item types.Container) {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+
+			containerStats, err := sampler.containerStats(ctx, item.ID)
+			if err != nil {
+				logrus.Debugf("stats sampler container %s stats error, %v", item.ID, err)
+				return
+			}
+
+			name := ""
+			if len(item.Names) > 0 {
+				name = utils.ContainerName(item.Names[0])
+			}
+			mutex.Lock()
+			samples[item.ID] = &Sample{
+				ContainerId:   item.ID,
+				ContainerName: name,
+				Labels:        item.Labels,
+				Stats:         model.ParseContainerStats(containerStats),
+			}
+			mutex.Unlock()
+		}(item)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+	//未运行的容器不再保留最近采样, 历史到期后清理
+	now := time.Now()
+	sampler.Lock()
+	sampler.samples = samples
+	capacity := int(sampler.retention/sampler.interval) + 1
+	for containerId, sample := range samples {
+		history, ok := sampler.history[containerId]
+		if !ok {
+			history = newRing(capacity)
+			sampler.history[containerId] = history
+		}
+		history.push(model.NewContainerStatsPoint(sample.Stats, now.UnixMilli()))
+	}
+
+	expired := now.Add(-sampler.retention).UnixMilli()
+	for containerId, history := range sampler.history {
+		if last := history.last(); last == nil || last.Timestamp < expired {
+			delete(sampler.history, containerId)
+		}
+	}
+	sampler.Unlock()
+}
+
+func (sampler *Sampler) containerStats(ctx context.Context, containerId string) (*container.StatsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, sampleTimeout)
+	defer cancel()
+	//stream=false时docker会等待两次采样并带上precpu数据, 可以直接计算CPU使用率
+	statsReader, err := sampler.client.ContainerStats(ctx, containerId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer statsReader.Body.Close()
+	containerStats := &container.StatsResponse{}
+	if err = json.NewDecoder(statsReader.Body).Decode(containerStats); err != nil {
+		return nil, err
+	}
+	return containerStats, nil
+}
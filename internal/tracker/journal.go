@@ -0,0 +1,49 @@
+package tracker
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"humpback-agent/pkg/utils"
+)
+
+const (
+	journalFileName = "interrupted-operations.json"
+)
+
+// SaveInterrupted 记录关闭时未能完成的操作, 供下次启动时清理或恢复
+func SaveInterrupted(dataDirectory string, operations []*Operation) error {
+	filePath := filepath.Join(dataDirectory, journalFileName)
+	if len(operations) == 0 {
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(operations, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileWithDir(filePath, data, 0600)
+}
+
+// LoadInterrupted 读取并删除上次关闭时记录的未完成操作
+func LoadInterrupted(dataDirectory string) ([]*Operation, error) {
+	filePath := filepath.Join(dataDirectory, journalFileName)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	operations := []*Operation{}
+	if err = json.Unmarshal(data, &operations); err != nil {
+		return nil, err
+	}
+	return operations, os.Remove(filePath)
+}
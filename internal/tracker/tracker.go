@@ -0,0 +1,173 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"humpback-agent/internal/metrics"
+)
+
+var ErrTrackerClosed = errors.New("agent is shutting down, operation rejected")
+
+const (
+	OperationContainerCreate  = "container.create"
+	OperationContainerDelete  = "container.delete"
+	OperationContainerStart   = "container.start"
+	OperationContainerStop    = "container.stop"
+	OperationContainerRestart = "container.restart"
+	OperationNetworkCreate    = "network.create"
+	OperationNetworkDelete    = "network.delete"
+	OperationJobExecute       = "job.execute"
+	OperationConfigRefresh    = "config.refresh"
+)
+
+// Operation 一个正在执行中的操作
+type Operation struct {
+	Id        string `json:"id"`
+	Kind      string `json:"kind"`
+	Target    string `json:"target"`
+	StartedAt int64  `json:"startedAt"`
+}
+
+// Tracker 跟踪所有执行中的操作, 关闭后拒绝新操作, 并可在超时时间内等待已有操作完成
+type Tracker struct {
+	sync.Mutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	closed     bool
+	seq        uint64
+	operations map[string]*Operation
+}
+
+func NewTracker() *Tracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Tracker{
+		ctx:        ctx,
+		cancel:     cancel,
+		operations: make(map[string]*Operation),
+	}
+}
+
+// Track 登记一个操作, 返回的ctx在排空超时后会被取消, 操作结束后必须调用done
+func (tracker *Tracker) Track(kind string, target string) (context.Context, func(), error) {
+	tracker.Lock()
+	defer tracker.Unlock()
+	if tracker.closed {
+		return nil, nil, ErrTrackerClosed
+	}
+
+	tracker.seq++
+	operation := &Operation{
+		Id:        strconv.FormatUint(tracker.seq, 10),
+		Kind:      kind,
+		Target:    target,
+		StartedAt: time.Now().UnixMilli(),
+	}
+	tracker.operations[operation.Id] = operation
+	tracker.wg.Add(1)
+	metrics.TaskQueueDepth.WithLabelValues(kind).Inc()
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			tracker.Lock()
+			delete(tracker.operations, operation.Id)
+			tracker.Unlock()
+			metrics.TaskQueueDepth.WithLabelValues(kind).Dec()
+			tracker.wg.Done()
+		})
+	}
+	return tracker.ctx, done, nil
+}
+
+// Go 在新的goroutine中执行操作
+func (tracker *Tracker) Go(kind string, target string, fn func(ctx context.Context)) error {
+	ctx, done, err := tracker.Track(kind, target)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer done()
+		fn(ctx)
+	}()
+	return nil
+}
+
+func (tracker *Tracker) Closed() bool {
+	tracker.Lock()
+	defer tracker.Unlock()
+	return tracker.closed
+}
+
+// Close 停止接收新操作
+func (tracker *Tracker) Close() {
+	tracker.Lock()
+	tracker.closed = true
+	tracker.Unlock()
+}
+
+// Pending 当前执行中的操作数量
+func (tracker *Tracker) Pending() int {
+	tracker.Lock()
+	defer tracker.Unlock()
+	return len(tracker.operations)
+}
+
+// Running 是否有指定类型的操作正在执行
+func (tracker *Tracker) Running(kinds ...string) bool {
+	tracker.Lock()
+	defer tracker.Unlock()
+	for _, operation := range tracker.operations {
+		if slices.Contains(kinds, operation.Kind) {
+			return true
+		}
+	}
+	return false
+}
+
+func (tracker *Tracker) Operations() []*Operation {
+	tracker.Lock()
+	defer tracker.Unlock()
+	operations := make([]*Operation, 0, len(tracker.operations))
+	for _, operation := range tracker.operations {
+		copied := *operation
+		operations = append(operations, &copied)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].StartedAt < operations[j].StartedAt
+	})
+	return operations
+}
+
+// Drain 关闭Tracker并等待执行中的操作完成, 超时后取消所有操作并返回未能完成的操作
+func (tracker *Tracker) Drain(timeout time.Duration) []*Operation {
+	tracker.Close()
+	waitCh := make(chan struct{})
+	go func() {
+		tracker.wg.Wait()
+		close(waitCh)
+	}()
+
+	select {
+	case <-waitCh:
+		tracker.cancel()
+		return nil
+	case <-time.After(timeout):
+	}
+
+	interrupted := tracker.Operations()
+	tracker.cancel()
+	//给被取消的操作一点时间退出
+	select {
+	case <-waitCh:
+	case <-time.After(time.Second * 5):
+	}
+	return interrupted
+}
@@ -0,0 +1,121 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunning(t *testing.T) {
+	tracker := NewTracker()
+	_, createDone, err := tracker.Track(OperationContainerCreate, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, stopDone, err := tracker.Track(OperationContainerStop, "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		kinds []string
+		want  bool
+	}{
+		{kinds: []string{OperationContainerCreate}, want: true},
+		{kinds: []string{OperationJobExecute, OperationContainerStop}, want: true},
+		{kinds: []string{OperationJobExecute}, want: false},
+		{kinds: nil, want: false},
+	}
+	for _, test := range tests {
+		if got := tracker.Running(test.kinds...); got != test.want {
+			t.Errorf("Running(%v) = %v, want %v", test.kinds, got, test.want)
+		}
+	}
+
+	if got := tracker.Pending(); got != 2 {
+		t.Fatalf("Pending() = %d, want 2", got)
+	}
+	createDone()
+	//done可以重复调用
+	createDone()
+	if tracker.Running(OperationContainerCreate) || tracker.Pending() != 1 {
+		t.Fatalf("Running(create) = %v, Pending() = %d after done, want false, 1", tracker.Running(OperationContainerCreate), tracker.Pending())
+	}
+	stopDone()
+}
+
+func TestClose(t *testing.T) {
+	tracker := NewTracker()
+	_, done, err := tracker.Track(OperationContainerStart, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.Close()
+	if !tracker.Closed() {
+		t.Fatal("Closed() = false after Close")
+	}
+
+	if _, _, err = tracker.Track(OperationContainerStart, "api"); !errors.Is(err, ErrTrackerClosed) {
+		t.Errorf("Track() after Close error = %v, want %v", err, ErrTrackerClosed)
+	}
+	if err = tracker.Go(OperationJobExecute, "job", func(ctx context.Context) {}); !errors.Is(err, ErrTrackerClosed) {
+		t.Errorf("Go() after Close error = %v, want %v", err, ErrTrackerClosed)
+	}
+
+	//关闭前登记的操作不受影响
+	operations := tracker.Operations()
+	if len(operations) != 1 || operations[0].Kind != OperationContainerStart || operations[0].Target != "web" {
+		t.Errorf("Operations() after Close = %+v, want the tracked start", operations)
+	}
+	done()
+}
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name        string
+		hold        time.Duration
+		timeout     time.Duration
+		interrupted int
+		cancelled   bool
+	}{
+		{name: "no operation", timeout: time.Millisecond * 10},
+		{name: "finished in time", hold: time.Millisecond * 10, timeout: time.Second, interrupted: 0},
+		//超时后ctx被取消, 操作随之退出
+		{name: "timed out", hold: time.Hour, timeout: time.Millisecond * 10, interrupted: 1, cancelled: true},
+	}
+
+	for _, test := range tests {
+		tracker := NewTracker()
+		cancelled := make(chan bool, 1)
+		if test.hold > 0 {
+			err := tracker.Go(OperationJobExecute, "job", func(ctx context.Context) {
+				select {
+				case <-ctx.Done():
+					cancelled <- true
+				case <-time.After(test.hold):
+					cancelled <- false
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		interrupted := tracker.Drain(test.timeout)
+		if len(interrupted) != test.interrupted {
+			t.Errorf("%s: Drain() interrupted = %+v, want %d operations", test.name, interrupted, test.interrupted)
+		}
+		if test.interrupted > 0 && interrupted[0].Kind != OperationJobExecute {
+			t.Errorf("%s: Drain() interrupted kind = %s, want %s", test.name, interrupted[0].Kind, OperationJobExecute)
+		}
+		if test.hold > 0 {
+			if got := <-cancelled; got != test.cancelled {
+				t.Errorf("%s: operation cancelled = %v, want %v", test.name, got, test.cancelled)
+			}
+		}
+		if !tracker.Closed() || tracker.Pending() != 0 {
+			t.Errorf("%s: after Drain Closed() = %v, Pending() = %d, want true, 0", test.name, tracker.Closed(), tracker.Pending())
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package model
+
+// ContainerConfigRefresh 单个容器的配置刷新结果
+type ContainerConfigRefresh struct {
+	ContainerId   string   `json:"containerId"`
+	ContainerName string   `json:"containerName"`
+	ConfigNames   []string `json:"configNames"`
+	Changed       bool     `json:"changed"`
+	ReloadAction  string   `json:"reloadAction"`
+	Error         string   `json:"error,omitempty"`
+}
+
+type ConfigRefreshResult struct {
+	ConfigNames []string                  `json:"configNames"`
+	Containers  []*ContainerConfigRefresh `json:"containers"`
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	v1model "humpback-agent/api/v1/model"
 	"humpback-agent/pkg/utils"
 	"log/slog"
 	"math"
@@ -69,22 +70,35 @@ type ContainerMeta struct {
 }
 
 type ContainerInfo struct {
-	ContainerId   string            `json:"containerId"`
-	ContainerName string            `json:"containerName"`
-	State         string            `json:"state"`
-	Status        string            `json:"status"`
-	Network       string            `json:"network"`
-	Image         string            `json:"image"`
-	Labels        map[string]string `json:"labels"`
-	Env           []string          `json:"env"`
-	Mountes       []MounteInfo      `json:"mounts"`
-	Command       string            `json:"command"`
-	Ports         []ContainerPort   `json:"ports"`
-	IPAddr        []ContainerIP     `json:"ipAddr"`
-	Created       int64             `json:"created"`
-	Started       int64             `json:"started"`
-	Finished      int64             `json:"finished"`
-	ErrorMsg      string            `json:"errorMsg"`
+	ContainerId   string                 `json:"containerId"`
+	ContainerName string                 `json:"containerName"`
+	State         string                 `json:"state"`
+	Status        string                 `json:"status"`
+	Network       string                 `json:"network"`
+	Image         string                 `json:"image"`
+	ImageDigest   string                 `json:"imageDigest"` //创建时镜像在仓库中的manifest digest
+	Labels        map[string]string      `json:"labels"`
+	Env           []string               `json:"env"`
+	Mountes       []MounteInfo           `json:"mounts"`
+	Command       string                 `json:"command"` //cmd(为空时为entrypoint)按shell规则拼接, 兼容旧版本
+	Entrypoint    []string               `json:"entrypoint"`
+	Cmd           []string               `json:"cmd"`
+	Ports         []ContainerPort        `json:"ports"`
+	IPAddr        []ContainerIP          `json:"ipAddr"`
+	Created       int64                  `json:"created"`
+	Started       int64                  `json:"started"`
+	Finished      int64                  `json:"finished"`
+	ErrorMsg      string                 `json:"errorMsg"`
+	ExitCode      int                    `json:"exitCode"`
+	OOMKilled     bool                   `json:"oomKilled"`
+	DockerError   string                 `json:"dockerError"` //docker记录的启动/运行错误
+	RestartCount  int                    `json:"restartCount"`
+	Health        string                 `json:"health"` //healthy/unhealthy/starting, 未配置健康检查时为空
+	HealthOutput  string                 `json:"healthOutput"`
+	StatsSummary  *ContainerStatsSummary `json:"statsSummary,omitempty"`
+	CrashLoop     *CrashLoopInfo         `json:"crashLoop,omitempty"`
+	AutoHeal      *AutoHealInfo          `json:"autoHeal,omitempty"`
+	Readiness     *ReadinessInfo         `json:"readiness,omitempty"`
 }
 
 func ParseContainerInfo(container types.ContainerJSON) *ContainerInfo {
@@ -122,34 +136,58 @@ func ParseContainerInfo(container types.ContainerJSON) *ContainerInfo {
 	if state == "" {
 		slog.Info("unknow container status", "status", container.State.Status)
 	}
+
+	exitCode, oomKilled, dockerError, health, healthOutput := 0, false, "", "", ""
+	if container.State != nil {
+		exitCode = container.State.ExitCode
+		oomKilled = container.State.OOMKilled
+		dockerError = container.State.Error
+		if container.State.Health != nil {
+			health = container.State.Health.Status
+			if count := len(container.State.Health.Log); count > 0 {
+				healthOutput = strings.TrimSpace(container.State.Health.Log[count-1].Output)
+			}
+		}
+	}
+	entrypoint, cmd := ParseContainerCommandWithConfig(container.Config)
+	command := utils.ShellJoin(cmd)
+	if len(cmd) == 0 {
+		command = utils.ShellJoin(entrypoint)
+	}
 	return &ContainerInfo{
 		ContainerId:   container.ID,
 		ContainerName: utils.ContainerName(container.Name),
 		State:         state,
 		Status:        status,
 		Image:         container.Config.Image,
+		ImageDigest:   container.Config.Labels[v1model.ContainerLabelImageDigest],
 		Labels:        container.Config.Labels,
 		Network:       container.HostConfig.NetworkMode.NetworkName(),
 		Env:           container.Config.Env,
 		Mountes:       ParseContainerMountes(container.Mounts),
-		Command:       ParseContainerCommandWithConfig(container.Config),
+		Command:       command,
+		Entrypoint:    entrypoint,
+		Cmd:           cmd,
 		Ports:         ParseContainerPortsWithNetworkSettings(container.NetworkSettings),
 		IPAddr:        ParseContainerIPAddrWithNetworkSettings(container.NetworkSettings),
 		Created:       createdTimestamp,
 		Started:       startedTimestamp,
 		Finished:      finishedTimestamp,
+		ExitCode:      exitCode,
+		OOMKilled:     oomKilled,
+		DockerError:   dockerError,
+		RestartCount:  container.RestartCount,
+		Health:        health,
+		HealthOutput:  healthOutput,
 	}
 }
 
-func ParseContainerCommandWithConfig(containerConfig *container.Config) string {
-	if containerConfig != nil {
-		if len(containerConfig.Cmd) > 0 {
-			return strings.Join(containerConfig.Cmd, " ")
-		} else if len(containerConfig.Entrypoint) > 0 {
-			return strings.Join(containerConfig.Entrypoint, " ")
-		}
+// ParseContainerCommandWithConfig 分别返回容器的entrypoint与cmd
+func ParseContainerCommandWithConfig(containerConfig *container.Config) ([]string, []string) {
+	if containerConfig == nil {
+		return nil, nil
 	}
-	return ""
+	return containerConfig.Entrypoint, containerConfig.Cmd
 }
 
 func ParseContainerPortsWithNetworkSettings(networkSettings *types.NetworkSettings) []ContainerPort {
@@ -252,6 +290,10 @@ func ParseContainerStats(containerStats *container.StatsResponse) *ContainerStat
 func calculateCPUPercent(stats *container.StatsResponse) float64 {
 	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
 	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		//首次采样没有precpu数据, 避免出现NaN
+		return 0
+	}
 	// 获取 CPU 核心数
 	cpuCount := float64(stats.CPUStats.OnlineCPUs)
 	if cpuCount == 0 {
@@ -294,3 +336,33 @@ func calculateDiskIO(stats *container.StatsResponse) (uint64, uint64) {
 	}
 	return diskReadBytes, diskWriteBytes
 }
+
+// CrashLoopInfo 容器在滑动窗口内反复退出时上报, Stopped表示已被agent停止
+type CrashLoopInfo struct {
+	Restarts     int      `json:"restarts"`
+	Window       int64    `json:"window"` //秒
+	Since        int64    `json:"since"`
+	LastExitCode int      `json:"lastExitCode"`
+	OOMKilled    bool     `json:"oomKilled"`
+	LastLogs     []string `json:"lastLogs,omitempty"`
+	Stopped      bool     `json:"stopped"`
+}
+
+// AutoHealInfo 容器因持续unhealthy被agent重启的记录
+type AutoHealInfo struct {
+	Restarts       int    `json:"restarts"`
+	LastRestart    int64  `json:"lastRestart"`
+	LastReason     string `json:"lastReason"`
+	Suppressed     int    `json:"suppressed"` //因限速未执行的重启次数
+	LastSuppressed int64  `json:"lastSuppressed"`
+}
+
+// ReadinessInfo agent执行的就绪探测结果, 与docker HEALTHCHECK(存活)分开上报
+type ReadinessInfo struct {
+	Ready                bool   `json:"ready"`
+	Address              string `json:"address"`
+	LastProbe            int64  `json:"lastProbe"`
+	LastError            string `json:"lastError,omitempty"`
+	ConsecutiveSuccesses int    `json:"consecutiveSuccesses"`
+	ConsecutiveFailures  int    `json:"consecutiveFailures"`
+}
@@ -0,0 +1,62 @@
+package model
+
+// ContainerStatsPoint 容器stats历史中的一个点, 网络与磁盘为累计值
+type ContainerStatsPoint struct {
+	Timestamp        int64   `json:"timestamp"`
+	CPUPercent       float64 `json:"cpuPercent"`
+	MemoryUsageBytes uint64  `json:"memoryUsageBytes"`
+	MemoryLimitBytes uint64  `json:"memoryLimitBytes"`
+	NetworkRxBytes   uint64  `json:"networkRxBytes"`
+	NetworkTxBytes   uint64  `json:"networkTxBytes"`
+	DiskReadBytes    uint64  `json:"diskReadBytes"`
+	DiskWriteBytes   uint64  `json:"diskWriteBytes"`
+}
+
+// ContainerStatsSeries 按step降采样后的容器stats序列
+type ContainerStatsSeries struct {
+	ContainerId string                 `json:"containerId"`
+	From        int64                  `json:"from"`
+	To          int64                  `json:"to"`
+	Step        int64                  `json:"step"` //毫秒
+	Points      []*ContainerStatsPoint `json:"points"`
+}
+
+type StatsRange struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+// ContainerStatsSummary 保留窗口内容器stats的汇总
+type ContainerStatsSummary struct {
+	From             int64      `json:"from"`
+	To               int64      `json:"to"`
+	Samples          int        `json:"samples"`
+	CPUPercent       StatsRange `json:"cpuPercent"`
+	MemoryUsageBytes StatsRange `json:"memoryUsageBytes"`
+}
+
+func NewContainerStatsPoint(stats *ContainerStats, timestamp int64) *ContainerStatsPoint {
+	point := &ContainerStatsPoint{
+		Timestamp:        timestamp,
+		CPUPercent:       stats.CPUPercent,
+		MemoryUsageBytes: stats.MemoryUsageBytes,
+		MemoryLimitBytes: stats.MemoryLimitBytes,
+		DiskReadBytes:    stats.DiskReadBytes,
+		DiskWriteBytes:   stats.DiskWriteBytes,
+	}
+	for _, network := range stats.Networks {
+		point.NetworkRxBytes += network.RxBytes
+		point.NetworkTxBytes += network.TxBytes
+	}
+	return point
+}
+
+// ContainerStatsEvent 实时stats推送事件, Closed表示该容器的stats流已结束(容器停止或出错)
+type ContainerStatsEvent struct {
+	ContainerId   string          `json:"containerId"`
+	ContainerName string          `json:"containerName"`
+	Stats         *ContainerStats `json:"stats,omitempty"`
+	Closed        bool            `json:"closed,omitempty"`
+	ErrorMsg      string          `json:"errorMsg,omitempty"`
+}
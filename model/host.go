@@ -12,20 +12,36 @@ import (
 )
 
 type HostInfo struct {
-	Hostname      string   `json:"hostName"`
-	OSInformation string   `json:"osInformation"`
-	KernelVersion string   `json:"kernelVersion"`
-	TotalCPU      int      `json:"totalCPU"`
-	UsedCPU       float32  `json:"usedCPU"`
-	CPUUsage      float32  `json:"cpuUsage"`
-	TotalMemory   uint64   `json:"totalMemory"`
-	UsedMemory    uint64   `json:"usedMemory"`
-	MemoryUsage   float32  `json:"memoryUsage"`
-	HostIPs       []string `json:"hostIPs"`
-	HostPort      int      `json:"hostPort"`
+	Hostname        string               `json:"hostName"`
+	OSInformation   string               `json:"osInformation"`
+	KernelVersion   string               `json:"kernelVersion"`
+	TotalCPU        int                  `json:"totalCPU"`
+	UsedCPU         float32              `json:"usedCPU"`
+	CPUUsage        float32              `json:"cpuUsage"`
+	TotalMemory     uint64               `json:"totalMemory"`
+	UsedMemory      uint64               `json:"usedMemory"`
+	MemoryUsage     float32              `json:"memoryUsage"`
+	TotalSwap       uint64               `json:"totalSwap"`
+	UsedSwap        uint64               `json:"usedSwap"`
+	SwapUsage       float32              `json:"swapUsage"`
+	LoadAverage     LoadAverage          `json:"loadAverage"`
+	Uptime          uint64               `json:"uptime"`
+	Disks           []DiskUsage          `json:"disks"`
+	DockerRootDisk  *DiskUsage           `json:"dockerRootDisk"`
+	VolumesRootDisk *DiskUsage           `json:"volumesRootDisk"`
+	Networks        []NetworkInterfaceIO `json:"networks"`
+	HostIPs         []string             `json:"hostIPs"`
+	HostPort        int                  `json:"hostPort"`
 }
 
+const (
+	DockerEngineStateAvailable   = "Available"
+	DockerEngineStateUnavailable = "Unavailable"
+)
+
 type DockerEngineInfo struct {
+	State          string   `json:"state"`
+	ErrorMsg       string   `json:"errorMsg,omitempty"`
 	Version        string   `json:"version"`
 	APIVersion     string   `json:"apiVersion"`
 	RootDirectory  string   `json:"rootDirectory"`
@@ -36,9 +52,54 @@ type DockerEngineInfo struct {
 }
 
 type HostHealthRequest struct {
-	HostInfo     HostInfo         `json:"hostInfo"`
-	DockerEngine DockerEngineInfo `json:"dockerEngine"`
-	Containers   []*ContainerInfo `json:"containers"`
+	HostInfo       HostInfo         `json:"hostInfo"`
+	DockerEngine   DockerEngineInfo `json:"dockerEngine"`
+	Containers     []*ContainerInfo `json:"containers"`
+	AllocatedPorts []AllocatedPort  `json:"allocatedPorts"`
+	ImageGC        *ImageGCStatus   `json:"imageGC,omitempty"`
+}
+
+// ImageGCStatus 镜像回收情况, 未启用镜像回收时不上报
+type ImageGCStatus struct {
+	LastRun        *ImageGCRun `json:"lastRun,omitempty"`
+	TotalRuns      int         `json:"totalRuns"`
+	TotalRemoved   int         `json:"totalRemoved"`
+	TotalReclaimed int64       `json:"totalReclaimed"`
+}
+
+// ImageGCRun 一次镜像回收, DiskUsage为Docker根目录所在文件系统的使用率百分比
+type ImageGCRun struct {
+	StartedAt       int64    `json:"startedAt"`
+	FinishedAt      int64    `json:"finishedAt"`
+	DiskUsageBefore float64  `json:"diskUsageBefore"`
+	DiskUsageAfter  float64  `json:"diskUsageAfter"`
+	RemovedImages   []string `json:"removedImages"`
+	ReclaimedBytes  int64    `json:"reclaimedBytes"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// HostHealthResponse 心跳响应, ChangedConfigs为Master通知已变更的配置
+// RegistryCredentials为nil时表示未变更, 非nil时替换Master下发的全部镜像仓库凭据
+type HostHealthResponse struct {
+	Token               string               `json:"token"`
+	ChangedConfigs      []string             `json:"changedConfigs"`
+	RegistryCredentials []RegistryCredential `json:"registryCredentials"`
+}
+
+// RegistryCredential Master下发的镜像仓库凭据
+type RegistryCredential struct {
+	ServerAddress string `json:"serverAddress"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+}
+
+// AllocatedPort 分配器记录的主机端口, Reserved表示已分配但容器尚未创建
+type AllocatedPort struct {
+	Protocol      string `json:"protocol"`
+	Port          int    `json:"port"`
+	ContainerId   string `json:"containerId,omitempty"`
+	ContainerName string `json:"containerName"`
+	Reserved      bool   `json:"reserved"`
 }
 
 type CertificateBundle struct {
@@ -49,7 +110,8 @@ type CertificateBundle struct {
 	KeyPEM   []byte         // PEM编码的私钥
 }
 
-func GetHostInfo(hostIpStr, portStr string) HostInfo {
+// GetHostInfo 采集主机信息, 网卡速率按与上一次采集的间隔计算, 间隔过短时沿用上一次的速率
+func GetHostInfo(hostIpStr, portStr string, dockerRootDirectory string, volumesRootDirectory string) HostInfo {
 	hostname, _ := os.Hostname()
 	port, _ := strconv.Atoi(portStr)
 	var hostIps []string
@@ -62,17 +124,28 @@ func GetHostInfo(hostIpStr, portStr string) HostInfo {
 	kernelVersion := utils.HostKernelVersion()
 	totalCPU, usedCPU, cpuUsage := utils.HostCPU()
 	totalMEM, usedMEM, memUsage := utils.HostMemory()
+	totalSwap, usedSwap, swapUsage := utils.HostSwap()
+	load1, load5, load15 := utils.HostLoad()
 	return HostInfo{
-		Hostname:      hostname,
-		OSInformation: osInfo,
-		KernelVersion: kernelVersion,
-		TotalCPU:      totalCPU,
-		UsedCPU:       usedCPU,
-		CPUUsage:      cpuUsage,
-		TotalMemory:   totalMEM,
-		UsedMemory:    usedMEM,
-		MemoryUsage:   memUsage,
-		HostIPs:       hostIps,
-		HostPort:      port,
+		Hostname:        hostname,
+		OSInformation:   osInfo,
+		KernelVersion:   kernelVersion,
+		TotalCPU:        totalCPU,
+		UsedCPU:         usedCPU,
+		CPUUsage:        cpuUsage,
+		TotalMemory:     totalMEM,
+		UsedMemory:      usedMEM,
+		MemoryUsage:     memUsage,
+		TotalSwap:       totalSwap,
+		UsedSwap:        usedSwap,
+		SwapUsage:       swapUsage,
+		LoadAverage:     LoadAverage{Load1: load1, Load5: load5, Load15: load15},
+		Uptime:          utils.HostUptime(),
+		Disks:           hostDisks(),
+		DockerRootDisk:  hostDiskUsage(dockerRootDirectory),
+		VolumesRootDisk: hostDiskUsage(volumesRootDirectory),
+		Networks:        hostNetworkRate.collect(),
+		HostIPs:         hostIps,
+		HostPort:        port,
 	}
 }
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"humpback-agent/pkg/utils"
+
+	psnet "github.com/shirou/gopsutil/v4/net"
+)
+
+type LoadAverage struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+type DiskUsage struct {
+	Path        string  `json:"path"`
+	Device      string  `json:"device,omitempty"`
+	FsType      string  `json:"fsType"`
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	Free        uint64  `json:"free"`
+	Usage       float32 `json:"usage"`
+	InodesTotal uint64  `json:"inodesTotal"`
+	InodesUsed  uint64  `json:"inodesUsed"`
+	InodesFree  uint64  `json:"inodesFree"`
+	InodesUsage float32 `json:"inodesUsage"`
+}
+
+type NetworkInterfaceIO struct {
+	Name             string  `json:"name"`
+	RxBytes          uint64  `json:"rxBytes"`
+	TxBytes          uint64  `json:"txBytes"`
+	RxPackets        uint64  `json:"rxPackets"`
+	TxPackets        uint64  `json:"txPackets"`
+	RxErrors         uint64  `json:"rxErrors"`
+	TxErrors         uint64  `json:"txErrors"`
+	RxDropped        uint64  `json:"rxDropped"`
+	TxDropped        uint64  `json:"txDropped"`
+	RxBytesPerSecond float64 `json:"rxBytesPerSecond"`
+	TxBytesPerSecond float64 `json:"txBytesPerSecond"`
+}
+
+const (
+	// 事件触发的心跳可能在上一次采集后很快再次采集, 间隔过短时速率误差大, 复用上一次计算的速率
+	minNetworkRateInterval = time.Second * 5
+)
+
+// networkRateCalculator 记录上一次采集的网卡计数, 按两次采集间隔计算速率
+type networkRateCalculator struct {
+	sync.Mutex
+	lastTime     time.Time
+	lastCounters map[string]NetworkInterfaceIO
+	lastRates    map[string]NetworkInterfaceIO
+}
+
+var hostNetworkRate = &networkRateCalculator{
+	lastCounters: make(map[string]NetworkInterfaceIO),
+	lastRates:    make(map[string]NetworkInterfaceIO),
+}
+
+func (calculator *networkRateCalculator) collect() []NetworkInterfaceIO {
+	return calculator.update(time.Now(), utils.HostNetIOCounters())
+}
+
+// update 距上一次计算不足minNetworkRateInterval时只更新计数, 速率沿用上一次的结果
+func (calculator *networkRateCalculator) update(now time.Time, counters []psnet.IOCountersStat) []NetworkInterfaceIO {
+	calculator.Lock()
+	defer calculator.Unlock()
+
+	elapsed := now.Sub(calculator.lastTime)
+	reuse := !calculator.lastTime.IsZero() && elapsed < minNetworkRateInterval
+	networks := []NetworkInterfaceIO{}
+	current := make(map[string]NetworkInterfaceIO)
+	for _, counter := range counters {
+		networkIO := NetworkInterfaceIO{
+			Name:      counter.Name,
+			RxBytes:   counter.BytesRecv,
+			TxBytes:   counter.BytesSent,
+			RxPackets: counter.PacketsRecv,
+			TxPackets: counter.PacketsSent,
+			RxErrors:  counter.Errin,
+			TxErrors:  counter.Errout,
+			RxDropped: counter.Dropin,
+			TxDropped: counter.Dropout,
+		}
+
+		if reuse {
+			rate := calculator.lastRates[counter.Name]
+			networkIO.RxBytesPerSecond = rate.RxBytesPerSecond
+			networkIO.TxBytesPerSecond = rate.TxBytesPerSecond
+		} else if last, ret := calculator.lastCounters[counter.Name]; ret && elapsed > 0 {
+			networkIO.RxBytesPerSecond = counterRate(last.RxBytes, networkIO.RxBytes, elapsed.Seconds())
+			networkIO.TxBytesPerSecond = counterRate(last.TxBytes, networkIO.TxBytes, elapsed.Seconds())
+		}
+		current[counter.Name] = networkIO
+		networks = append(networks, networkIO)
+	}
+
+	if !reuse {
+		calculator.lastTime = now
+		calculator.lastCounters = current
+		calculator.lastRates = current
+	}
+	return networks
+}
+
+// counterRate 计数器回绕或网卡重置时返回0
+func counterRate(last uint64, current uint64, elapsed float64) float64 {
+	if current < last {
+		return 0
+	}
+	return math.Round(float64(current-last)/elapsed*100) / 100
+}
+
+// hostDisks 主机物理磁盘使用情况
+func hostDisks() []DiskUsage {
+	disks := []DiskUsage{}
+	for _, partition := range utils.HostPartitions() {
+		diskUsage := hostDiskUsage(partition.Mountpoint)
+		if diskUsage == nil {
+			continue
+		}
+		diskUsage.Device = partition.Device
+		disks = append(disks, *diskUsage)
+	}
+	return disks
+}
+
+func hostDiskUsage(path string) *DiskUsage {
+	if path == "" {
+		return nil
+	}
+
+	usage, err := utils.HostDiskUsage(path)
+	if err != nil {
+		return nil
+	}
+	return &DiskUsage{
+		Path:        path,
+		FsType:      usage.Fstype,
+		Total:       usage.Total,
+		Used:        usage.Used,
+		Free:        usage.Free,
+		Usage:       float32(math.Round(usage.UsedPercent*100) / 100),
+		InodesTotal: usage.InodesTotal,
+		InodesUsed:  usage.InodesUsed,
+		InodesFree:  usage.InodesFree,
+		InodesUsage: float32(math.Round(usage.InodesUsedPercent*100) / 100),
+	}
+}
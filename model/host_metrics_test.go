@@ -0,0 +1,49 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/v4/net"
+)
+
+func TestNetworkRate(t *testing.T) {
+	calculator := &networkRateCalculator{
+		lastCounters: make(map[string]NetworkInterfaceIO),
+		lastRates:    make(map[string]NetworkInterfaceIO),
+	}
+	begin := time.Now()
+
+	tests := []struct {
+		after  time.Duration
+		rx     uint64
+		tx     uint64
+		wantRx float64
+		wantTx float64
+	}{
+		//首次采集没有速率
+		{after: 0, rx: 1000, tx: 500, wantRx: 0, wantTx: 0},
+		{after: time.Second * 10, rx: 11000, tx: 2500, wantRx: 1000, wantTx: 200},
+		//事件触发的心跳间隔过短, 沿用上一次的速率
+		{after: time.Second*10 + time.Millisecond*200, rx: 11100, tx: 2500, wantRx: 1000, wantTx: 200},
+		{after: time.Second * 14, rx: 12000, tx: 2600, wantRx: 1000, wantTx: 200},
+		//速率按上一次计算速率的时间计算, 不按被跳过的采集计算
+		{after: time.Second * 15, rx: 16000, tx: 3500, wantRx: 1000, wantTx: 200},
+		//计数器重置
+		{after: time.Second * 25, rx: 100, tx: 100, wantRx: 0, wantTx: 0},
+	}
+
+	for _, test := range tests {
+		networks := calculator.update(begin.Add(test.after), []psnet.IOCountersStat{{Name: "eth0", BytesRecv: test.rx, BytesSent: test.tx}})
+		if len(networks) != 1 {
+			t.Fatalf("update(%v) = %+v, want one interface", test.after, networks)
+		}
+		network := networks[0]
+		if network.RxBytes != test.rx || network.TxBytes != test.tx {
+			t.Errorf("update(%v) counters = %d/%d, want %d/%d", test.after, network.RxBytes, network.TxBytes, test.rx, test.tx)
+		}
+		if network.RxBytesPerSecond != test.wantRx || network.TxBytesPerSecond != test.wantTx {
+			t.Errorf("update(%v) rate = %v/%v, want %v/%v", test.after, network.RxBytesPerSecond, network.TxBytesPerSecond, test.wantRx, test.wantTx)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package model
+
+// ServiceContainer 服务在本节点的容器及其状态
+type ServiceContainer struct {
+	ContainerId   string          `json:"containerId"`
+	ContainerName string          `json:"containerName"`
+	State         string          `json:"state"`
+	Status        string          `json:"status"`
+	Image         string          `json:"image"`
+	Created       int64           `json:"created"`
+	Stats         *ContainerStats `json:"stats,omitempty"`
+}
+
+// ResourceUsage 一组容器的资源使用汇总, 取各运行中容器最近一次采样之和
+type ResourceUsage struct {
+	Containers       int     `json:"containers"`
+	Running          int     `json:"running"`
+	CPUPercent       float64 `json:"cpuPercent"`
+	MemoryUsageBytes uint64  `json:"memoryUsageBytes"`
+	MemoryLimitBytes uint64  `json:"memoryLimitBytes"`
+	NetworkRxBytes   uint64  `json:"networkRxBytes"`
+	NetworkTxBytes   uint64  `json:"networkTxBytes"`
+	DiskReadBytes    uint64  `json:"diskReadBytes"`
+	DiskWriteBytes   uint64  `json:"diskWriteBytes"`
+}
+
+type ServiceInfo struct {
+	ServiceId   string              `json:"serviceId"`
+	ServiceName string              `json:"serviceName"`
+	GroupId     string              `json:"groupId"`
+	Usage       ResourceUsage       `json:"usage"`
+	Containers  []*ServiceContainer `json:"containers"`
+}
+
+type GroupInfo struct {
+	GroupId  string         `json:"groupId"`
+	Usage    ResourceUsage  `json:"usage"`
+	Services []*ServiceInfo `json:"services"`
+}
+
+type ContainerActionResult struct {
+	ContainerId   string `json:"containerId"`
+	ContainerName string `json:"containerName"`
+	Succeeded     bool   `json:"succeeded"`
+	ErrorMsg      string `json:"errorMsg,omitempty"`
+}
+
+type ServiceActionResult struct {
+	ServiceId string                   `json:"serviceId"`
+	Action    string                   `json:"action"`
+	Results   []*ContainerActionResult `json:"results"`
+}
+
+func (usage *ResourceUsage) Add(container *ServiceContainer) {
+	usage.Containers++
+	if container.State == "running" {
+		usage.Running++
+	}
+
+	if container.Stats == nil {
+		return
+	}
+	usage.CPUPercent += container.Stats.CPUPercent
+	usage.MemoryUsageBytes += container.Stats.MemoryUsageBytes
+	usage.MemoryLimitBytes += container.Stats.MemoryLimitBytes
+	usage.DiskReadBytes += container.Stats.DiskReadBytes
+	usage.DiskWriteBytes += container.Stats.DiskWriteBytes
+	for _, network := range container.Stats.Networks {
+		usage.NetworkRxBytes += network.RxBytes
+		usage.NetworkTxBytes += network.TxBytes
+	}
+}
+
+func (usage *ResourceUsage) Merge(other ResourceUsage) {
+	usage.Containers += other.Containers
+	usage.Running += other.Running
+	usage.CPUPercent += other.CPUPercent
+	usage.MemoryUsageBytes += other.MemoryUsageBytes
+	usage.MemoryLimitBytes += other.MemoryLimitBytes
+	usage.NetworkRxBytes += other.NetworkRxBytes
+	usage.NetworkTxBytes += other.NetworkTxBytes
+	usage.DiskReadBytes += other.DiskReadBytes
+	usage.DiskWriteBytes += other.DiskWriteBytes
+}
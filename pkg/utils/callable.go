@@ -4,6 +4,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/go-connections/nat"
 	"reflect"
+	"strings"
 )
 
 // 辅助函数: 环境变量转换为 Docker SDK 格式
@@ -38,15 +39,26 @@ func MapToBinds(volumeMap map[string]string) []string {
 	return binds
 }
 
-// 辅助函数：将设备映射转换为 Docker SDK 格式
+// 辅助函数：将设备映射转换为 Docker SDK 格式, 格式为 hostDevice[:containerDevice[:permissions]]
 func MapToDevices(devices []string) []container.DeviceMapping {
 	var deviceMappings []container.DeviceMapping
 	for _, device := range devices {
-		deviceMappings = append(deviceMappings, container.DeviceMapping{
-			PathOnHost:        device,
-			PathInContainer:   device,
+		parts := strings.SplitN(device, ":", 3)
+		deviceMapping := container.DeviceMapping{
+			PathOnHost:        parts[0],
+			PathInContainer:   parts[0],
 			CgroupPermissions: "rwm",
-		})
+		}
+		if len(parts) == 2 && !strings.HasPrefix(parts[1], "/") {
+			//hostDevice:permissions
+			deviceMapping.CgroupPermissions = parts[1]
+		} else if len(parts) > 1 && parts[1] != "" {
+			deviceMapping.PathInContainer = parts[1]
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			deviceMapping.CgroupPermissions = parts[2]
+		}
+		deviceMappings = append(deviceMappings, deviceMapping)
 	}
 	return deviceMappings
 }
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrUnterminatedQuote = errors.New("unterminated quote in command")
+
+// ShellSplit 按POSIX shell的引号与转义规则拆分命令行, 不做变量展开与通配
+func ShellSplit(line string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inWord  bool
+	)
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 < len(line) {
+				i++
+				//反斜杠加换行为续行
+				if line[i] != '\n' {
+					current.WriteByte(line[i])
+				}
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, ErrUnterminatedQuote
+			}
+			current.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(line); i++ {
+				if line[i] == '"' {
+					closed = true
+					break
+				}
+				//双引号内只有 $ ` " \ 换行 可以被转义
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("$`\"\\\n", line[i+1]) >= 0 {
+					i++
+					if line[i] != '\n' {
+						current.WriteByte(line[i])
+					}
+					continue
+				}
+				current.WriteByte(line[i])
+			}
+			if !closed {
+				return nil, ErrUnterminatedQuote
+			}
+		default:
+			inWord = true
+			current.WriteByte(c)
+		}
+	}
+
+	if inWord {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// ShellJoin 将参数拼接为可被ShellSplit还原的命令行
+func ShellJoin(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+
+	if strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,+@%", r))
+	}) < 0 {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestShellSplit(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+		err  error
+	}{
+		{line: "", want: nil},
+		{line: "   ", want: nil},
+		{line: "nginx -g 'daemon off;'", want: []string{"nginx", "-g", "daemon off;"}},
+		{line: `sh -c "echo \"hello world\""`, want: []string{"sh", "-c", `echo "hello world"`}},
+		{line: `echo "a\nb" "\$HOME" "\\"`, want: []string{"echo", `a\nb`, "$HOME", `\`}},
+		{line: `echo 'it'\''s'`, want: []string{"echo", "it's"}},
+		{line: `echo a\ b c`, want: []string{"echo", "a b", "c"}},
+		{line: "echo a\\\nb", want: []string{"echo", "ab"}},
+		{line: "echo '' \"\"", want: []string{"echo", "", ""}},
+		{line: "a\tb\nc", want: []string{"a", "b", "c"}},
+		{line: "x'y'\"z\"", want: []string{"xyz"}},
+		{line: "echo 'abc", err: ErrUnterminatedQuote},
+		{line: `echo "abc`, err: ErrUnterminatedQuote},
+		{line: `echo "abc\"`, err: ErrUnterminatedQuote},
+	}
+
+	for _, test := range tests {
+		got, err := ShellSplit(test.line)
+		if !errors.Is(err, test.err) {
+			t.Errorf("ShellSplit(%q) error = %v, want %v", test.line, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ShellSplit(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: nil, want: ""},
+		{args: []string{"nginx", "-g", "daemon off;"}, want: "nginx -g 'daemon off;'"},
+		{args: []string{"echo", ""}, want: "echo ''"},
+		{args: []string{"echo", "it's"}, want: `echo 'it'\''s'`},
+		{args: []string{"--addr=0.0.0.0:80", "/etc/app.conf"}, want: "--addr=0.0.0.0:80 /etc/app.conf"},
+		{args: []string{"echo", "$HOME", `a"b`}, want: `echo '$HOME' 'a"b'`},
+	}
+
+	for _, test := range tests {
+		got := ShellJoin(test.args)
+		if got != test.want {
+			t.Errorf("ShellJoin(%q) = %q, want %q", test.args, got, test.want)
+			continue
+		}
+
+		//拼接结果必须能被ShellSplit还原
+		args, err := ShellSplit(got)
+		if err != nil {
+			t.Errorf("ShellSplit(%q) error = %v", got, err)
+			continue
+		}
+		if len(test.args) > 0 && !reflect.DeepEqual(args, test.args) {
+			t.Errorf("ShellSplit(ShellJoin(%q)) = %q", test.args, args)
+		}
+	}
+}
@@ -9,7 +9,11 @@ import (
 	"strings"
 
 	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/shirou/gopsutil/v4/load"
 	"github.com/shirou/gopsutil/v4/mem"
+	psnet "github.com/shirou/gopsutil/v4/net"
 	"golang.org/x/sys/unix"
 )
 
@@ -40,6 +44,61 @@ func HostMemory() (uint64, uint64, float32) {
 	return totalMEM, usedMEM, memUsage
 }
 
+func HostSwap() (uint64, uint64, float32) {
+	swapInfo, err := mem.SwapMemory()
+	if err != nil {
+		return 0, 0, 0.0
+	}
+	return swapInfo.Total, swapInfo.Used, float32(math.Round(swapInfo.UsedPercent*100) / 100)
+}
+
+func HostLoad() (float64, float64, float64) {
+	avg, err := load.Avg()
+	if err != nil {
+		return 0, 0, 0
+	}
+	return avg.Load1, avg.Load5, avg.Load15
+}
+
+// HostUptime 主机运行时长(秒)
+func HostUptime() uint64 {
+	uptime, err := host.Uptime()
+	if err != nil {
+		return 0
+	}
+	return uptime
+}
+
+// HostPartitions 主机物理磁盘挂载点
+func HostPartitions() []disk.PartitionStat {
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil
+	}
+	return partitions
+}
+
+func HostDiskUsage(path string) (*disk.UsageStat, error) {
+	return disk.Usage(path)
+}
+
+// HostNetIOCounters 主机各网卡累计流量, 跳过回环及Docker虚拟网卡
+func HostNetIOCounters() []psnet.IOCountersStat {
+	counters, err := psnet.IOCounters(true)
+	if err != nil {
+		return nil
+	}
+
+	result := []psnet.IOCountersStat{}
+	for _, counter := range counters {
+		if counter.Name == "lo" || DockerInterface(counter.Name) {
+			continue
+		}
+		result = append(result, counter)
+	}
+	return result
+}
+
 func HostKernelVersion() string {
 	var utsname unix.Utsname
 	if err := unix.Uname(&utsname); err != nil {
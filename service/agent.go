@@ -3,12 +3,14 @@ package service
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"humpback-agent/api"
@@ -16,8 +18,19 @@ import (
 	"humpback-agent/config"
 	"humpback-agent/controller"
 	reqclient "humpback-agent/internal/client"
+	"humpback-agent/internal/configvol"
+	"humpback-agent/internal/crashloop"
 	"humpback-agent/internal/docker"
+	"humpback-agent/internal/identity"
+	"humpback-agent/internal/imagegc"
+	"humpback-agent/internal/imagepull"
+	"humpback-agent/internal/metrics"
+	"humpback-agent/internal/portalloc"
+	"humpback-agent/internal/probe"
 	"humpback-agent/internal/schedule"
+	"humpback-agent/internal/secrets"
+	"humpback-agent/internal/stats"
+	"humpback-agent/internal/tracker"
 	"humpback-agent/model"
 
 	"github.com/docker/docker/api/types"
@@ -32,15 +45,32 @@ type AgentService struct {
 	apiServer         *api.APIServer
 	httpClient        *http.Client
 	scheduler         schedule.TaskSchedulerInterface
+	tracker           *tracker.Tracker
+	statsSampler      *stats.Sampler
+	crashLoop         *crashloop.Detector
+	autoHealer        *autoHealer
+	prober            *probe.Prober
+	portAllocator     *portalloc.Allocator
+	imageGC           *imagegc.Collector
+	metricsServer     *metrics.Server
 	controller        controller.ControllerInterface
 	failureChan       chan model.ContainerMeta
 	tokenChan         chan string
 	token             string
+	identityStore     *identity.Store
 	containers        map[string]*model.ContainerInfo
 	failureContainers map[string]*model.ContainerInfo
+	lastEventNano     atomic.Int64
+	dockerEngineErr   error
+	hostInfo          *model.HostInfo
 }
 
-func NewAgentService(ctx context.Context, config *config.AppConfig, certBundle *model.CertificateBundle, token string) (*AgentService, error) {
+const maxDockerReconnectBackoff = time.Second * 30
+
+// maxUnauthorizedHeartbeats 心跳连续被Master拒绝的次数达到该值时删除本地身份
+const maxUnauthorizedHeartbeats = 5
+
+func NewAgentService(ctx context.Context, config *config.AppConfig, certBundle *model.CertificateBundle, token string, identityStore *identity.Store) (*AgentService, error) {
 	//构建Agent服务
 	agentService := &AgentService{
 		config: config,
@@ -52,7 +82,12 @@ func NewAgentService(ctx context.Context, config *config.AppConfig, certBundle *
 		failureChan:       make(chan model.ContainerMeta, 10),
 		tokenChan:         make(chan string, 1), // 用于接收token更新
 		token:             token,
+		identityStore:     identityStore,
+		tracker:           tracker.NewTracker(),
+		crashLoop:         crashloop.NewDetector(config.CrashLoopConfig.Window, config.CrashLoopConfig.Threshold),
+		autoHealer:        newAutoHealer(),
 	}
+	agentService.prober = probe.NewProber(agentService.onReadinessChange)
 
 	if certBundle != nil {
 		cert, _ := tls.X509KeyPair(certBundle.CertPEM, certBundle.KeyPEM)
@@ -74,41 +109,137 @@ func NewAgentService(ctx context.Context, config *config.AppConfig, certBundle *
 		return nil, err
 	}
 
+	//容器stats后台采样, 供历史查询、心跳汇总与指标使用
+	agentService.statsSampler = stats.NewSampler(dockerClient, config.StatsConfig.Interval, config.StatsConfig.Retention)
+
+	//主机端口分配器, 记录已分配的端口, 重启后继续生效
+	if agentService.portAllocator, err = newPortAllocator(config); err != nil {
+		return nil, err
+	}
+
+	//镜像回收, 磁盘使用率超过高水位时删除未使用的镜像
+	if config.ImageGCConfig.Enabled {
+		agentService.imageGC, err = imagegc.NewCollector(dockerClient, config.DataDirectory, imagegc.Policy{
+			Interval:      config.ImageGCConfig.Interval,
+			HighWatermark: config.ImageGCConfig.HighWatermark,
+			LowWatermark:  config.ImageGCConfig.LowWatermark,
+			MinAge:        config.ImageGCConfig.MinAge,
+			Allowlist:     config.ImageGCConfig.Allowlist,
+		}, func() bool {
+			return agentService.tracker.Running(tracker.OperationContainerCreate, tracker.OperationJobExecute)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//容器secret存储, 根目录不可用时只有使用secret的容器创建失败
+	secretStore := secrets.NewStore(config.SecretsConfig.RootDirectory, config.SecretsConfig.RequireTmpfs)
+	if err = secretStore.Available(); err != nil {
+		logrus.Warnf("Container secrets disabled, %v", err)
+	}
+
+	//Job镜像仓库凭据存储, 使用节点密钥加密
+	credentialStore, err := newCredentialStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	//镜像仓库凭据, 合并config.yaml、主机docker config.json与Master下发的凭据
+	registries := newRegistryManager(config)
+	puller := imagepull.NewPuller(dockerClient, registries, registryMirrorRules(config))
+
 	//构建API和Controller接口
 	appController := controller.NewController(
 		dockerClient,
 		agentService.sendConfigValuesRequest,
+		agentService.sendSecretValuesRequest,
 		config.VolumesConfig.RootDirectory,
 		config.DockerTimeoutOpts.Request,
 		agentService.failureChan,
+		agentService.tracker,
+		agentService.statsSampler,
+		stats.NewHub(dockerClient),
+		agentService.portAllocator,
+		configvol.NewManager(config.VolumesConfig.RootDirectory),
+		agentService.lastHostInfo,
+		secretStore,
+		credentialStore,
+		registries,
+		puller,
 	)
 
-	apiServer, err := api.NewAPIServer(appController, config.APIConfig, certBundle, token, agentService.tokenChan)
+	var metricsHandler http.Handler
+	if config.MetricsConfig.Enabled {
+		if err = agentService.registerMetrics(); err != nil {
+			return nil, err
+		}
+		if config.MetricsConfig.ListenAddress != "" {
+			agentService.metricsServer = metrics.NewServer(config.MetricsConfig.ListenAddress)
+		} else {
+			metricsHandler = metrics.Handler()
+		}
+	}
+
+	apiServer, err := api.NewAPIServer(appController, config.APIConfig, certBundle, token, agentService.tokenChan, metricsHandler)
 	if err != nil {
 		return nil, err
 	}
 
 	agentService.apiServer = apiServer
-	agentService.scheduler = schedule.NewJobScheduler(dockerClient) //构建任务定时调度器
+	agentService.scheduler = schedule.NewJobScheduler(dockerClient, agentService.tracker, credentialStore, puller) //构建任务定时调度器
 	agentService.controller = appController
 
+	go agentService.watchMetaChange()
+
+	//迁移旧版本Job凭据标签, 需在加载容器前完成
+	agentService.migrateJobCredentials(ctx, dockerClient)
+
 	//启动先加载本地所有容器
 	if err = agentService.loadDockerContainers(ctx); err != nil {
 		return nil, err
 	}
 
+	//清理或恢复上次关闭时未完成的操作
+	agentService.recoverInterruptedOperations(ctx)
+
+	//清理没有容器使用的配置卷
+	agentService.collectConfigVolumes(ctx)
+	//清理没有容器使用的secret, 恢复主机重启后丢失的secret
+	agentService.syncSecrets(ctx)
+	//清理没有容器使用的Job凭据
+	agentService.collectJobCredentials()
+
 	//启动服务API
 	if err = apiServer.Startup(ctx); err != nil {
 		return nil, err
 	}
 
+	if agentService.metricsServer != nil {
+		if err = agentService.metricsServer.Startup(); err != nil {
+			return nil, err
+		}
+	}
+
+	agentService.statsSampler.Start(ctx)
+	if agentService.imageGC != nil {
+		agentService.imageGC.Start(ctx)
+	}
+	//启动就绪探测
+	agentService.RLock()
+	for _, containerInfo := range agentService.containers {
+		agentService.syncReadinessProbe(containerInfo)
+	}
+	agentService.RUnlock()
+	agentService.prober.Start(ctx)
+
 	//启动心跳
 	go agentService.heartbeatLoop()
 
-	go agentService.watchMetaChange()
-
 	//启动docker事件监听
 	go agentService.watchDockerEvents(ctx, dockerClient)
+	//启动unhealthy容器自动重启检查
+	go agentService.watchAutoHeal(ctx)
 	//启动定时任务调度器
 	agentService.scheduler.Start()
 	//初始化一次所有定时容器, 加入调度器
@@ -122,13 +253,34 @@ func NewAgentService(ctx context.Context, config *config.AppConfig, certBundle *
 }
 
 func (agentService *AgentService) Shutdown(ctx context.Context) {
+	//停止接收新的操作
+	agentService.tracker.Close()
 	if agentService.apiServer != nil {
 		if err := agentService.apiServer.Stop(ctx); err != nil {
 			logrus.Errorf("Humpback Agent api server stop error, %s", err.Error())
 		}
 	}
+	if agentService.metricsServer != nil {
+		if err := agentService.metricsServer.Stop(ctx); err != nil {
+			logrus.Errorf("Humpback Agent metrics server stop error, %s", err.Error())
+		}
+	}
+	agentService.statsSampler.Stop()
+	if agentService.imageGC != nil {
+		agentService.imageGC.Stop()
+	}
+	agentService.prober.Stop()
 	//关闭定时任务调度器
 	agentService.scheduler.Stop()
+	//等待执行中的操作和任务完成, 超时未完成的记录下来供下次启动处理
+	logrus.Infof("Humpback Agent draining %d operations, timeout %s.", agentService.tracker.Pending(), agentService.config.DrainTimeout)
+	interrupted := agentService.tracker.Drain(agentService.config.DrainTimeout)
+	for _, operation := range interrupted {
+		logrus.Warnf("Humpback Agent operation %s %s interrupted by shutdown.", operation.Kind, operation.Target)
+	}
+	if err := tracker.SaveInterrupted(agentService.config.DataDirectory, interrupted); err != nil {
+		logrus.Errorf("Humpback Agent save interrupted operations error, %s", err.Error())
+	}
 }
 
 func (agentService *AgentService) loadDockerContainers(ctx context.Context) error {
@@ -139,17 +291,25 @@ func (agentService *AgentService) loadDockerContainers(ctx context.Context) erro
 
 	containers := result.Object.([]types.Container)
 	slog.Info("[loadDockerContainers] contianer len.", "Length", len(containers))
-	agentService.Lock()
+	loaded := make(map[string]*model.ContainerInfo, len(containers))
+	ports := make(map[string][]portalloc.Port, len(containers))
+	names := make(map[string]string, len(containers))
 	for _, container := range containers {
 		result = agentService.controller.Container().Get(ctx, &v1model.GetContainerRequest{ContainerId: container.ID})
 		if result.Error != nil {
 			return fmt.Errorf("load container inspect %s error, %v", container.ID, result.Error)
 		}
-		containerInfo := model.ParseContainerInfo(result.Object.(types.ContainerJSON))
-		agentService.containers[container.ID] = containerInfo
+		containerJSON := result.Object.(types.ContainerJSON)
+		containerInfo := model.ParseContainerInfo(containerJSON)
+		loaded[container.ID] = containerInfo
+		ports[container.ID] = containerPorts(containerJSON)
+		names[container.ID] = containerJSON.Name
 		slog.Info("[loadDockerContainers] add to cache.", "ContainerID", container.ID, "Name", containerInfo.ContainerName)
 	}
+	agentService.Lock()
+	agentService.containers = loaded
 	agentService.Unlock()
+	agentService.portAllocator.Sync(ports, names)
 	return nil
 }
 
@@ -158,37 +318,167 @@ func (agentService *AgentService) fetchContainer(ctx context.Context, containerI
 	if result.Error != nil {
 		return nil, fmt.Errorf("get container %s error, %v", containerId, result.Error)
 	}
-	return model.ParseContainerInfo(result.Object.(types.ContainerJSON)), nil
+	containerJSON := result.Object.(types.ContainerJSON)
+	agentService.portAllocator.Bind(containerJSON.ID, containerJSON.Name, containerPorts(containerJSON))
+	return model.ParseContainerInfo(containerJSON), nil
 }
 
 func (agentService *AgentService) heartbeatLoop() {
+	unauthorized := 0
 	for {
 		if err := agentService.sendHealthRequest(context.Background()); err != nil {
 			logrus.Errorf("heartbeat health send request error: %+v", err.Error())
+			if !errors.Is(err, reqclient.ErrUnauthorized) {
+				unauthorized = 0
+			} else if unauthorized++; unauthorized == maxUnauthorizedHeartbeats && agentService.identityStore != nil {
+				//连续多次被Master拒绝才删除本地身份, 避免服务端或代理的偶发401清除身份, 下次启动时使用注册token重新注册
+				if removeErr := agentService.identityStore.Remove(); removeErr != nil {
+					logrus.Errorf("remove rejected agent identity error, %s", removeErr.Error())
+				} else {
+					logrus.Warn("agent identity rejected by master, it will register again on next start.")
+				}
+			}
 		} else {
+			unauthorized = 0
 			logrus.Debugf("heartbeat health send request done at %s\n", time.Now().String())
 		}
 		time.Sleep(agentService.config.Health.Interval)
 	}
 }
 
+// watchDockerEvents 订阅docker事件, 事件流中断后从最后处理的事件时间重新订阅以补发丢失的事件,
+// 并全量同步一次容器缓存, dockerd可能在Ping之前已完成重启, 重启前的事件无法补发
 func (agentService *AgentService) watchDockerEvents(ctx context.Context, dockerClient *client.Client) {
-	eventChan, errChan := dockerClient.Events(ctx, types.EventsOptions{})
+	for {
+		options := events.ListOptions{}
+		if lastEventNano := agentService.lastEventNano.Load(); lastEventNano > 0 {
+			options.Since = time.Unix(0, lastEventNano+1).UTC().Format(time.RFC3339Nano)
+		}
+
+		eventCtx, cancel := context.WithCancel(ctx)
+		eventChan, errChan := dockerClient.Events(eventCtx, options)
+		err := agentService.consumeDockerEvents(eventCtx, eventChan, errChan)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		logrus.Errorf("Watch docker event error, %v, resubscribe since %s", err, options.Since)
+		interrupted := agentService.waitDockerEngine(ctx, err)
+		if ctx.Err() != nil {
+			return
+		}
+
+		agentService.resyncDockerContainers(ctx)
+		if interrupted {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 1):
+		}
+	}
+}
+
+func (agentService *AgentService) consumeDockerEvents(ctx context.Context, eventChan <-chan events.Message, errChan <-chan error) error {
 	for {
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case event := <-eventChan:
 			agentService.handleDockerEvent(event)
+			agentService.lastEventNano.Store(event.TimeNano)
 		case err := <-errChan:
-			logrus.Errorf("Watch docker event error, %v", err)
-			time.Sleep(time.Second * 1)
+			return err
+		}
+	}
+}
+
+// waitDockerEngine 等待docker engine可用, 期间心跳上报engine不可用, 返回engine是否曾经中断过
+func (agentService *AgentService) waitDockerEngine(ctx context.Context, cause error) bool {
+	interrupted := false
+	backoff := time.Second
+	for {
+		err := agentService.controller.DockerPing(ctx)
+		if err == nil {
+			if interrupted {
+				logrus.Info("Docker engine available again.")
+				agentService.setDockerEngineError(nil)
+			}
+			return interrupted
+		}
+
+		if !interrupted {
+			interrupted = true
+			if cause == nil {
+				cause = err
+			}
+			logrus.Errorf("Docker engine unavailable, %v", cause)
+			agentService.setDockerEngineError(cause)
+			agentService.sendHealthRequest(context.Background())
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+
+		if backoff < maxDockerReconnectBackoff {
+			backoff *= 2
 		}
 	}
 }
 
+// resyncDockerContainers docker engine重连后全量同步容器缓存及定时任务
+func (agentService *AgentService) resyncDockerContainers(ctx context.Context) {
+	agentService.RLock()
+	previous := agentService.containers
+	agentService.RUnlock()
+
+	if err := agentService.loadDockerContainers(ctx); err != nil {
+		logrus.Errorf("Resync docker containers error, %v", err)
+		return
+	}
+
+	agentService.RLock()
+	current := agentService.containers
+	agentService.RUnlock()
+
+	for containerId := range previous {
+		if _, ret := current[containerId]; !ret {
+			agentService.removeFromScheduler(containerId)
+			agentService.prober.Remove(containerId)
+		}
+	}
+
+	for containerId, containerInfo := range current {
+		agentService.syncReadinessProbe(containerInfo)
+		if _, ret := previous[containerId]; !ret {
+			if _, isJob := containerInfo.Labels[schedule.HumpbackJobRulesLabel]; isJob {
+				agentService.addToScheduler(containerInfo.ContainerId, containerInfo.ContainerName, containerInfo.Image, containerInfo.Labels)
+			}
+		}
+	}
+
+	slog.Info("[resyncDockerContainers] docker containers resynced.", "Length", len(current))
+	agentService.sendHealthRequest(context.Background())
+}
+
+func (agentService *AgentService) setDockerEngineError(err error) {
+	agentService.Lock()
+	agentService.dockerEngineErr = err
+	agentService.Unlock()
+}
+
 func (agentService *AgentService) handleDockerEvent(message events.Message) {
+	agentService.trackCrashLoop(message)
+	agentService.trackAutoHeal(message)
 	if message.Type == "container" {
 		switch message.Action {
-		case "create", "start", "stop", "die", "kill", "healthy", "unhealthy":
+		case "create", "start", "stop", "die", "kill", "oom", "healthy", "unhealthy", events.ActionHealthStatusHealthy, events.ActionHealthStatusUnhealthy:
 			containerInfo, err := agentService.fetchContainer(context.Background(), message.Actor.ID)
 			if err != nil {
 				logrus.Errorf("Docker create container %s event, %v", message.Actor.ID, err)
@@ -217,12 +507,13 @@ func (agentService *AgentService) handleDockerEvent(message events.Message) {
 
 				agentService.Lock()
 				old, ok := agentService.containers[containerInfo.ContainerId]
-				if ok && old.State == containerInfo.State {
+				if ok && old.State == containerInfo.State && message.Action != "oom" {
 					needReport = false
 				}
 				agentService.containers[containerInfo.ContainerId] = containerInfo
 
 				agentService.Unlock()
+				agentService.syncReadinessProbe(containerInfo)
 
 				if needReport {
 					slog.Info("send heartbeat", "container", containerInfo.ContainerName, "action", message.Action, "status", containerInfo.State)
@@ -248,6 +539,12 @@ func (agentService *AgentService) handleDockerEvent(message events.Message) {
 			agentService.Lock()
 			delete(agentService.containers, message.Actor.ID)
 			agentService.Unlock()
+			agentService.prober.Remove(message.Actor.ID)
+			if message.Action == "destroy" {
+				agentService.portAllocator.Release(message.Actor.ID)
+				agentService.releaseConfigVolumes(message.Actor.ID, message.Actor.Attributes)
+				agentService.releaseSecrets(message.Actor.ID, message.Actor.Attributes)
+			}
 		}
 	}
 }
@@ -258,7 +555,6 @@ func (agentService *AgentService) addToScheduler(containerId string, containerNa
 			err        error
 			timeout    time.Duration
 			alwaysPull bool
-			authStr    string
 		)
 		rules := strings.Split(value, ";")
 		if value, ret = containerLabels[schedule.HumpbackJobMaxTimeoutLabel]; ret && value != "" {
@@ -273,11 +569,15 @@ func (agentService *AgentService) addToScheduler(containerId string, containerNa
 			}
 		}
 
-		if value, ret = containerLabels[schedule.HumpbackJobImageAuth]; ret {
-			authStr = value
+		authId := containerLabels[schedule.HumpbackJobImageAuthId]
+		if value, ret = containerLabels[schedule.HumpbackJobImageAuth]; ret && value != "" {
+			//运行中未能迁移的容器, 由任务重建时改写标签
+			if authId, err = agentService.importLegacyCredential(value); err != nil {
+				return err
+			}
 		}
 
-		return agentService.scheduler.AddContainer(containerId, containerName, containerImage, alwaysPull, rules, authStr, timeout)
+		return agentService.scheduler.AddContainer(containerId, containerName, containerImage, alwaysPull, rules, authId, timeout)
 	}
 	return nil
 }
@@ -318,10 +618,21 @@ func (agentService *AgentService) watchMetaChange() {
 }
 
 func (agentService *AgentService) sendHealthRequest(ctx context.Context) error {
-	// 获取 Docker Engine 信息
-	dockerEngineInfo, err := agentService.controller.DockerEngine(ctx)
-	if err != nil {
-		return err
+	// 获取 Docker Engine 信息, engine不可用时仍上报心跳
+	agentService.RLock()
+	dockerEngineErr := agentService.dockerEngineErr
+	agentService.RUnlock()
+	dockerEngineInfo := &model.DockerEngineInfo{State: model.DockerEngineStateUnavailable}
+	if dockerEngineErr != nil {
+		dockerEngineInfo.ErrorMsg = dockerEngineErr.Error()
+	} else {
+		engineInfo, err := agentService.controller.DockerEngine(ctx)
+		if err != nil {
+			logrus.Errorf("heartbeat get docker engine info error, %v", err)
+			dockerEngineInfo.ErrorMsg = err.Error()
+		} else {
+			dockerEngineInfo = engineInfo
+		}
 	}
 
 	//本地容器信息
@@ -346,25 +657,81 @@ func (agentService *AgentService) sendHealthRequest(ctx context.Context) error {
 
 	agentService.RUnlock()
 
+	//附带保留窗口内的stats汇总、CrashLoop、自动重启与就绪信息, 复制一份避免修改缓存
+	for i, containerInfo := range containers {
+		summary := agentService.statsSampler.Summary(containerInfo.ContainerId)
+		crashLoop := agentService.crashLoop.Info(containerInfo.ContainerId)
+		autoHeal := agentService.autoHealer.Info(containerInfo.ContainerId)
+		readiness := agentService.prober.Info(containerInfo.ContainerId)
+		if summary != nil || crashLoop != nil || autoHeal != nil || readiness != nil {
+			reportInfo := *containerInfo
+			reportInfo.StatsSummary = summary
+			reportInfo.CrashLoop = crashLoop
+			reportInfo.AutoHeal = autoHeal
+			reportInfo.Readiness = readiness
+			containers[i] = &reportInfo
+		}
+	}
+
+	hostInfo := model.GetHostInfo(agentService.config.APIConfig.HostIP, agentService.config.APIConfig.Port, dockerEngineInfo.RootDirectory, agentService.config.VolumesConfig.RootDirectory)
+	agentService.Lock()
+	agentService.hostInfo = &hostInfo
+	agentService.Unlock()
+
 	payload := &model.HostHealthRequest{
-		HostInfo:     model.GetHostInfo(agentService.config.APIConfig.HostIP, agentService.config.APIConfig.Port),
-		DockerEngine: *dockerEngineInfo,
-		Containers:   containers,
+		HostInfo:       hostInfo,
+		DockerEngine:   *dockerEngineInfo,
+		Containers:     containers,
+		AllocatedPorts: agentService.portAllocator.Ports(),
+	}
+	if agentService.imageGC != nil {
+		payload.ImageGC = agentService.imageGC.Status()
 	}
 
 	// for _, containerInfo := range containers {
 	// 	slog.Info("report container", "containername", containerInfo.ContainerName, "state", containerInfo.State, "error", containerInfo.ErrorMsg)
 	// }
 
-	token, err := reqclient.PostRequest(agentService.httpClient, fmt.Sprintf("https://%s/api/health", agentService.config.ServerConfig.Host), payload, agentService.token)
-	if err == nil && token != "" {
+	begin := time.Now()
+	healthResp := &model.HostHealthResponse{}
+	err := reqclient.PostRequestWithResult(agentService.httpClient, fmt.Sprintf("https://%s/api/health", agentService.config.ServerConfig.Host), payload, agentService.token, healthResp)
+	metrics.HeartbeatDuration.Observe(time.Since(begin).Seconds())
+	if err != nil {
+		metrics.HeartbeatFailures.Inc()
+	}
+	if err == nil && healthResp.RegistryCredentials != nil {
+		agentService.controller.Registries().SetServerCredentials(healthResp.RegistryCredentials)
+	}
+	if err == nil && len(healthResp.ChangedConfigs) > 0 {
+		agentService.refreshConfigs(healthResp.ChangedConfigs)
+	}
+	if token := healthResp.Token; err == nil && token != "" {
 		slog.Info("new token received")
 		agentService.token = token
 		agentService.tokenChan <- token // 更新token
+		if agentService.identityStore != nil {
+			if saveErr := agentService.identityStore.UpdateToken(token); saveErr != nil {
+				logrus.Errorf("save agent identity token error, %s", saveErr.Error())
+			}
+		}
 	}
 	return err
 }
 
+func (agentService *AgentService) registerMetrics() error {
+	if err := metrics.Register(metrics.NewContainerCollector(agentService.statsSampler)); err != nil {
+		return err
+	}
+	return metrics.Register(metrics.NewHostCollector(agentService.lastHostInfo))
+}
+
+// lastHostInfo 最近一次心跳采集的主机信息
+func (agentService *AgentService) lastHostInfo() *model.HostInfo {
+	agentService.RLock()
+	defer agentService.RUnlock()
+	return agentService.hostInfo
+}
+
 func (agentService *AgentService) sendConfigValuesRequest(configNames []string) (map[string][]byte, error) {
 	configPair := map[string][]byte{}
 	for _, configName := range configNames {
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/tracker"
+	"humpback-agent/model"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	autoHealCheckInterval      = time.Second * 5
+	defaultAutoHealThreshold   = 3
+	defaultAutoHealMinInterval = time.Minute * 5
+	// docker HEALTHCHECK默认重试次数
+	defaultHealthRetries = 3
+)
+
+type autoHealRecord struct {
+	lastRestart time.Time
+	suppressed  bool //当前minInterval窗口内已记录过抑制
+	info        model.AutoHealInfo
+}
+
+// autoHealer 跟踪配置了Humpback-AutoHeal标签且处于unhealthy的容器
+type autoHealer struct {
+	sync.Mutex
+	unhealthy map[string]struct{}
+	records   map[string]*autoHealRecord
+}
+
+func newAutoHealer() *autoHealer {
+	return &autoHealer{
+		unhealthy: make(map[string]struct{}),
+		records:   make(map[string]*autoHealRecord),
+	}
+}
+
+func (healer *autoHealer) mark(containerId string, unhealthy bool) {
+	healer.Lock()
+	defer healer.Unlock()
+	if unhealthy {
+		healer.unhealthy[containerId] = struct{}{}
+	} else {
+		delete(healer.unhealthy, containerId)
+	}
+}
+
+func (healer *autoHealer) remove(containerId string) {
+	healer.Lock()
+	defer healer.Unlock()
+	delete(healer.unhealthy, containerId)
+	delete(healer.records, containerId)
+}
+
+func (healer *autoHealer) pending() []string {
+	healer.Lock()
+	defer healer.Unlock()
+	containerIds := make([]string, 0, len(healer.unhealthy))
+	for containerId := range healer.unhealthy {
+		containerIds = append(containerIds, containerId)
+	}
+	return containerIds
+}
+
+func (healer *autoHealer) record(containerId string) *autoHealRecord {
+	r, ok := healer.records[containerId]
+	if !ok {
+		r = &autoHealRecord{}
+		healer.records[containerId] = r
+	}
+	return r
+}
+
+// Info 返回容器的自动重启记录, 没有记录时返回nil
+func (healer *autoHealer) Info(containerId string) *model.AutoHealInfo {
+	healer.Lock()
+	defer healer.Unlock()
+	if r, ok := healer.records[containerId]; ok {
+		info := r.info
+		return &info
+	}
+	return nil
+}
+
+func parseAutoHealPolicy(labels map[string]string) (*v1model.AutoHeal, time.Duration, bool) {
+	value, ok := labels[v1model.ContainerLabelAutoHeal]
+	if !ok {
+		return nil, 0, false
+	}
+
+	policy := &v1model.AutoHeal{}
+	if err := json.Unmarshal([]byte(value), policy); err != nil || !policy.Enabled {
+		return nil, 0, false
+	}
+
+	if policy.UnhealthyThreshold <= 0 {
+		policy.UnhealthyThreshold = defaultAutoHealThreshold
+	}
+
+	minInterval := defaultAutoHealMinInterval
+	if policy.MinInterval != "" {
+		if duration, err := time.ParseDuration(policy.MinInterval); err == nil && duration > 0 {
+			minInterval = duration
+		}
+	}
+	return policy, minInterval, true
+}
+
+// trackAutoHeal 根据健康状态事件维护待检查的容器
+func (agentService *AgentService) trackAutoHeal(message events.Message) {
+	if message.Type != events.ContainerEventType {
+		return
+	}
+
+	containerId := message.Actor.ID
+	switch message.Action {
+	case events.ActionHealthStatusUnhealthy, "unhealthy":
+		if _, _, ok := parseAutoHealPolicy(message.Actor.Attributes); ok {
+			agentService.autoHealer.mark(containerId, true)
+		}
+	case events.ActionHealthStatusHealthy, "healthy", "die":
+		agentService.autoHealer.mark(containerId, false)
+	case "destroy":
+		agentService.autoHealer.remove(containerId)
+	}
+}
+
+// watchAutoHeal 定期检查unhealthy容器, 进入unhealthy后连续失败的探测次数达到阈值时重启容器
+func (agentService *AgentService) watchAutoHeal(ctx context.Context) {
+	//启动时已处于unhealthy的容器
+	agentService.RLock()
+	for _, containerInfo := range agentService.containers {
+		if _, _, ok := parseAutoHealPolicy(containerInfo.Labels); ok && containerInfo.Health == types.Unhealthy {
+			agentService.autoHealer.mark(containerInfo.ContainerId, true)
+		}
+	}
+	agentService.RUnlock()
+
+	ticker := time.NewTicker(autoHealCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, containerId := range agentService.autoHealer.pending() {
+				agentService.checkAutoHeal(ctx, containerId)
+			}
+		}
+	}
+}
+
+func (agentService *AgentService) checkAutoHeal(ctx context.Context, containerId string) {
+	result := agentService.controller.Container().Get(ctx, &v1model.GetContainerRequest{ContainerId: containerId})
+	if result.Error != nil {
+		agentService.autoHealer.mark(containerId, false)
+		return
+	}
+
+	containerBody := result.Object.(types.ContainerJSON)
+	if containerBody.State == nil || containerBody.State.Health == nil || containerBody.State.Health.Status != types.Unhealthy || !containerBody.State.Running {
+		agentService.autoHealer.mark(containerId, false)
+		return
+	}
+
+	policy, minInterval, ok := parseAutoHealPolicy(containerBody.Config.Labels)
+	if !ok {
+		agentService.autoHealer.mark(containerId, false)
+		return
+	}
+
+	retries := defaultHealthRetries
+	if containerBody.Config.Healthcheck != nil && containerBody.Config.Healthcheck.Retries > 0 {
+		retries = containerBody.Config.Healthcheck.Retries
+	}
+	unhealthyCount := containerBody.State.Health.FailingStreak - retries + 1
+	if unhealthyCount < policy.UnhealthyThreshold {
+		return
+	}
+
+	containerName := strings.TrimPrefix(containerBody.Name, "/")
+	now := time.Now()
+	agentService.autoHealer.Lock()
+	r := agentService.autoHealer.record(containerId)
+	if !r.lastRestart.IsZero() && now.Sub(r.lastRestart) < minInterval {
+		//窗口内只记录一次抑制, 窗口结束后仍unhealthy时再重启
+		suppressed := r.suppressed
+		if !suppressed {
+			r.suppressed = true
+			r.info.Suppressed++
+			r.info.LastSuppressed = now.UnixMilli()
+		}
+		agentService.autoHealer.Unlock()
+		if !suppressed {
+			slog.Warn("auto heal restart suppressed", "container", containerName, "lastRestart", r.lastRestart.Format(time.RFC3339), "minInterval", minInterval.String())
+		}
+		return
+	}
+	r.lastRestart = now
+	r.suppressed = false
+	agentService.autoHealer.Unlock()
+	agentService.autoHealer.mark(containerId, false)
+
+	reason := fmt.Sprintf("unhealthy for %d consecutive probes", unhealthyCount)
+	if count := len(containerBody.State.Health.Log); count > 0 {
+		reason = fmt.Sprintf("%s, last output: %s", reason, containerBody.State.Health.Log[count-1].Output)
+	}
+
+	slog.Warn("auto heal restart container", "container", containerName, "reason", reason)
+	err := agentService.tracker.Go(tracker.OperationContainerRestart, containerId, func(ctx context.Context) {
+		restartResult := agentService.controller.Container().Restart(ctx, &v1model.RestartContainerRequest{ContainerId: containerId})
+		agentService.autoHealer.Lock()
+		r := agentService.autoHealer.record(containerId)
+		if restartResult.Error != nil {
+			reason = fmt.Sprintf("%s, restart failed: %s", reason, restartResult.Error.ErrMsg)
+		} else {
+			r.info.Restarts++
+		}
+		r.info.LastRestart = now.UnixMilli()
+		r.info.LastReason = reason
+		agentService.autoHealer.Unlock()
+		agentService.sendHealthRequest(context.Background())
+	})
+	if err != nil {
+		logrus.Warnf("Auto heal restart container %s rejected, %s", containerName, err.Error())
+	}
+}
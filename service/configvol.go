@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/configvol"
+	"humpback-agent/model"
+
+	"github.com/docker/docker/api/types"
+	"github.com/sirupsen/logrus"
+)
+
+// configVolumesInUse 从docker获取全部容器计算使用中的配置卷, 不使用缓存以免遗漏刚创建的容器
+func (agentService *AgentService) configVolumesInUse(ctx context.Context) (map[string]struct{}, error) {
+	result := agentService.controller.Container().List(ctx, &v1model.QueryContainerRequest{All: true})
+	if result.Error != nil {
+		return nil, fmt.Errorf("list containers error, %s", result.Error.ErrMsg)
+	}
+	return agentService.controller.ConfigVolumes().InUse(result.Object.([]types.Container)), nil
+}
+
+// releaseConfigVolumes 容器删除后清理其不再被其他容器使用的配置卷
+func (agentService *AgentService) releaseConfigVolumes(containerId string, labels map[string]string) {
+	volumes := configvol.FromLabels(labels)
+	if len(volumes) == 0 {
+		return
+	}
+
+	inUse := func() (map[string]struct{}, error) {
+		return agentService.configVolumesInUse(context.Background())
+	}
+	if err := agentService.controller.ConfigVolumes().Remove(volumes, inUse); err != nil {
+		logrus.Errorf("Release container %s config volumes error, %v", containerId, err)
+	}
+}
+
+// collectConfigVolumes 启动时清理没有容器使用的配置卷
+func (agentService *AgentService) collectConfigVolumes(ctx context.Context) {
+	inUse := func() (map[string]struct{}, error) {
+		return agentService.configVolumesInUse(ctx)
+	}
+	removed, err := agentService.controller.ConfigVolumes().Collect(inUse)
+	if err != nil {
+		logrus.Errorf("Collect config volumes error, %v", err)
+	}
+	if len(removed) > 0 {
+		slog.Info("[collectConfigVolumes] orphan config volumes removed.", "Length", len(removed))
+	}
+}
+
+// refreshConfigs 心跳响应通知配置变更后在后台刷新使用这些配置的容器
+func (agentService *AgentService) refreshConfigs(configNames []string) {
+	go func() {
+		result := agentService.controller.Config().Refresh(context.Background(), &v1model.RefreshConfigRequest{ConfigNames: configNames})
+		if result.Error != nil {
+			logrus.Errorf("Refresh configs %v error, %s", configNames, result.Error.ErrMsg)
+			return
+		}
+
+		for _, refresh := range result.Object.(*model.ConfigRefreshResult).Containers {
+			if refresh.Error != "" {
+				logrus.Errorf("Refresh container %s configs %v error, %s", refresh.ContainerName, refresh.ConfigNames, refresh.Error)
+				continue
+			}
+			slog.Info("[refreshConfigs] container configs refreshed.", "Container", refresh.ContainerName, "Configs", refresh.ConfigNames, "Changed", refresh.Changed, "Reload", refresh.ReloadAction)
+		}
+	}()
+}
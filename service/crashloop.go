@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/schedule"
+	"humpback-agent/internal/tracker"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/sirupsen/logrus"
+)
+
+// trackCrashLoop 根据容器事件统计退出次数, job容器按计划退出不参与统计
+func (agentService *AgentService) trackCrashLoop(message events.Message) {
+	if message.Type != events.ContainerEventType {
+		return
+	}
+
+	containerId := message.Actor.ID
+	switch message.Action {
+	case "kill":
+		agentService.crashLoop.Kill(containerId, time.Unix(0, message.TimeNano))
+	case "oom":
+		agentService.crashLoop.OOM(containerId)
+	case "start":
+		agentService.crashLoop.Start(containerId)
+	case "destroy":
+		agentService.crashLoop.Remove(containerId)
+	case "die":
+		if _, ret := message.Actor.Attributes[schedule.HumpbackJobRulesLabel]; ret {
+			return
+		}
+
+		exitCode, _ := strconv.Atoi(message.Actor.Attributes["exitCode"])
+		restarts, entered := agentService.crashLoop.Die(containerId, exitCode, time.Unix(0, message.TimeNano))
+		stopThreshold := agentService.config.CrashLoopConfig.StopThreshold
+		needStop := stopThreshold > 0 && restarts >= stopThreshold
+		if entered || needStop {
+			go agentService.handleCrashLoop(containerId, message.Actor.Attributes["name"], restarts, entered, needStop)
+		}
+	}
+}
+
+// handleCrashLoop 进入CrashLoop时记录最后日志, 超过停止阈值时停止容器, 然后主动上报一次心跳
+func (agentService *AgentService) handleCrashLoop(containerId string, containerName string, restarts int, entered bool, needStop bool) {
+	slog.Warn("container crash loop", "container", containerName, "restarts", restarts, "window", agentService.config.CrashLoopConfig.Window.String())
+	if entered && agentService.config.CrashLoopConfig.LogLines > 0 {
+		tail := strconv.Itoa(agentService.config.CrashLoopConfig.LogLines)
+		result := agentService.controller.Container().Logs(context.Background(), &v1model.GetContainerLogsRequest{ContainerId: containerId, Tail: &tail})
+		if logs, ok := result.Object.([]string); ok && result.Error == nil {
+			agentService.crashLoop.SetLastLogs(containerId, logs)
+		}
+	}
+
+	if needStop {
+		err := agentService.tracker.Go(tracker.OperationContainerStop, containerId, func(ctx context.Context) {
+			result := agentService.controller.Container().Stop(ctx, &v1model.StopContainerRequest{ContainerId: containerId})
+			if result.Error != nil {
+				logrus.Errorf("Stop crash loop container %s error, %s", containerName, result.Error.ErrMsg)
+				return
+			}
+			agentService.crashLoop.SetStopped(containerId)
+			slog.Warn("crash loop container stopped", "container", containerName, "restarts", restarts)
+			agentService.sendHealthRequest(context.Background())
+		})
+		if err != nil {
+			logrus.Warnf("Stop crash loop container %s rejected, %s", containerName, err.Error())
+		}
+		return
+	}
+	agentService.sendHealthRequest(context.Background())
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/config"
+	"humpback-agent/internal/credstore"
+	"humpback-agent/internal/identity"
+	"humpback-agent/internal/schedule"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+// newCredentialStore 优先使用身份密钥作为节点密钥, 未配置时由凭据存储生成密钥文件
+func newCredentialStore(config *config.AppConfig) (*credstore.Store, error) {
+	key, err := identity.LoadKey(config.AgentConfig.IdentityKey, config.AgentConfig.IdentityKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return credstore.NewStore(config.AgentConfig.DataDirectory, key)
+}
+
+func (agentService *AgentService) importLegacyCredential(value string) (string, error) {
+	credential, err := credstore.ParseLegacy(value)
+	if err != nil {
+		return "", err
+	}
+	return agentService.controller.Credentials().Put(credential)
+}
+
+// migrateJobCredentials 将旧版本标签中的base64凭据导入凭据存储, 未运行的容器立即重建改写标签,
+// 运行中的容器在任务下次重建时改写
+func (agentService *AgentService) migrateJobCredentials(ctx context.Context, dockerClient *client.Client) {
+	result := agentService.controller.Container().List(ctx, &v1model.QueryContainerRequest{
+		All:     true,
+		Filters: map[string]string{"label": schedule.HumpbackJobImageAuth},
+	})
+	if result.Error != nil {
+		logrus.Errorf("Migrate job credentials error, %s", result.Error.ErrMsg)
+		return
+	}
+
+	for _, containerInfo := range result.Object.([]types.Container) {
+		authId, err := agentService.importLegacyCredential(containerInfo.Labels[schedule.HumpbackJobImageAuth])
+		if err != nil {
+			logrus.Errorf("Migrate container %s job credential error, %v", containerInfo.ID, err)
+			continue
+		}
+
+		if containerInfo.State == "running" {
+			continue
+		}
+
+		containerId, err := schedule.RecreateContainer(ctx, dockerClient, containerInfo.ID, func(config *container.Config) {
+			delete(config.Labels, schedule.HumpbackJobImageAuth)
+			config.Labels[schedule.HumpbackJobImageAuthId] = authId
+		})
+		if err != nil {
+			logrus.Errorf("Migrate container %s job credential error, %v", containerInfo.ID, err)
+			continue
+		}
+		slog.Info("[migrateJobCredentials] container job credential migrated.", "ContainerID", containerId)
+	}
+}
+
+// collectJobCredentials 启动时清除没有容器引用的凭据
+func (agentService *AgentService) collectJobCredentials() {
+	agentService.RLock()
+	inUse := map[string]struct{}{}
+	for _, containerInfo := range agentService.containers {
+		if authId := containerInfo.Labels[schedule.HumpbackJobImageAuthId]; authId != "" {
+			inUse[authId] = struct{}{}
+		}
+	}
+	agentService.RUnlock()
+
+	//尚未改写标签的旧版本容器
+	result := agentService.controller.Container().List(context.Background(), &v1model.QueryContainerRequest{
+		All:     true,
+		Filters: map[string]string{"label": schedule.HumpbackJobImageAuth},
+	})
+	if result.Error != nil {
+		logrus.Errorf("Collect job credentials error, %s", result.Error.ErrMsg)
+		return
+	}
+	for _, containerInfo := range result.Object.([]types.Container) {
+		authId, err := agentService.importLegacyCredential(containerInfo.Labels[schedule.HumpbackJobImageAuth])
+		if err != nil {
+			continue
+		}
+		inUse[authId] = struct{}{}
+	}
+
+	removed, err := agentService.controller.Credentials().Collect(inUse)
+	if err != nil {
+		logrus.Errorf("Collect job credentials error, %v", err)
+	}
+	if removed > 0 {
+		slog.Info("[collectJobCredentials] unused job credentials removed.", "Length", removed)
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"fmt"
+
+	"humpback-agent/config"
+	"humpback-agent/internal/portalloc"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/libnetwork/portallocator"
+	"github.com/docker/go-connections/nat"
+)
+
+// newPortAllocator 按配置构建端口分配器, 未配置的协议使用docker端口分配范围
+func newPortAllocator(config *config.AppConfig) (*portalloc.Allocator, error) {
+	dockerAllocator := portallocator.Get()
+	dockerRange := portalloc.Range{Begin: dockerAllocator.Begin, End: dockerAllocator.End}
+	ranges := map[string]portalloc.Range{}
+	for proto, value := range map[string]string{
+		portalloc.ProtocolTCP: config.PortsConfig.TCPRange,
+		portalloc.ProtocolUDP: config.PortsConfig.UDPRange,
+	} {
+		if value == "" {
+			ranges[proto] = dockerRange
+			continue
+		}
+		portRange, err := portalloc.ParseRange(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", proto, err)
+		}
+		ranges[proto] = portRange
+	}
+	return portalloc.NewAllocator(config.DataDirectory, ranges, config.PortsConfig.ReservationTTL)
+}
+
+// containerPorts 容器绑定的主机端口, 包括停止容器配置的端口
+func containerPorts(containerJSON types.ContainerJSON) []portalloc.Port {
+	var portMap nat.PortMap
+	if containerJSON.NetworkSettings != nil {
+		portMap = containerJSON.NetworkSettings.Ports
+	}
+	return portalloc.PortsFromContainer(containerJSON.HostConfig, portMap)
+}
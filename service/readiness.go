@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"humpback-agent/internal/probe"
+	"humpback-agent/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syncReadinessProbe 按容器当前状态添加、更新或移除就绪探测
+func (agentService *AgentService) syncReadinessProbe(containerInfo *model.ContainerInfo) {
+	if containerInfo.State != model.ContainerStatusRunning {
+		agentService.prober.Remove(containerInfo.ContainerId)
+		return
+	}
+
+	spec, err := probe.ParseSpec(containerInfo.Labels)
+	if err != nil {
+		logrus.Warnf("Container %s readiness probe invalid, %s", containerInfo.ContainerName, err.Error())
+	}
+
+	if spec == nil {
+		agentService.prober.Remove(containerInfo.ContainerId)
+		return
+	}
+	agentService.prober.Set(containerInfo.ContainerId, spec, probeAddress(containerInfo, spec.Port()))
+}
+
+// probeAddress 优先使用发布到宿主机的端口, host网络使用本机地址, 否则使用容器IP
+func probeAddress(containerInfo *model.ContainerInfo, port uint) string {
+	for _, containerPort := range containerInfo.Ports {
+		if containerPort.PrivatePort != int(port) || containerPort.Type != "tcp" || containerPort.PublicPort == 0 {
+			continue
+		}
+		host := containerPort.BindIP
+		if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+			host = "127.0.0.1"
+		}
+		return net.JoinHostPort(host, strconv.Itoa(containerPort.PublicPort))
+	}
+
+	if containerInfo.Network == "host" {
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))
+	}
+
+	for _, ipAddr := range containerInfo.IPAddr {
+		if ipAddr.IPAddress != "" {
+			return net.JoinHostPort(ipAddr.IPAddress, strconv.Itoa(int(port)))
+		}
+	}
+	return ""
+}
+
+func (agentService *AgentService) onReadinessChange(containerId string, ready bool) {
+	slog.Info("container readiness changed", "container", containerId, "ready", ready)
+	go agentService.sendHealthRequest(context.Background())
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	v1model "humpback-agent/api/v1/model"
+	"humpback-agent/internal/schedule"
+	"humpback-agent/internal/tracker"
+	"humpback-agent/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+const interruptedErrorMsg = "operation interrupted by agent shutdown"
+
+// recoverInterruptedOperations 启动时清理残留的废弃容器, 并根据上次关闭时记录的未完成操作进行恢复
+func (agentService *AgentService) recoverInterruptedOperations(ctx context.Context) {
+	changed := agentService.cleanupDiscardContainers(ctx)
+
+	operations, err := tracker.LoadInterrupted(agentService.config.DataDirectory)
+	if err != nil {
+		logrus.Errorf("Load interrupted operations error, %s", err.Error())
+	}
+
+	for _, operation := range operations {
+		slog.Info("[recoverInterruptedOperations] interrupted operation.", "Kind", operation.Kind, "Target", operation.Target)
+		switch operation.Kind {
+		case tracker.OperationContainerCreate:
+			containerInfo := agentService.findContainer(operation.Target)
+			if containerInfo == nil {
+				//容器未创建成功, 上报失败, 由Server重新调度
+				agentService.failureChan <- model.ContainerMeta{
+					ContainerName: operation.Target,
+					State:         model.ContainerStatusFailed,
+					ErrorMsg:      interruptedErrorMsg,
+				}
+				continue
+			}
+			//已创建但未启动的非job容器, 继续启动
+			if _, isJob := containerInfo.Labels[schedule.HumpbackJobRulesLabel]; !isJob && containerInfo.State == model.ContainerStatusCreated {
+				if result := agentService.controller.Container().Start(ctx, &v1model.StartContainerRequest{ContainerId: containerInfo.ContainerId}); result.Error == nil {
+					changed = true
+				}
+			}
+		case tracker.OperationContainerDelete:
+			if containerInfo := agentService.findContainer(operation.Target); containerInfo != nil {
+				if result := agentService.controller.Container().Delete(ctx, &v1model.DeleteContainerRequest{ContainerId: containerInfo.ContainerId, Force: true}); result.Error == nil {
+					changed = true
+				}
+			}
+		}
+	}
+
+	if changed {
+		if err = agentService.loadDockerContainers(ctx); err != nil {
+			logrus.Errorf("Reload containers after recovery error, %s", err.Error())
+		}
+	}
+}
+
+// cleanupDiscardContainers 处理job容器reCreate中断残留的-discard容器:
+// 新容器已创建则删除废弃容器, 否则将废弃容器还原为原名称
+func (agentService *AgentService) cleanupDiscardContainers(ctx context.Context) bool {
+	agentService.RLock()
+	names := map[string]string{}
+	discards := map[string]string{}
+	for containerId, containerInfo := range agentService.containers {
+		names[containerInfo.ContainerName] = containerId
+		if originName, ret := schedule.ParseDiscardContainerName(containerInfo.ContainerName); ret {
+			discards[containerId] = originName
+		}
+	}
+	agentService.RUnlock()
+
+	changed := false
+	for containerId, originName := range discards {
+		if _, ret := names[originName]; ret {
+			logrus.Infof("Remove discard container %s, container %s already recreated.", containerId, originName)
+			if result := agentService.controller.Container().Delete(ctx, &v1model.DeleteContainerRequest{ContainerId: containerId, Force: true}); result.Error == nil {
+				changed = true
+			}
+		} else {
+			logrus.Infof("Restore discard container %s name to %s.", containerId, originName)
+			if result := agentService.controller.Container().Rename(ctx, &v1model.RenameContainerRequest{ContainerId: containerId, NewName: originName}); result.Error == nil {
+				names[originName] = containerId
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// findContainer 按容器ID或名称查找缓存中的容器
+func (agentService *AgentService) findContainer(target string) *model.ContainerInfo {
+	agentService.RLock()
+	defer agentService.RUnlock()
+	if containerInfo, ret := agentService.containers[target]; ret {
+		return containerInfo
+	}
+
+	for _, containerInfo := range agentService.containers {
+		if containerInfo.ContainerName == target {
+			return containerInfo
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"humpback-agent/config"
+	"humpback-agent/internal/imagepull"
+	"humpback-agent/internal/regcred"
+)
+
+// newRegistryManager 默认仓库的用户名密码作为默认仓库的凭据, 与credentials列表合并
+func newRegistryManager(config *config.AppConfig) *regcred.Manager {
+	registryOpts := config.DockerConfig.DockerRegistryOpts
+	credentials := make([]regcred.Credential, 0, len(registryOpts.Credentials)+1)
+	if registryOpts.Default != "" && registryOpts.UserName != "" {
+		credentials = append(credentials, regcred.Credential{
+			Server:   registryOpts.Default,
+			Username: registryOpts.UserName,
+			Password: registryOpts.Password,
+		})
+	}
+
+	for _, credential := range registryOpts.Credentials {
+		credentials = append(credentials, regcred.Credential{
+			Server:   credential.Server,
+			Username: credential.UserName,
+			Password: credential.Password,
+		})
+	}
+	return regcred.NewManager(registryOpts.Default, credentials, registryOpts.DockerConfigFile)
+}
+
+func registryMirrorRules(config *config.AppConfig) []imagepull.MirrorRule {
+	rules := make([]imagepull.MirrorRule, 0, len(config.DockerConfig.DockerRegistryOpts.Mirrors))
+	for _, mirrorOpts := range config.DockerConfig.DockerRegistryOpts.Mirrors {
+		rule := imagepull.MirrorRule{Registry: mirrorOpts.Registry, Timeout: mirrorOpts.Timeout}
+		for _, endpoint := range mirrorOpts.Mirrors {
+			rule.Mirrors = append(rule.Mirrors, imagepull.Mirror{Host: endpoint.Host, Timeout: endpoint.Timeout})
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
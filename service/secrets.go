@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	v1model "humpback-agent/api/v1/model"
+	reqclient "humpback-agent/internal/client"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/sirupsen/logrus"
+)
+
+// releaseSecrets 容器删除后清除其secret目录, Job重建的容器沿用原标签, 仍有容器使用时不清除
+func (agentService *AgentService) releaseSecrets(containerId string, labels map[string]string) {
+	secretsId := labels[v1model.ContainerLabelSecretsId]
+	if secretsId == "" {
+		return
+	}
+
+	result := agentService.controller.Container().List(context.Background(), &v1model.QueryContainerRequest{
+		All:     true,
+		Filters: map[string]string{"label": fmt.Sprintf("%s=%s", v1model.ContainerLabelSecretsId, secretsId)},
+	})
+	if result.Error != nil {
+		logrus.Errorf("Release container %s secrets error, %s", containerId, result.Error.ErrMsg)
+		return
+	}
+	if len(result.Object.([]types.Container)) > 0 {
+		return
+	}
+
+	if err := agentService.controller.Secrets().Remove(secretsId); err != nil {
+		logrus.Errorf("Release container %s secrets error, %v", containerId, err)
+	}
+}
+
+// syncSecrets 启动时清除没有容器使用的secret目录, 恢复主机重启后tmpfs上丢失的secret并启动因此失败的容器
+func (agentService *AgentService) syncSecrets(ctx context.Context) {
+	if agentService.controller.Secrets().Available() != nil {
+		return
+	}
+
+	agentService.RLock()
+	labels := make(map[string]map[string]string, len(agentService.containers))
+	for containerId, containerInfo := range agentService.containers {
+		labels[containerId] = containerInfo.Labels
+	}
+	agentService.RUnlock()
+
+	inUse := map[string]struct{}{}
+	for _, containerLabels := range labels {
+		if secretsId := containerLabels[v1model.ContainerLabelSecretsId]; secretsId != "" {
+			inUse[secretsId] = struct{}{}
+		}
+	}
+
+	removed, err := agentService.controller.Secrets().Collect(inUse)
+	if err != nil {
+		logrus.Errorf("Collect secrets error, %v", err)
+	}
+	if removed > 0 {
+		slog.Info("[syncSecrets] orphan secrets removed.", "Length", removed)
+	}
+
+	for containerId, containerLabels := range labels {
+		restored, err := agentService.controller.Container().RestoreSecrets(ctx, containerLabels)
+		if err != nil {
+			logrus.Errorf("Restore container %s secrets error, %v", containerId, err)
+			continue
+		}
+		if restored {
+			slog.Info("[syncSecrets] container secrets restored.", "ContainerID", containerId)
+			agentService.startRestoredContainer(ctx, containerId)
+		}
+	}
+}
+
+// startRestoredContainer 主机重启后dockerd先于agent启动容器, secret文件尚未恢复导致启动失败,
+// 恢复secret后按重启策略启动这些容器
+func (agentService *AgentService) startRestoredContainer(ctx context.Context, containerId string) {
+	result := agentService.controller.Container().Get(ctx, &v1model.GetContainerRequest{ContainerId: containerId})
+	if result.Error != nil {
+		logrus.Errorf("Start secrets restored container %s error, %s", containerId, result.Error.ErrMsg)
+		return
+	}
+
+	containerJSON := result.Object.(types.ContainerJSON)
+	if containerJSON.State == nil || containerJSON.State.Running || containerJSON.HostConfig == nil {
+		return
+	}
+
+	//always不区分是否手动停止; unless-stopped与on-failure只启动dockerd尝试启动失败的容器
+	switch containerJSON.HostConfig.RestartPolicy.Name {
+	case container.RestartPolicyAlways:
+	case container.RestartPolicyUnlessStopped, container.RestartPolicyOnFailure:
+		if containerJSON.State.Error == "" {
+			return
+		}
+	default:
+		return
+	}
+
+	if result = agentService.controller.Container().Start(ctx, &v1model.StartContainerRequest{ContainerId: containerId}); result.Error != nil {
+		logrus.Errorf("Start secrets restored container %s error, %s", containerId, result.Error.ErrMsg)
+		return
+	}
+	slog.Info("[syncSecrets] secrets restored container started.", "ContainerID", containerId)
+}
+
+func (agentService *AgentService) sendSecretValuesRequest(secretNames []string) (map[string][]byte, error) {
+	secretPair := map[string][]byte{}
+	for _, secretName := range secretNames {
+		data, err := reqclient.GetRequest(agentService.httpClient, fmt.Sprintf("https://%s/api/secret/%s", agentService.config.ServerConfig.Host, secretName), agentService.token)
+		if err != nil {
+			return nil, fmt.Errorf("get secret %s error, %w", secretName, err)
+		}
+		secretPair[secretName] = data
+	}
+	return secretPair, nil
+}